@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expandAliases returns a copy of node with aliases replaced by copies of their anchored values and merge keys
+// merged into their mapping, so that decoding it yields plain nested values without shared maps or lists
+func expandAliases(node *yaml.Node) (*yaml.Node, error) {
+	return expandNode(node, make(map[*yaml.Node]bool))
+}
+
+// expandNode copies node, expanding keeps track of the anchored nodes being expanded to detect recursive aliases
+func expandNode(node *yaml.Node, expanding map[*yaml.Node]bool) (*yaml.Node, error) {
+	if node.Kind == yaml.AliasNode {
+		if expanding[node.Alias] {
+			return nil, fmt.Errorf("recursive alias *%s at line %d", node.Value, node.Line)
+		}
+		expanding[node.Alias] = true
+		defer delete(expanding, node.Alias)
+		return expandNode(node.Alias, expanding)
+	}
+
+	expanded := *node
+	expanded.Anchor = ""
+	expanded.Content = nil
+
+	if node.Kind == yaml.MappingNode {
+		return expandMapping(&expanded, node.Content, expanding)
+	}
+
+	for _, child := range node.Content {
+		c, err := expandNode(child, expanding)
+		if err != nil {
+			return nil, err
+		}
+		expanded.Content = append(expanded.Content, c)
+	}
+	return &expanded, nil
+}
+
+// expandMapping fills mapping with the expanded pairs, keys given explicitly take precedence over merged keys and
+// earlier merged mappings over later ones
+func expandMapping(mapping *yaml.Node, pairs []*yaml.Node, expanding map[*yaml.Node]bool) (*yaml.Node, error) {
+	seen := make(map[string]bool)
+	var merged []*yaml.Node
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		key, value := pairs[i], pairs[i+1]
+		if isMergeKey(key) {
+			sources := []*yaml.Node{value}
+			if value.Kind == yaml.SequenceNode {
+				sources = value.Content
+			}
+			for _, source := range sources {
+				s, err := expandNode(source, expanding)
+				if err != nil {
+					return nil, err
+				}
+				if s.Kind != yaml.MappingNode {
+					return nil, fmt.Errorf("merge key at line %d must refer to a mapping", key.Line)
+				}
+				merged = append(merged, s.Content...)
+			}
+			continue
+		}
+
+		k, err := expandNode(key, expanding)
+		if err != nil {
+			return nil, err
+		}
+		v, err := expandNode(value, expanding)
+		if err != nil {
+			return nil, err
+		}
+		seen[k.Value] = true
+		mapping.Content = append(mapping.Content, k, v)
+	}
+
+	for i := 0; i+1 < len(merged); i += 2 {
+		if seen[merged[i].Value] {
+			continue
+		}
+		seen[merged[i].Value] = true
+		mapping.Content = append(mapping.Content, merged[i], merged[i+1])
+	}
+	return mapping, nil
+}
+
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge"
+}
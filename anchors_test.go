@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpandAliases(t *testing.T) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(`
+defaults: &defaults
+  cpu: 100m
+  memory: 1G
+limits: &limits
+  cpu: 1
+containers:
+  - name: a
+    resources:
+      requests: *defaults
+  - name: b
+    resources:
+      requests:
+        <<: [*limits, *defaults]
+        memory: 2G
+`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expanded, err := expandAliases(&doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var actual map[string]interface{}
+	err = expanded.Decode(&actual)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var expected map[string]interface{}
+	err = yaml.Unmarshal([]byte(`
+defaults:
+  cpu: 100m
+  memory: 1G
+limits:
+  cpu: 1
+containers:
+  - name: a
+    resources:
+      requests:
+        cpu: 100m
+        memory: 1G
+  - name: b
+    resources:
+      requests:
+        cpu: 1
+        memory: 2G
+`), &expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	// the expanded values must not share maps
+	containers := actual["containers"].([]interface{})
+	requests := containers[0].(map[string]interface{})["resources"].(map[string]interface{})["requests"].(map[string]interface{})
+	requests["cpu"] = "200m"
+	if actual["defaults"].(map[string]interface{})["cpu"] != "100m" {
+		t.Errorf("expanded alias shares its map with the anchored value")
+	}
+}
+
+func TestExpandRecursiveAlias(t *testing.T) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(`
+a: &a
+  b: *a
+`), &doc)
+	if err != nil {
+		t.Skipf("yaml decoder already rejects recursive aliases: %v", err)
+	}
+
+	_, err = expandAliases(&doc)
+	if err == nil {
+		t.Errorf("expected an error for a recursive alias")
+	}
+}
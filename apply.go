@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+
+	"github.com/inconshreveable/log15"
+	flag "github.com/spf13/pflag"
+)
+
+// applyKindOrder is the order resources are applied in, kinds that others depend on first. Kinds not listed are
+// applied last, which is where custom resources belong.
+var applyKindOrder = []string{
+	"CustomResourceDefinition", "Namespace", "NetworkPolicy", "ResourceQuota", "LimitRange", "PodSecurityPolicy",
+	"PodDisruptionBudget", "ServiceAccount", "Secret", "ConfigMap", "StorageClass", "PersistentVolume",
+	"PersistentVolumeClaim", "ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding", "Service", "DaemonSet", "Pod",
+	"ReplicationController", "ReplicaSet", "Deployment", "HorizontalPodAutoscaler", "StatefulSet", "Job", "CronJob",
+	"Ingress", "APIService",
+}
+
+func runApply(args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	fs.StringVar(&kubeContext, "context", "", "kubeconfig context of the cluster to apply to")
+	fieldManager := fs.String("field-manager", "ds-to-dhall", "field manager of the server-side apply")
+	forceConflicts := fs.Bool("force-conflicts", false, "take over fields owned by other field managers")
+	dryRun := fs.Bool("dry-run", false, "only submit the resources for validation by the server, without persisting them")
+	addAuthFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of ds-to-dhall apply: [--context <ctx>] <record file>\n")
+		fmt.Fprintln(os.Stderr, "Renders a generated record, or any Dhall expression of that shape, and applies its resources with kubectl")
+		fmt.Fprintln(os.Stderr, "server-side apply, CustomResourceDefinitions and Namespaces first.")
+		fmt.Fprintln(os.Stderr, "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	file := fs.Arg(0)
+
+	log15.Info("rendering record", "file", file)
+	record, err := renderRecord(file)
+	if err != nil {
+		logFatal("failed to render record", "error", err, "file", file)
+	}
+	resources, err := renderedResources(record)
+	if err != nil {
+		logFatal("failed to collect resources", "error", err, "file", file)
+	}
+
+	applyArgs := []string{"apply", "--server-side", "--field-manager", *fieldManager, "--filename", "-"}
+	if *forceConflicts {
+		applyArgs = append(applyArgs, "--force-conflicts")
+	}
+	if *dryRun {
+		applyArgs = append(applyArgs, "--dry-run=server")
+	}
+
+	for idx, phase := range applyPhases(resources) {
+		if len(phase) == 0 {
+			continue
+		}
+		log15.Info("applying resources", "phase", idx+1, "resources", len(phase), "context", kubeContext)
+		err = kubectlApply(applyArgs, phase)
+		if err != nil {
+			logFatal("failed to apply resources", "error", err, "phase", idx+1)
+		}
+		if crds := establishedArgs(phase); len(crds) > 0 && !*dryRun {
+			// custom resources of the definitions can only be applied once they are served
+			cmd := exec.Command("kubectl", kubectlArgs(append([]string{"wait", "--for", "condition=established", "--timeout", "60s"}, crds...)...)...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			err = runCommand(cmd)
+			if err != nil {
+				logFatal("failed waiting for custom resource definitions", "error", err)
+			}
+		}
+	}
+
+	log15.Info("done", "resources", len(resources))
+}
+
+// applyPhases splits resources into those the others may depend on, CustomResourceDefinitions and Namespaces, and
+// the others, each sorted by applyKindOrder and then by path
+func applyPhases(resources []renderedResource) [][]renderedResource {
+	rank := make(map[string]int)
+	for idx, kind := range applyKindOrder {
+		rank[kind] = idx + 1
+	}
+	kindRank := func(r renderedResource) int {
+		kind, _ := r.contents["kind"].(string)
+		if rank[kind] == 0 {
+			return len(applyKindOrder) + 1
+		}
+		return rank[kind]
+	}
+
+	sorted := append([]renderedResource(nil), resources...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return kindRank(sorted[i]) < kindRank(sorted[j])
+	})
+
+	var first, rest []renderedResource
+	for _, r := range sorted {
+		switch r.contents["kind"] {
+		case "CustomResourceDefinition", "Namespace":
+			first = append(first, r)
+		default:
+			rest = append(rest, r)
+		}
+	}
+	return [][]renderedResource{first, rest}
+}
+
+// kubectlApply pipes the resources to kubectl as a multi document yaml stream
+func kubectlApply(args []string, resources []renderedResource) error {
+	documents, err := encodeDocuments(resources)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("kubectl", kubectlArgs(args...)...)
+	cmd.Stdin = bytes.NewReader(documents)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return runCommand(cmd)
+}
+
+// establishedArgs returns the kubectl resource arguments of the CustomResourceDefinitions among resources
+func establishedArgs(resources []renderedResource) []string {
+	var args []string
+	for _, r := range resources {
+		if r.contents["kind"] != "CustomResourceDefinition" {
+			continue
+		}
+		metadata, _ := r.contents["metadata"].(map[string]interface{})
+		if name, ok := metadata["name"].(string); ok {
+			args = append(args, "customresourcedefinition/"+name)
+		}
+	}
+	return args
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyPhases(t *testing.T) {
+	resource := func(kind, name string) renderedResource {
+		return renderedResource{
+			path:     []string{kind, name},
+			contents: map[string]interface{}{"kind": kind, "metadata": map[string]interface{}{"name": name}},
+		}
+	}
+	resources := []renderedResource{
+		resource("Certificate", "frontend"),
+		resource("Deployment", "frontend"),
+		resource("CustomResourceDefinition", "certificates.cert-manager.io"),
+		resource("ConfigMap", "frontend"),
+		resource("Namespace", "prod"),
+		resource("Service", "frontend"),
+	}
+
+	var kinds [][]string
+	phases := applyPhases(resources)
+	for _, phase := range phases {
+		var phaseKinds []string
+		for _, r := range phase {
+			phaseKinds = append(phaseKinds, r.contents["kind"].(string))
+		}
+		kinds = append(kinds, phaseKinds)
+	}
+	expected := [][]string{
+		{"CustomResourceDefinition", "Namespace"},
+		{"ConfigMap", "Service", "Deployment", "Certificate"},
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("expected %v, got %v", expected, kinds)
+	}
+
+	if got := establishedArgs(phases[0]); !reflect.DeepEqual(got, []string{"customresourcedefinition/certificates.cert-manager.io"}) {
+		t.Errorf("unexpected wait arguments %v", got)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditEvent is an external operation recorded in the --audit-log, a subprocess execution or a network request
+type auditEvent struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Command  []string  `json:"command,omitempty"`
+	Dir      string    `json:"dir,omitempty"`
+	Method   string    `json:"method,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Duration string    `json:"duration"`
+	// Imports are the remote imports of the expressions passed to dhall and yaml-to-dhall, not the ones those
+	// import in turn, which the subprocess fetches unrecorded
+	Imports []string `json:"imports,omitempty"`
+	// ExitStatus is the exit code of commands, -1 if they couldn't be started or were killed
+	ExitStatus *int   `json:"exitStatus,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// auditLog writes one json event per line
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var audit *auditLog
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: f}, nil
+}
+
+// record writes the event, failing to do so is fatal as the log would be incomplete
+func (l *auditLog) record(event auditEvent) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	line, err := json.Marshal(event)
+	if err == nil {
+		_, err = l.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		logFatal("failed to write audit log", "error", err, "auditLog", l.file.Name())
+	}
+}
+
+func (l *auditLog) close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// recordCommand records the execution of cmd that started at start and ended with err
+func (l *auditLog) recordCommand(cmd *exec.Cmd, start time.Time, err error) {
+	if l == nil {
+		return
+	}
+	status := 0
+	if err != nil {
+		status = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			status = exitErr.ExitCode()
+		}
+	}
+	event := auditEvent{
+		Time:       start,
+		Type:       "exec",
+		Command:    cmd.Args,
+		Dir:        cmd.Dir,
+		Duration:   time.Since(start).String(),
+		Imports:    commandImports(cmd),
+		ExitStatus: &status,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	l.record(event)
+}
+
+// remoteImportRegexp matches the remote imports of a dhall expression
+var remoteImportRegexp = regexp.MustCompile(`https?://[^\s()\[\]{},]+`)
+
+// commandImports lists the remote imports in the expressions a dhall or yaml-to-dhall cmd was given: in its
+// arguments, in the files given with --file and in its stdin if that can be read again
+func commandImports(cmd *exec.Cmd) []string {
+	name := filepath.Base(cmd.Args[0])
+	if !strings.HasPrefix(name, "dhall") && name != "yaml-to-dhall" {
+		return nil
+	}
+
+	sources := append([]string(nil), cmd.Args[1:]...)
+	for i, arg := range cmd.Args {
+		if arg != "--file" || i+1 >= len(cmd.Args) {
+			continue
+		}
+		file := cmd.Args[i+1]
+		if cmd.Dir != "" && !filepath.IsAbs(file) {
+			file = filepath.Join(cmd.Dir, file)
+		}
+		if contents, err := ioutil.ReadFile(file); err == nil {
+			sources = append(sources, string(contents))
+		}
+	}
+	if stdin, ok := cmd.Stdin.(io.ReadSeeker); ok {
+		if _, err := stdin.Seek(0, io.SeekStart); err == nil {
+			if contents, err := ioutil.ReadAll(stdin); err == nil {
+				sources = append(sources, string(contents))
+			}
+		}
+	}
+
+	var imports []string
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		for _, imp := range remoteImportRegexp.FindAllString(source, -1) {
+			if !seen[imp] {
+				seen[imp] = true
+				imports = append(imports, imp)
+			}
+		}
+	}
+	return imports
+}
+
+// runCommand runs cmd like cmd.Run, recording it in the audit log
+func runCommand(cmd *exec.Cmd) error {
+	procs.acquire()
+	defer procs.release()
+	start := time.Now()
+	err := cmd.Run()
+	audit.recordCommand(cmd, start, err)
+	return err
+}
+
+// commandOutput runs cmd like cmd.Output, recording it in the audit log. Both wait for their turn with --max-procs.
+func commandOutput(cmd *exec.Cmd) ([]byte, error) {
+	procs.acquire()
+	defer procs.release()
+	return auditedOutput(cmd)
+}
+
+// auditedOutput is commandOutput for callers that already hold their turn with --max-procs
+func auditedOutput(cmd *exec.Cmd) ([]byte, error) {
+	start := time.Now()
+	out, err := cmd.Output()
+	audit.recordCommand(cmd, start, err)
+	return out, err
+}
+
+// auditTransport records the requests made through next
+type auditTransport struct {
+	next http.RoundTripper
+}
+
+func (t auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	event := auditEvent{
+		Time:     start,
+		Type:     "http",
+		Method:   req.Method,
+		URL:      req.URL.Redacted(),
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	} else {
+		event.Status = resp.StatusCode
+	}
+	audit.record(event)
+	return resp, err
+}
+
+// enableAudit records the requests of the http client
+func enableAudit() {
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	httpClient.Transport = auditTransport{next: next}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+
+	file := filepath.Join(t.TempDir(), "audit.jsonl")
+	var err error
+	audit, err = openAuditLog(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { audit = nil }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_ = runCommand(exec.Command("sh", "-c", "exit 3"))
+	client := &http.Client{Transport: auditTransport{next: http.DefaultTransport}}
+	resp, err := client.Get(server.URL + "/schemas.dhall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	err = audit.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var events []auditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event auditEvent
+		err = json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			t.Fatalf("invalid audit log line %s: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Type != "exec" || events[0].Command[0] != "sh" || events[0].ExitStatus == nil || *events[0].ExitStatus != 3 {
+		t.Errorf("expected exec of sh exiting with 3, got %+v", events[0])
+	}
+	if events[1].Type != "http" || events[1].URL != server.URL+"/schemas.dhall" || events[1].Status != http.StatusNotFound {
+		t.Errorf("expected GET of schemas.dhall with status 404, got %+v", events[1])
+	}
+}
+
+func TestCommandImports(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "record.dhall"), []byte(
+		"let k8s = https://example.com/k8s/schemas.dhall sha256:0123 in { a = (https://example.com/a.dhall).x }"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("dhall", "hash", "--file", "record.dhall")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader("https://example.com/k8s/schemas.dhall")
+	got := commandImports(cmd)
+	expected := []string{"https://example.com/k8s/schemas.dhall", "https://example.com/a.dhall"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if got := commandImports(exec.Command("kubectl", "apply", "-f", "https://example.com/x.yaml")); got != nil {
+		t.Errorf("expected no imports for other commands, got %v", got)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	schemaHeaders  []string
+	bearerTokenEnv string
+	useNetrc       bool
+)
+
+// addAuthFlags registers the flags configuring authentication against the host serving the k8s schemas
+func addAuthFlags(fs *flag.FlagSet) {
+	fs.StringArrayVar(&schemaHeaders, "schema-header", nil,
+		"HTTP header (\"Name: value\") sent when fetching the k8s schemas, also passed to dhall via DHALL_HEADERS, after the DHALL_HEADERS of the environment")
+	fs.StringVar(&bearerTokenEnv, "schema-token-env", "", "environment variable holding a bearer token for fetching the k8s schemas")
+	fs.BoolVar(&useNetrc, "netrc", false, "use credentials from $NETRC or ~/.netrc for fetching the k8s schemas")
+}
+
+// authHeaders returns the HTTP headers to send to the host of the given URL. Credentials are only
+// handed out for the host serving the k8s schemas.
+func authHeaders(rawURL string) (map[string]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := url.Parse(mapImport(importMappings, schemaURL))
+	if err != nil {
+		return nil, err
+	}
+	if schemaPath != "" || origin(u) != origin(schema) {
+		return nil, nil
+	}
+
+	headers := make(map[string]string)
+
+	if useNetrc {
+		login, password, found, err := netrcCredentials(u.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(login+":"+password))
+		}
+	}
+
+	if bearerTokenEnv != "" {
+		token := os.Getenv(bearerTokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("environment variable %s holding the bearer token is empty", bearerTokenEnv)
+		}
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	for _, h := range schemaHeaders {
+		idx := strings.Index(h, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", h)
+		}
+		headers[strings.TrimSpace(h[:idx])] = strings.TrimSpace(h[idx+1:])
+	}
+
+	return headers, nil
+}
+
+// origin is the host:port form dhall uses to key DHALL_HEADERS
+func origin(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return u.Hostname() + ":" + port
+}
+
+// dhallHeadersEnv renders the schema host headers as a DHALL_HEADERS environment entry, empty if there are none.
+// They are appended to the DHALL_HEADERS of the environment, if any, which keeps the headers it sends to other hosts.
+func dhallHeadersEnv() (string, error) {
+	if schemaPath != "" {
+		return "", nil
+	}
+	schema := mapImport(importMappings, schemaURL)
+	headers, err := authHeaders(schema)
+	if err != nil || len(headers) == 0 {
+		return "", err
+	}
+	u, err := url.Parse(schema)
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var entries []string
+	for _, name := range names {
+		entries = append(entries, fmt.Sprintf("{ mapKey = %s, mapValue = %s }", dhallText(name), dhallText(headers[name])))
+	}
+
+	expr := fmt.Sprintf("toMap { %s = [ %s ] }", dhallLabel(origin(u)), strings.Join(entries, ", "))
+	if existing := strings.TrimSpace(os.Getenv("DHALL_HEADERS")); existing != "" {
+		expr = fmt.Sprintf("(%s) # %s", existing, expr)
+	}
+	return "DHALL_HEADERS=" + expr, nil
+}
+
+// subprocessHeaders is dhallHeadersEnv, computed once per run rather than reading netrc for every subprocess
+var subprocessHeaders = struct {
+	once  sync.Once
+	entry string
+	err   error
+}{}
+
+// dhallHeadersEntry returns the DHALL_HEADERS entry of the subprocesses, computing it on first use
+func dhallHeadersEntry() (string, error) {
+	subprocessHeaders.once.Do(func() {
+		subprocessHeaders.entry, subprocessHeaders.err = dhallHeadersEnv()
+	})
+	return subprocessHeaders.entry, subprocessHeaders.err
+}
+
+// subprocessEnv is the environment dhall and yaml-to-dhall run with
+func subprocessEnv() []string {
+	env := os.Environ()
+	headers, err := dhallHeadersEntry()
+	if err != nil {
+		logFatal("failed to compose DHALL_HEADERS", "error", err)
+	}
+	if headers != "" {
+		// the entry holds the DHALL_HEADERS of the environment, it replaces it
+		env = append(withoutEnv(env, "DHALL_HEADERS"), headers)
+	}
+	if offline {
+		env = offlineEnv(env)
+	}
+	return env
+}
+
+// withoutEnv returns env without the entries of the variable name
+func withoutEnv(env []string, name string) []string {
+	var filtered []string
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, name+"=") {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+// netrcCredentials looks up the login and password for host in the netrc file
+func netrcCredentials(host string) (string, string, bool, error) {
+	file := os.Getenv("NETRC")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false, err
+		}
+		file = filepath.Join(home, ".netrc")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", false, nil
+		}
+		return "", "", false, err
+	}
+	defer f.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		tokens = append(tokens, strings.Fields(scanner.Text())...)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", false, err
+	}
+
+	return parseNetrc(tokens, host)
+}
+
+func parseNetrc(tokens []string, host string) (string, string, bool, error) {
+	var login, password string
+	matched, found := false, false
+	for idx := 0; idx < len(tokens); idx++ {
+		switch tokens[idx] {
+		case "machine", "default":
+			if matched {
+				return login, password, true, nil
+			}
+			if tokens[idx] == "default" {
+				matched = true
+			} else if idx+1 < len(tokens) {
+				idx++
+				matched = tokens[idx] == host
+			}
+		case "login":
+			if idx+1 < len(tokens) {
+				idx++
+				if matched {
+					login, found = tokens[idx], true
+				}
+			}
+		case "password":
+			if idx+1 < len(tokens) {
+				idx++
+				if matched {
+					password, found = tokens[idx], true
+				}
+			}
+		}
+	}
+	return login, password, matched && found, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	flag "github.com/spf13/pflag"
+)
+
+// benchPercentiles are the percentiles bench reports for the run and each phase
+var benchPercentiles = []float64{50, 90, 99}
+
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := fs.IntP("runs", "n", 5, "number of times the conversion is run")
+	syntheticComponents := fs.Int("synthetic-components", 0, "convert a generated tree with this many components as well")
+	syntheticResources := fs.Int("synthetic-resources", 10, "number of resources of each generated component")
+	var convertArgs []string
+	fs.StringArrayVar(&convertArgs, "arg", nil, "flag passed on to the conversion, eg --arg=--no-cache (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of ds-to-dhall bench: [--runs <n>] [--synthetic-components <n>] [--arg <flag>...] [<path>...]\n")
+		fmt.Fprintln(os.Stderr, "Runs the conversion of the inputs n times, into a temporary directory, and prints percentiles of the duration")
+		fmt.Fprintln(os.Stderr, "of the runs and of their phases. Runs after the first hit a conversion cache in the temporary directory unless --arg=--no-cache is given.")
+		fmt.Fprintln(os.Stderr, "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *runs < 1 || *syntheticComponents < 0 || *syntheticResources < 1 || (fs.NArg() == 0 && *syntheticComponents == 0) {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	reports, err := benchmark(fs.Args(), *runs, *syntheticComponents, *syntheticResources, convertArgs)
+	if err != nil {
+		logFatal("failed to benchmark conversion", "error", err)
+	}
+	fmt.Print(benchSummary(reports))
+}
+
+// benchmark runs this ds-to-dhall on the inputs, and a synthetic tree if components is set, and returns the reports
+// of the runs
+func benchmark(inputs []string, runs, components, resources int, args []string) ([]runReport, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "ds-to-dhall-bench")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if components > 0 {
+		synthetic := filepath.Join(dir, "synthetic")
+		log15.Info("generating synthetic tree", "components", components, "resources", resources)
+		err = writeSyntheticTree(synthetic, components, resources)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate synthetic tree: %v", err)
+		}
+		inputs = append(inputs[:len(inputs):len(inputs)], synthetic)
+	}
+
+	report := filepath.Join(dir, "report.json")
+	cmdArgs := []string{"--output", filepath.Join(dir, "record.dhall"), "--report", report}
+	if !passesFlag(args, "cache-dir") && !passesFlag(args, "no-cache") {
+		// the first run starts from an empty cache instead of the one of earlier conversions
+		cmdArgs = append(cmdArgs, "--cache-dir", filepath.Join(dir, "cache"))
+	}
+	cmdArgs = append(cmdArgs, args...)
+	cmdArgs = append(cmdArgs, inputs...)
+
+	var reports []runReport
+	for run := 1; run <= runs; run++ {
+		cmd := exec.Command(executable, cmdArgs...)
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		err = runCommand(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("run %d failed: %v\n%s", run, err, output.String())
+		}
+
+		contents, err := ioutil.ReadFile(report)
+		if err != nil {
+			return nil, err
+		}
+		var r runReport
+		err = json.Unmarshal(contents, &r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse report of run %d: %v", run, err)
+		}
+		log15.Info("benchmark run", "run", run, "duration", seconds(r.Duration))
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+// passesFlag reports whether args set the long flag name, as --name, --name=value or --name value
+func passesFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == "--"+name || strings.HasPrefix(arg, "--"+name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// benchSummary tabulates the percentiles of the run durations and of each phase
+func benchSummary(reports []runReport) string {
+	b := bytes.Buffer{}
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprint(w, "\t")
+	for _, p := range benchPercentiles {
+		fmt.Fprintf(w, "p%g\t", p)
+	}
+	fmt.Fprintln(w, "max\t")
+
+	row := func(name string, value func(r runReport) float64) {
+		var values []float64
+		for _, r := range reports {
+			values = append(values, value(r))
+		}
+		sort.Float64s(values)
+
+		fmt.Fprintf(w, "%s\t", name)
+		for _, p := range benchPercentiles {
+			fmt.Fprintf(w, "%s\t", seconds(percentile(values, p)))
+		}
+		fmt.Fprintf(w, "%s\t\n", seconds(values[len(values)-1]))
+	}
+	row("duration", func(r runReport) float64 { return r.Duration })
+	for _, phase := range phases {
+		phase := phase
+		row(phase, func(r runReport) float64 { return r.Phases[phase] })
+	}
+
+	_ = w.Flush()
+	return b.String()
+}
+
+// percentile returns the nearest rank percentile p of the sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
+
+// syntheticTemplates are the manifests of a synthetic component, taking the resource name, cycled through to generate
+// its resources
+var syntheticTemplates = []string{`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %[1]s
+  labels:
+    app: %[1]s
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: %[1]s
+  template:
+    metadata:
+      labels:
+        app: %[1]s
+    spec:
+      containers:
+        - name: %[1]s
+          image: index.docker.io/library/nginx:1.19
+          ports:
+            - name: http
+              containerPort: 8080
+          resources:
+            requests:
+              cpu: 100m
+              memory: 128Mi
+`, `apiVersion: v1
+kind: Service
+metadata:
+  name: %[1]s
+  labels:
+    app: %[1]s
+spec:
+  selector:
+    app: %[1]s
+  ports:
+    - name: http
+      port: 80
+      targetPort: http
+`, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: %[1]s
+data:
+  config.yaml: |
+    name: %[1]s
+    replicas: 1
+`}
+
+// writeSyntheticTree writes components directories of resources manifests each to dir
+func writeSyntheticTree(dir string, components, resources int) error {
+	for c := 0; c < components; c++ {
+		component := fmt.Sprintf("component-%03d", c)
+		err := os.MkdirAll(filepath.Join(dir, component), 0755)
+		if err != nil {
+			return err
+		}
+		for r := 0; r < resources; r++ {
+			name := fmt.Sprintf("%s-%03d", component, r)
+			manifest := fmt.Sprintf(syntheticTemplates[r%len(syntheticTemplates)], name)
+			err = ioutil.WriteFile(filepath.Join(dir, component, name+".yaml"), []byte(manifest), 0644)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for p, expected := range map[float64]float64{50: 5, 90: 9, 99: 10, 0: 1} {
+		if got := percentile(values, p); got != expected {
+			t.Errorf("p%g: expected %g, got %g", p, expected, got)
+		}
+	}
+	if got := percentile([]float64{3}, 50); got != 3 {
+		t.Errorf("expected the only value, got %g", got)
+	}
+}
+
+func TestBenchSummary(t *testing.T) {
+	var reports []runReport
+	for _, duration := range []float64{3, 1, 2} {
+		reports = append(reports, runReport{Duration: duration, Phases: map[string]float64{"yamlToDhall": duration / 2}})
+	}
+	summary := benchSummary(reports)
+
+	lines := strings.Split(strings.TrimRight(summary, "\n"), "\n")
+	if len(lines) != len(phases)+2 {
+		t.Fatalf("expected a header, the duration and every phase, got\n%s", summary)
+	}
+	if fields := strings.Fields(lines[0]); strings.Join(fields, " ") != "p50 p90 p99 max" {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "duration 2s 3s 3s 3s" {
+		t.Errorf("unexpected duration row %q", lines[1])
+	}
+	for _, line := range lines[2:] {
+		fields := strings.Fields(line)
+		if fields[0] == "yamlToDhall" && strings.Join(fields[1:], " ") != "1s 1.5s 1.5s 1.5s" {
+			t.Errorf("unexpected yamlToDhall row %q", line)
+		}
+	}
+}
+
+func TestWriteSyntheticTree(t *testing.T) {
+	dir := t.TempDir()
+	err := writeSyntheticTree(dir, 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := make(map[string]int)
+	components := make(map[string]bool)
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		resources, err := loadResources(dir, file)
+		if err != nil {
+			t.Fatalf("failed to load %s: %v", file, err)
+		}
+		for _, r := range resources {
+			kinds[r.Kind]++
+			components[r.Component] = true
+		}
+	}
+	if len(components) != 3 || kinds["Deployment"] != 6 || kinds["Service"] != 3 || kinds["ConfigMap"] != 3 {
+		t.Errorf("expected 3 components of 2 deployments, a service and a config map, got %v in %v", kinds, components)
+	}
+}
+
+func TestPassesFlag(t *testing.T) {
+	fixtures := []struct {
+		args     []string
+		expected bool
+	}{
+		{args: []string{"--cache-dir", "/tmp/cache"}, expected: true},
+		{args: []string{"--no-cache", "--cache-dir=/tmp/cache"}, expected: true},
+		{args: []string{"--cache-directory=/tmp/cache", "cache-dir"}, expected: false},
+		{args: nil, expected: false},
+	}
+
+	for _, fx := range fixtures {
+		got := passesFlag(fx.args, "cache-dir")
+		if got != fx.expected {
+			t.Errorf("%v: expected %v, got %v", fx.args, fx.expected, got)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// quantitySuffixes are the multipliers of Kubernetes quantity suffixes
+var quantitySuffixes = map[string]*big.Rat{
+	"m":  big.NewRat(1, 1000),
+	"":   big.NewRat(1, 1),
+	"k":  big.NewRat(1000, 1),
+	"M":  big.NewRat(1000*1000, 1),
+	"G":  big.NewRat(1000*1000*1000, 1),
+	"T":  big.NewRat(1000*1000*1000*1000, 1),
+	"P":  big.NewRat(1000*1000*1000*1000*1000, 1),
+	"E":  big.NewRat(1000*1000*1000*1000*1000*1000, 1),
+	"Ki": big.NewRat(1<<10, 1),
+	"Mi": big.NewRat(1<<20, 1),
+	"Gi": big.NewRat(1<<30, 1),
+	"Ti": big.NewRat(1<<40, 1),
+	"Pi": big.NewRat(1<<50, 1),
+	"Ei": big.NewRat(1<<60, 1),
+}
+
+// parseQuantity parses a Kubernetes quantity like 500m, 1.5 or 2Gi
+func parseQuantity(v interface{}) (*big.Rat, error) {
+	s, ok := quantityString(v)
+	if !ok {
+		s, ok = v.(string)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %v", v)
+	}
+
+	number := strings.TrimRight(s, "kKmMGTPEi")
+	suffix := s[len(number):]
+	multiplier, ok := quantitySuffixes[suffix]
+	if !ok || number == "" {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	// the exponent form of decimal numbers, eg 1e3, is understood by SetString
+	q, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	return q.Mul(q, multiplier), nil
+}
+
+// formatQuantity renders a quantity of the resource: sizes with the largest binary suffix that is exact and
+// other resources like cpu in whole units or milli units
+func formatQuantity(resource string, q *big.Rat) string {
+	if isSizeResource(resource) && q.IsInt() && q.Sign() > 0 {
+		for _, suffix := range []string{"Ei", "Pi", "Ti", "Gi", "Mi", "Ki"} {
+			scaled := new(big.Rat).Quo(q, quantitySuffixes[suffix])
+			if scaled.IsInt() {
+				return scaled.Num().String() + suffix
+			}
+		}
+	}
+	if q.IsInt() {
+		return q.Num().String()
+	}
+	milli := new(big.Rat).Mul(q, big.NewRat(1000, 1))
+	if milli.IsInt() {
+		return milli.Num().String() + "m"
+	}
+	return q.FloatString(3)
+}
+
+func isSizeResource(resource string) bool {
+	return resource == "memory" || resource == "storage" || resource == "ephemeral-storage" || strings.HasPrefix(resource, "hugepages-")
+}
+
+// resourceAmounts sums quantities by resource name
+type resourceAmounts map[string]*big.Rat
+
+func (a resourceAmounts) add(b resourceAmounts, times int64) {
+	for resource, q := range b {
+		if a[resource] == nil {
+			a[resource] = new(big.Rat)
+		}
+		a[resource].Add(a[resource], new(big.Rat).Mul(q, big.NewRat(times, 1)))
+	}
+}
+
+// max raises the amounts of a to the ones of b
+func (a resourceAmounts) max(b resourceAmounts) {
+	for resource, q := range b {
+		if a[resource] == nil || a[resource].Cmp(q) < 0 {
+			a[resource] = new(big.Rat).Set(q)
+		}
+	}
+}
+
+func (a resourceAmounts) rendered() map[string]string {
+	if len(a) == 0 {
+		return nil
+	}
+	m := make(map[string]string)
+	for resource, q := range a {
+		m[resource] = formatQuantity(resource, q)
+	}
+	return m
+}
+
+// capacity holds the requests and limits of a set of pods
+type capacity struct {
+	requests, limits resourceAmounts
+}
+
+func newCapacity() *capacity {
+	return &capacity{requests: make(resourceAmounts), limits: make(resourceAmounts)}
+}
+
+func (c *capacity) add(b *capacity, times int64) {
+	c.requests.add(b.requests, times)
+	c.limits.add(b.limits, times)
+}
+
+// capacityEntry is the rendered capacity of a component or of all of them
+type capacityEntry struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+	// PerNode are the requests and limits of DaemonSets, which run a pod on every node
+	PerNode *capacityEntry `yaml:"perNode,omitempty"`
+}
+
+type capacitySummary struct {
+	Components map[string]*capacityEntry `yaml:"components"`
+	Total      *capacityEntry            `yaml:"total"`
+}
+
+// podCapacity is the effective requests and limits of a pod: the sum over its containers, or the largest of an
+// init container if that is higher, as the scheduler counts them
+func podCapacity(r *Resource) (*capacity, error) {
+	spec, ok := podSpecPath(r.Kind)
+	if !ok {
+		return nil, nil
+	}
+
+	pod := newCapacity()
+	init := newCapacity()
+	for _, section := range []string{"containers", "initContainers"} {
+		for _, c := range lookupPath(r.Contents, append(spec, pathElem{key: section}, pathElem{wildcard: true})) {
+			container, _ := c.(map[string]interface{})
+			resources, _ := container["resources"].(map[string]interface{})
+			containerCapacity := newCapacity()
+			for field, amounts := range map[string]resourceAmounts{"requests": containerCapacity.requests, "limits": containerCapacity.limits} {
+				quantities, _ := resources[field].(map[string]interface{})
+				for resource, v := range quantities {
+					q, err := parseQuantity(v)
+					if err != nil {
+						return nil, fmt.Errorf("%s.%s.%s: %v", section, field, resource, err)
+					}
+					amounts[resource] = q
+				}
+			}
+			if section == "containers" {
+				pod.add(containerCapacity, 1)
+			} else {
+				init.requests.max(containerCapacity.requests)
+				init.limits.max(containerCapacity.limits)
+			}
+		}
+	}
+	pod.requests.max(init.requests)
+	pod.limits.max(init.limits)
+	return pod, nil
+}
+
+// podReplicas is the number of pods a workload runs, DaemonSets run one per node and are reported as 0
+func podReplicas(r *Resource) int64 {
+	var path string
+	switch r.Kind {
+	case "DaemonSet":
+		return 0
+	case "Deployment", "StatefulSet", "ReplicaSet", "ReplicationController":
+		path = ".spec.replicas"
+	case "Job":
+		path = ".spec.parallelism"
+	case "CronJob":
+		path = ".spec.jobTemplate.spec.parallelism"
+	default:
+		return 1
+	}
+	p, err := parseFieldPath(path)
+	if err != nil {
+		return 1
+	}
+	if values := lookupPath(r.Contents, p); len(values) == 1 {
+		if n, ok := values[0].(int); ok {
+			return int64(n)
+		}
+	}
+	return 1
+}
+
+// buildCapacitySummary totals the requests and limits of the workloads per component and overall
+func buildCapacitySummary(rs *ResourceSet) (*capacitySummary, error) {
+	components := make(map[string]*capacity)
+	perNode := make(map[string]*capacity)
+	total, totalPerNode := newCapacity(), newCapacity()
+
+	for _, r := range sortedResources(rs) {
+		pod, err := podCapacity(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", r.Source, err)
+		}
+		if pod == nil {
+			continue
+		}
+
+		key := componentKey(r.Component)
+		if components[key] == nil {
+			components[key], perNode[key] = newCapacity(), newCapacity()
+		}
+		if r.Kind == "DaemonSet" {
+			perNode[key].add(pod, 1)
+			totalPerNode.add(pod, 1)
+			continue
+		}
+		replicas := podReplicas(r)
+		components[key].add(pod, replicas)
+		total.add(pod, replicas)
+	}
+
+	summary := &capacitySummary{Components: make(map[string]*capacityEntry)}
+	for key, c := range components {
+		summary.Components[key] = capacityEntryOf(c, perNode[key])
+	}
+	summary.Total = capacityEntryOf(total, totalPerNode)
+	return summary, nil
+}
+
+func capacityEntryOf(c, perNode *capacity) *capacityEntry {
+	entry := &capacityEntry{Requests: c.requests.rendered(), Limits: c.limits.rendered()}
+	if len(perNode.requests)+len(perNode.limits) > 0 {
+		entry.PerNode = &capacityEntry{Requests: perNode.requests.rendered(), Limits: perNode.limits.rendered()}
+	}
+	return entry
+}
+
+func writeCapacitySummary(rs *ResourceSet, file string) error {
+	summary, err := buildCapacitySummary(rs)
+	if err != nil {
+		return err
+	}
+	contents, err := yaml.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, 0644)
+}
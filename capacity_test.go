@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseFormatQuantity(t *testing.T) {
+	for _, tc := range []struct {
+		resource string
+		value    interface{}
+		expected string
+	}{
+		{"cpu", "500m", "500m"},
+		{"cpu", 2, "2"},
+		{"cpu", 0.25, "250m"},
+		{"memory", "1Gi", "1Gi"},
+		{"memory", "1536Mi", "1536Mi"},
+		{"memory", "1G", "1000000000"},
+		{"memory", "1e3", "1000"},
+		{"memory", "2048Ki", "2Mi"},
+	} {
+		q, err := parseQuantity(tc.value)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %v: %v", tc.value, err)
+		}
+		if got := formatQuantity(tc.resource, q); got != tc.expected {
+			t.Errorf("expected %s for %v, got %s", tc.expected, tc.value, got)
+		}
+	}
+
+	if _, err := parseQuantity("1mi"); err == nil {
+		t.Errorf("expected error parsing invalid quantity")
+	}
+}
+
+func TestBuildCapacitySummary(t *testing.T) {
+	var resources []*Resource
+	for _, manifest := range []string{`
+kind: Deployment
+metadata: {name: frontend}
+spec:
+  replicas: 2
+  template:
+    spec:
+      initContainers:
+        - name: migrate
+          resources: {requests: {cpu: "3", memory: 1Gi}}
+      containers:
+        - name: frontend
+          resources: {requests: {cpu: 500m, memory: 1Gi}, limits: {cpu: "2", memory: 2Gi}}
+        - name: jaeger
+          resources: {requests: {cpu: 100m, memory: 512Mi}}
+`, `
+kind: DaemonSet
+metadata: {name: node-exporter}
+spec:
+  template:
+    spec:
+      containers:
+        - name: node-exporter
+          resources: {requests: {cpu: 100m}}
+`} {
+		var contents map[string]interface{}
+		err := yaml.Unmarshal([]byte(manifest), &contents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resources = append(resources, &Resource{Component: "frontend", Kind: contents["kind"].(string),
+			Name: contents["metadata"].(map[string]interface{})["name"].(string), Contents: contents})
+	}
+
+	summary, err := buildCapacitySummary(&ResourceSet{Components: map[string][]*Resource{"frontend": resources}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the init container requests more cpu than the containers together
+	expected := &capacityEntry{
+		Requests: map[string]string{"cpu": "6", "memory": "3Gi"},
+		Limits:   map[string]string{"cpu": "4", "memory": "4Gi"},
+		PerNode:  &capacityEntry{Requests: map[string]string{"cpu": "100m"}},
+	}
+	if got := summary.Components["Frontend"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	if !reflect.DeepEqual(summary.Total, expected) {
+		t.Errorf("expected total %+v, got %+v", expected, summary.Total)
+	}
+}
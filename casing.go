@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/inconshreveable/log15"
+)
+
+// casers maps the --component-case strategies to their implementation
+var casers = map[string]func(string) string{
+	"title":    titleCase,
+	"pascal":   pascalCase,
+	"camel":    camelCase,
+	"kebab":    kebabCase,
+	"preserve": func(s string) string { return s },
+}
+
+func caseStrategies() []string {
+	var names []string
+	for name := range casers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateComponentCase(strategy string) error {
+	if _, ok := casers[strategy]; !ok {
+		return fmt.Errorf("unknown component case %q, expected one of %s", strategy, strings.Join(caseStrategies(), "|"))
+	}
+	return nil
+}
+
+// validateCollisionSuffix checks that a --collision-suffix formats the counter with a single %d verb, and no other
+func validateCollisionSuffix(suffix string) error {
+	if suffix == "" {
+		return nil
+	}
+	rest := strings.Replace(strings.Replace(suffix, "%%", "", -1), "%d", "", 1)
+	if !strings.Contains(suffix, "%d") || strings.Contains(rest, "%") {
+		return fmt.Errorf("invalid --collision-suffix %q, expected a single %%d verb receiving the counter, eg -%%d", suffix)
+	}
+	return nil
+}
+
+// componentKey is the key a component is placed under in the generated type, record and components output
+func componentKey(component string) string {
+	return casers[componentCase](component)
+}
+
+// resolveComponentCollisions detects distinct components that end up with the same key after casing
+// (eg frontend and Frontend). Without a suffix all collisions are reported as an error, otherwise every
+// colliding component but the first is renamed by appending the suffix formatted with a counter.
+func resolveComponentCollisions(rs *ResourceSet, suffix string) error {
+	byKey := make(map[string][]string)
+	for _, component := range sortedComponents(rs) {
+		key := componentKey(component)
+		byKey[key] = append(byKey[key], component)
+	}
+
+	var keys []string
+	for key, components := range byKey {
+		if len(components) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var collisions []string
+	for _, key := range keys {
+		components := byKey[key]
+		if suffix == "" {
+			collisions = append(collisions, fmt.Sprintf("%s <- [%s]", key, strings.Join(components, ", ")))
+			continue
+		}
+
+		counter := 2
+		for _, component := range components[1:] {
+			renamed := component + fmt.Sprintf(suffix, counter)
+			for len(byKey[componentKey(renamed)]) > 0 {
+				counter++
+				renamed = component + fmt.Sprintf(suffix, counter)
+			}
+			counter++
+			byKey[componentKey(renamed)] = []string{renamed}
+
+			log15.Warn("renaming colliding component", "component", component, "renamed", renamed, "key", key)
+			resources := rs.Components[component]
+			for _, r := range resources {
+				r.Component = renamed
+			}
+			rs.Components[renamed] = resources
+			delete(rs.Components, component)
+		}
+	}
+
+	if len(collisions) > 0 {
+		return fmt.Errorf("component keys collide after applying %s casing: %s", componentCase, strings.Join(collisions, "; "))
+	}
+	return nil
+}
+
+// splitWords splits s into words at every non alphanumeric character and at lower to upper case transitions
+func splitWords(s string) []string {
+	var words []string
+	var word []rune
+
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+
+	for _, c := range s {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(c) && len(word) > 0 && !unicode.IsUpper(word[len(word)-1]) {
+			flush()
+		}
+		word = append(word, c)
+	}
+	flush()
+
+	return words
+}
+
+func upperFirst(s string) string {
+	rs := []rune(s)
+	if len(rs) == 0 {
+		return s
+	}
+	rs[0] = unicode.ToUpper(rs[0])
+	return string(rs)
+}
+
+func lowerFirst(s string) string {
+	rs := []rune(s)
+	if len(rs) == 0 {
+		return s
+	}
+	rs[0] = unicode.ToLower(rs[0])
+	return string(rs)
+}
+
+// titleCase title cases the first letter of every word and keeps the separators (indexed-search -> Indexed-Search),
+// with the word boundaries of the deprecated strings.Title that component keys were always cased with
+func titleCase(s string) string {
+	var b strings.Builder
+	prev := ' '
+	for _, c := range s {
+		if isTitleSeparator(prev) {
+			b.WriteRune(unicode.ToTitle(c))
+		} else {
+			b.WriteRune(c)
+		}
+		prev = c
+	}
+	return b.String()
+}
+
+// isTitleSeparator reports whether c separates words for titleCase: ASCII characters other than letters, digits
+// and underscores, and other spaces
+func isTitleSeparator(c rune) bool {
+	if c <= unicode.MaxASCII {
+		return !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_')
+	}
+	if unicode.IsLetter(c) || unicode.IsDigit(c) {
+		return false
+	}
+	return unicode.IsSpace(c)
+}
+
+// pascalCase joins the upper cased words without separators (indexed-search -> IndexedSearch)
+func pascalCase(s string) string {
+	words := splitWords(s)
+	for idx, w := range words {
+		words[idx] = upperFirst(w)
+	}
+	return strings.Join(words, "")
+}
+
+// camelCase is pascalCase with a lower case first letter (indexed-search -> indexedSearch)
+func camelCase(s string) string {
+	return lowerFirst(pascalCase(s))
+}
+
+// kebabCase joins the lower cased words with dashes (IndexedSearch -> indexed-search)
+func kebabCase(s string) string {
+	words := splitWords(s)
+	for idx, w := range words {
+		words[idx] = strings.ToLower(w)
+	}
+	return strings.Join(words, "-")
+}
@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestCasers(t *testing.T) {
+	fixtures := []struct {
+		strategy string
+		input    string
+		expected string
+	}{
+		{strategy: "title", input: "indexed-search", expected: "Indexed-Search"},
+		{strategy: "title", input: "frontend", expected: "Frontend"},
+		{strategy: "title", input: "k8s_2fa.svc", expected: "K8s_2fa.Svc"},
+		{strategy: "pascal", input: "indexed-search", expected: "IndexedSearch"},
+		{strategy: "pascal", input: "precise-code-intel/worker", expected: "PreciseCodeIntelWorker"},
+		{strategy: "pascal", input: "2fa-service", expected: "2faService"},
+		{strategy: "pascal", input: "myComponent", expected: "MyComponent"},
+		{strategy: "camel", input: "indexed-search", expected: "indexedSearch"},
+		{strategy: "camel", input: "Frontend", expected: "frontend"},
+		{strategy: "kebab", input: "IndexedSearch", expected: "indexed-search"},
+		{strategy: "kebab", input: "cert_manager.io", expected: "cert-manager-io"},
+		{strategy: "preserve", input: "indexed-search", expected: "indexed-search"},
+	}
+
+	for _, fx := range fixtures {
+		got := casers[fx.strategy](fx.input)
+		if got != fx.expected {
+			t.Errorf("expected %s, got %s casing %s with %s", fx.expected, got, fx.input, fx.strategy)
+		}
+	}
+}
+
+func TestTitleCaseMatchesStringsTitle(t *testing.T) {
+	// the outputs of strings.Title, which the keys of existing records were cased with
+	fixtures := map[string]string{
+		"k8s_foo":                   "K8s_foo",
+		"cert_manager.io":           "Cert_manager.Io",
+		"foo__bar-baz":              "Foo__bar-Baz",
+		"precise-code-intel/worker": "Precise-Code-Intel/Worker",
+		"my component":              "My Component",
+		"2fa-service":               "2fa-Service",
+		"élan-über":                 "Élan-Über",
+		"a·b":                       "A·b",
+		"x\u00a0y":                  "X\u00a0Y",
+		"ǆemal-ǆ":                   "ǅemal-ǅ",
+	}
+
+	for input, expected := range fixtures {
+		if got := titleCase(input); got != expected {
+			t.Errorf("expected %q, got %q title casing %q", expected, got, input)
+		}
+	}
+}
+
+func TestResolveComponentCollisions(t *testing.T) {
+	newSet := func() *ResourceSet {
+		return &ResourceSet{Components: map[string][]*Resource{
+			"frontend":  {{Component: "frontend", Kind: "Service", Name: "a"}},
+			"Frontend":  {{Component: "Frontend", Kind: "Service", Name: "b"}},
+			"gitserver": {{Component: "gitserver", Kind: "Service", Name: "c"}},
+		}}
+	}
+
+	err := resolveComponentCollisions(newSet(), "")
+	if err == nil {
+		t.Errorf("expected collision between frontend and Frontend to be reported")
+	}
+
+	rs := newSet()
+	err = resolveComponentCollisions(rs, "-%d")
+	if err != nil {
+		t.Fatalf("unexpected error disambiguating components: %v", err)
+	}
+	if len(rs.Components) != 3 {
+		t.Fatalf("expected 3 components, got %d", len(rs.Components))
+	}
+	renamed, ok := rs.Components["frontend-2"]
+	if !ok {
+		t.Fatalf("expected frontend to be renamed to frontend-2, got %v", rs.Components)
+	}
+	if renamed[0].Component != "frontend-2" {
+		t.Errorf("expected resource component to be updated, got %s", renamed[0].Component)
+	}
+}
+
+func TestValidateCollisionSuffix(t *testing.T) {
+	for _, suffix := range []string{"", "-%d", "_%d_dup", "%%%d"} {
+		if err := validateCollisionSuffix(suffix); err != nil {
+			t.Errorf("%q: unexpected error %v", suffix, err)
+		}
+	}
+	for _, suffix := range []string{"-dup", "-%s", "-%d-%d", "-%d%v"} {
+		if err := validateCollisionSuffix(suffix); err == nil {
+			t.Errorf("%q: expected an error", suffix)
+		}
+	}
+}
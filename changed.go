@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+)
+
+// gitFiles runs a git command in dir listing file names separated by NUL
+func gitFiles(dir string, args ...string) ([]string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = os.Stderr
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v", strings.Join(args, " "), err)
+	}
+
+	var files []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// changedFiles returns the resolved paths of the files in the git work tree of dir that differ from ref,
+// including untracked files
+func changedFiles(dir, ref string) (map[string]bool, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	top, err := gitFiles(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	if len(top) != 1 {
+		return nil, fmt.Errorf("%s is not in a git work tree", dir)
+	}
+	toplevel := strings.TrimSpace(top[0])
+
+	modified, err := gitFiles(toplevel, "diff", "--name-only", "-z", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitFiles(toplevel, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	for _, f := range append(modified, untracked...) {
+		changed[resolvedPath(filepath.Join(toplevel, filepath.FromSlash(f)))] = true
+	}
+	return changed, nil
+}
+
+// resolvedPath evaluates the symlinks in path, falling back to path for files that don't exist
+func resolvedPath(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return resolved
+}
+
+// keepChangedResources removes the resources not loaded from a changed file. It runs after the component and
+// record keys were assigned over all resources so the keys of the remaining ones don't depend on what changed.
+func keepChangedResources(rs *ResourceSet, changed map[string]bool) {
+	kept := 0
+	for component, resources := range rs.Components {
+		var keep []*Resource
+		for _, r := range resources {
+			if changed[resolvedPath(r.Source)] {
+				keep = append(keep, r)
+			}
+		}
+		kept += len(keep)
+		if len(keep) == 0 {
+			delete(rs.Components, component)
+			continue
+		}
+		rs.Components[component] = keep
+	}
+	log15.Info("kept resources of changed files", "resources", kept, "files", len(changed))
+}
+
+// changedOutputs points the output file flags at the files the outputs of a --changed-since run are written to,
+// siblings of the configured ones with a .changed infix like record.changed.dhall, so that the outputs of a full
+// run aren't replaced by partial ones. Relative imports are the same for siblings.
+func changedOutputs() {
+	for _, file := range outputFileFlags {
+		if *file != "" {
+			*file = changedOutput(*file)
+		}
+	}
+}
+
+func changedOutput(file string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + ".changed" + ext
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, contents string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	write("unchanged.yaml", "kind: Service\n")
+	write("modified.yaml", "kind: Service\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	write("modified.yaml", "kind: Deployment\n")
+	write("added.yaml", "kind: Service\n")
+
+	changed, err := changedFiles(dir, "HEAD")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, expected := range map[string]bool{"unchanged.yaml": false, "modified.yaml": true, "added.yaml": true} {
+		if changed[resolvedPath(filepath.Join(dir, name))] != expected {
+			t.Errorf("expected changed %t for %s, got %v", expected, name, changed)
+		}
+	}
+
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"a": {{Source: filepath.Join(dir, "unchanged.yaml")}},
+		"b": {{Source: filepath.Join(dir, "unchanged.yaml")}, {Source: filepath.Join(dir, "modified.yaml")}},
+	}}
+	keepChangedResources(rs, changed)
+	if len(rs.Components) != 1 || len(rs.Components["b"]) != 1 {
+		t.Errorf("expected only the modified resource to be kept, got %v", rs.Components)
+	}
+}
+
+func TestChangedOutput(t *testing.T) {
+	fixtures := []struct {
+		file     string
+		expected string
+	}{
+		{file: "record.dhall", expected: "record.changed.dhall"},
+		{file: filepath.Join("deploy", "components.yaml"), expected: filepath.Join("deploy", "components.changed.yaml")},
+		{file: "SHA256SUMS", expected: "SHA256SUMS.changed"},
+	}
+
+	for _, fx := range fixtures {
+		got := changedOutput(fx.file)
+		if got != fx.expected {
+			t.Errorf("expected %s, got %s", fx.expected, got)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// staleOutputs compares the staged outputs with the configured files, returning the configured files that are
+// missing or differ. Dhall files differing only in formatting, as told by their semantic hash, are up to date.
+func staleOutputs() ([]string, error) {
+	staged := make(map[string]bool)
+	for file := range stagedOutputs {
+		staged[file] = true
+	}
+	for file := range outputFiles {
+		staged[file] = true
+	}
+
+	var stale []string
+	for file := range staged {
+		configured := configuredOutput(file)
+		if configured == file {
+			continue
+		}
+		generated, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			// not generated by this run, like the cbor encoding without --output-encoding cbor
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		existing, err := ioutil.ReadFile(configured)
+		if os.IsNotExist(err) {
+			stale = append(stale, fmt.Sprintf("%s (missing)", configured))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(generated, existing) {
+			continue
+		}
+		if strings.HasSuffix(configured, ".dhall") {
+			same, err := sameDhallHash(file, configured)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				continue
+			}
+		}
+		stale = append(stale, configured)
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// sameDhallHash reports whether two dhall files evaluate to the same expression
+func sameDhallHash(a, b string) (bool, error) {
+	var hashes []string
+	for _, file := range []string{a, b} {
+		cmd := dhallCommand("hash", "--file", file)
+		cmd.Env = secretEnvPlaceholders(cmd.Env)
+		cmd.Stderr = os.Stderr
+		out, err := commandOutput(cmd)
+		if err != nil {
+			return false, fmt.Errorf("failed to hash %s: %v", file, err)
+		}
+		hashes = append(hashes, strings.TrimSpace(string(out)))
+	}
+	return hashes[0] == hashes[1], nil
+}
+
+// reportStale compares the staged outputs with the configured files for --check and exits
+func reportStale() {
+	stale, err := staleOutputs()
+	removeStagedOutputs()
+	if err != nil {
+		logFatal("failed to compare outputs", "error", err)
+	}
+	if len(stale) > 0 {
+		fmt.Fprintf(os.Stderr, "stale generated files, run ds-to-dhall again:\n  %s\n", strings.Join(stale, "\n  "))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStaleOutputs(t *testing.T) {
+	dir := t.TempDir()
+	defer func() { stagedOutputs, outputFiles = nil, make(map[string]bool) }()
+
+	stagedOutputs = make(map[string]string)
+	for name, contents := range map[string][2]string{
+		"components.yaml": {"frontend: {}\n", "frontend: {}\n"},
+		"images.yaml":     {"images: []\n", "images:\n  - nginx\n"},
+		"capacity.yaml":   {"components: {}\n", ""},
+	} {
+		file := filepath.Join(dir, name)
+		staged := stageOutput(file)
+		if err := ioutil.WriteFile(staged, []byte(contents[0]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		recordOutput(staged)
+		if contents[1] != "" {
+			if err := ioutil.WriteFile(file, []byte(contents[1]), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	stale, err := staleOutputs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{filepath.Join(dir, "capacity.yaml") + " (missing)", filepath.Join(dir, "images.yaml")}
+	if !reflect.DeepEqual(stale, expected) {
+		t.Errorf("expected %v, got %v", expected, stale)
+	}
+
+	staged := stageOutput(filepath.Join(dir, "images.yaml"))
+	if filepath.Dir(staged) == dir {
+		t.Errorf("expected the output to be staged outside of its directory, got %s", staged)
+	}
+	removeStagedOutputs()
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Errorf("expected the staged file to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "images.yaml")); err != nil {
+		t.Errorf("expected the configured file to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// outputFiles are the files written by the run, listed in the --checksums file
+var outputFiles = make(map[string]bool)
+
+// outputFilesMu guards outputFiles, ConfigMap data files are written by concurrent conversions
+var outputFilesMu sync.Mutex
+
+// recordOutput notes a file written by the run
+func recordOutput(file string) {
+	outputFilesMu.Lock()
+	defer outputFilesMu.Unlock()
+	outputFiles[file] = true
+}
+
+// fileSHA256 returns the hex encoded SHA-256 digest of the file contents
+func fileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksums writes the digests of the output files in the format of sha256sum, with paths relative to
+// the checksums file so it can be verified with sha256sum --check from its directory
+func writeChecksums(file string) error {
+	absFile, err := filepath.Abs(configuredOutput(file))
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for output := range outputFiles {
+		absOutput, err := filepath.Abs(configuredOutput(output))
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.Dir(absFile), absOutput)
+		if err != nil {
+			return err
+		}
+		sum, err := fileSHA256(output)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s\n", sum, filepath.ToSlash(rel)))
+	}
+	// sorted by path
+	sort.Slice(lines, func(i, j int) bool { return lines[i][64:] < lines[j][64:] })
+
+	return ioutil.WriteFile(file, []byte(strings.Join(lines, "")), 0644)
+}
+
+// signChecksums signs the checksums file with cosign, either with the key file or keyless. The signature is
+// written to <file>.sig and for keyless signing the certificate to <file>.pem.
+func signChecksums(file, keyFile string, keyless bool) error {
+	args := []string{"sign-blob", "--yes", "--output-signature", file + ".sig"}
+	if keyless {
+		args = append(args, "--output-certificate", file+".pem")
+	} else {
+		args = append(args, "--key", keyFile)
+	}
+	if offline {
+		// skip the upload to the transparency log
+		args = append(args, "--tlog-upload=false")
+	}
+	args = append(args, file)
+
+	cmd := exec.Command("cosign", args...)
+	cmd.Env = subprocessEnv()
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := runCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("cosign %s: %v", strings.Join(args, " "), err)
+	}
+	return nil
+}
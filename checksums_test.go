@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteChecksums(t *testing.T) {
+	dir := t.TempDir()
+	defer func() { outputFiles = make(map[string]bool) }()
+
+	for name, contents := range map[string]string{"record.dhall": "{=}\n", "data/frontend/nginx.conf": ""} {
+		file := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(file, []byte(contents), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recordOutput(file)
+	}
+
+	sums := filepath.Join(dir, "SHA256SUMS")
+	err := writeChecksums(sums)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := ioutil.ReadFile(sums)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  data/frontend/nginx.conf\n" +
+		"27d360becd3d933856fbafabe7315f5b0c1187f4931461c7026996001e8cf75d  record.dhall\n"
+	if string(got) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
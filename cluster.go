@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// kubectlArgs prefixes args with the configured kubeconfig context
+func kubectlArgs(args ...string) []string {
+	if kubeContext != "" {
+		args = append([]string{"--context", kubeContext}, args...)
+	}
+	return args
+}
+
+// detectClusterVersion asks the cluster kubectl is configured for for its major.minor server version
+func detectClusterVersion() (string, error) {
+	cmd := exec.Command("kubectl", kubectlArgs("version", "--output", "json")...)
+	cmd.Stderr = os.Stderr
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return "", err
+	}
+	return parseServerVersion(out)
+}
+
+func parseServerVersion(versionJSON []byte) (string, error) {
+	var v struct {
+		ServerVersion *struct {
+			Major string `json:"major"`
+			Minor string `json:"minor"`
+		} `json:"serverVersion"`
+	}
+	err := json.Unmarshal(versionJSON, &v)
+	if err != nil {
+		return "", err
+	}
+	if v.ServerVersion == nil {
+		return "", fmt.Errorf("kubectl did not report a server version")
+	}
+
+	// managed clusters report minor versions like 18+
+	minor := strings.TrimRight(v.ServerVersion.Minor, "+")
+	if v.ServerVersion.Major == "" || minor == "" {
+		return "", fmt.Errorf("incomplete server version %s.%s", v.ServerVersion.Major, v.ServerVersion.Minor)
+	}
+	return v.ServerVersion.Major + "." + minor, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestParseServerVersion(t *testing.T) {
+	fixtures := []struct {
+		json     string
+		expected string
+	}{
+		{
+			json:     `{"clientVersion":{"major":"1","minor":"24"},"serverVersion":{"major":"1","minor":"18"}}`,
+			expected: "1.18",
+		},
+		{
+			json:     `{"serverVersion":{"major":"1","minor":"21+","gitVersion":"v1.21.14-gke.700"}}`,
+			expected: "1.21",
+		},
+	}
+
+	for _, fx := range fixtures {
+		got, err := parseServerVersion([]byte(fx.json))
+		if err != nil {
+			t.Errorf("unexpected error parsing %s: %v", fx.json, err)
+		}
+		if got != fx.expected {
+			t.Errorf("expected %s, got %s", fx.expected, got)
+		}
+	}
+
+	_, err := parseServerVersion([]byte(`{"clientVersion":{"major":"1","minor":"24"}}`))
+	if err == nil {
+		t.Errorf("expected error without server version")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CompatPatch sets fields on the objects at Path of resources of Group and Kind, so that objects embedded in
+// manifests match the dhall-kubernetes types, which expect fields the API server leaves implicit
+type CompatPatch struct {
+	// Group is the API group of the patched resources, empty matches every group
+	Group string                 `yaml:"group"`
+	Kind  string                 `yaml:"kind"`
+	Path  string                 `yaml:"path"`
+	Set   map[string]interface{} `yaml:"set"`
+	// Required fails the conversion of resources without any object at Path
+	Required bool `yaml:"required"`
+}
+
+// builtinCompatPatches are applied unless disabled with --builtin-compat-patches=false, --config compatPatches
+// extend them
+var builtinCompatPatches = []CompatPatch{
+	{
+		Group: "apps",
+		Kind:  "StatefulSet",
+		Path:  ".spec.volumeClaimTemplates[*]",
+		Set:   map[string]interface{}{"apiVersion": "apps/v1", "kind": "PersistentVolumeClaim"},
+	},
+}
+
+// compatPatch is a parsed CompatPatch
+type compatPatch struct {
+	CompatPatch
+	path fieldPath
+}
+
+func parseCompatPatches(patches []CompatPatch) ([]compatPatch, error) {
+	var parsed []compatPatch
+	for _, p := range patches {
+		if p.Kind == "" {
+			return nil, fmt.Errorf("compatibility patch for %s is missing a kind", p.Path)
+		}
+		path, err := parseFieldPath(p.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid compatibility patch for %s: %v", p.Kind, err)
+		}
+		parsed = append(parsed, compatPatch{CompatPatch: p, path: path})
+	}
+	return parsed, nil
+}
+
+var compatPatches []compatPatch
+
+// applyCompatPatches applies the compatibility patches of the resource kind
+func applyCompatPatches(r *Resource) error {
+	for _, p := range compatPatches {
+		if p.Kind != r.Kind || (p.Group != "" && p.Group != apiGroup(r.ApiVersion)) {
+			continue
+		}
+
+		keys := make([]string, 0, len(p.Set))
+		for k := range p.Set {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var matched int
+		var err error
+		updatePath(r.Contents, p.path, func(v interface{}) interface{} {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				err = fmt.Errorf("%s is not an object", p.Path)
+				return v
+			}
+			for _, k := range keys {
+				obj[k] = copyValue(p.Set[k])
+			}
+			matched++
+			return obj
+		})
+		if err != nil {
+			return err
+		}
+		if matched == 0 && p.Required {
+			return fmt.Errorf("resource is missing %s", p.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import "testing"
+
+func TestApplyCompatPatches(t *testing.T) {
+	var err error
+	compatPatches, err = parseCompatPatches(builtinCompatPatches)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { compatPatches = nil }()
+
+	r := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: pgsql
+spec:
+  volumeClaimTemplates:
+    - metadata:
+        name: disk
+`)
+
+	err = applyCompatPatches(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertContents(t, r, `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: pgsql
+spec:
+  volumeClaimTemplates:
+    - apiVersion: apps/v1
+      kind: PersistentVolumeClaim
+      metadata:
+        name: disk
+`)
+
+	missing := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: redis
+spec: {}
+`)
+	err = applyCompatPatches(missing)
+	if err != nil {
+		t.Errorf("unexpected error for a StatefulSet without volumeClaimTemplates: %v", err)
+	}
+	assertContents(t, missing, `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: redis
+spec: {}
+`)
+}
+
+func TestRequiredCompatPatch(t *testing.T) {
+	var err error
+	compatPatches, err = parseCompatPatches([]CompatPatch{
+		{Kind: "Pipeline", Path: ".spec.template", Set: map[string]interface{}{"kind": "PodTemplate"}, Required: true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { compatPatches = nil }()
+
+	r := decodeTestResource(t, `
+apiVersion: example.com/v1
+kind: Pipeline
+metadata:
+  name: build
+spec: {}
+`)
+	err = applyCompatPatches(r)
+	if err == nil {
+		t.Errorf("expected an error for a resource missing the required path")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ComponentMapping renames the components matching Pattern to Component. Patterns are globs over the component
+// derived from the directory, or over the app.kubernetes.io/component label value when prefixed with label:
+type ComponentMapping struct {
+	Pattern   string
+	Component string
+}
+
+// ComponentMappings keep the order of the config file, the first matching mapping applies
+type ComponentMappings []ComponentMapping
+
+// UnmarshalYAML decodes a mapping of patterns to components preserving its order
+func (m *ComponentMappings) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: components must be a mapping of patterns to component names", value.Line)
+	}
+	for idx := 0; idx+1 < len(value.Content); idx += 2 {
+		var mapping ComponentMapping
+		err := value.Content[idx].Decode(&mapping.Pattern)
+		if err != nil {
+			return err
+		}
+		err = value.Content[idx+1].Decode(&mapping.Component)
+		if err != nil {
+			return err
+		}
+		_, err = path.Match(strings.TrimPrefix(mapping.Pattern, "label:"), "")
+		if err != nil {
+			return fmt.Errorf("line %d: invalid component pattern %s: %v", value.Content[idx].Line, mapping.Pattern, err)
+		}
+		*m = append(*m, mapping)
+	}
+	return nil
+}
+
+// mapComponent returns the component configured for a derived component, fromLabel tells whether it was derived
+// from the component label rather than the directory
+func mapComponent(mappings ComponentMappings, component string, fromLabel bool) string {
+	for _, m := range mappings {
+		pattern := m.Pattern
+		if strings.HasPrefix(pattern, "label:") != fromLabel {
+			continue
+		}
+		if matched, _ := path.Match(strings.TrimPrefix(pattern, "label:"), component); matched {
+			return m.Component
+		}
+	}
+	return component
+}
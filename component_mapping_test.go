@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMapComponent(t *testing.T) {
+	var c Config
+	err := yaml.Unmarshal([]byte(`
+components:
+  deploy/foo-old: Frontend
+  label:redis-*: Redis
+  deploy/*: Other
+`), &c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		component string
+		fromLabel bool
+		expected  string
+	}{
+		{"deploy/foo-old", false, "Frontend"},
+		{"deploy/bar", false, "Other"},
+		{"redis-cache", true, "Redis"},
+		{"redis-cache", false, "redis-cache"},
+		{"deploy/foo-old", true, "deploy/foo-old"},
+	}
+
+	for _, tc := range testCases {
+		actual := mapComponent(c.Components, tc.component, tc.fromLabel)
+		if actual != tc.expected {
+			t.Errorf("mapComponent(%s, %t): expected %s, got %s", tc.component, tc.fromLabel, tc.expected, actual)
+		}
+	}
+
+	err = yaml.Unmarshal([]byte("components:\n  '[': Broken\n"), &c)
+	if err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// containerSections are the lists of containers in a pod spec, each listed in its own section of the components
+// output
+var containerSections = []string{"containers", "initContainers", "ephemeralContainers"}
+
+// componentContainer is the inventory of a container in the components output
+type componentContainer struct {
+	Image     string                 `yaml:"image"`
+	Tag       string                 `yaml:"tag,omitempty"`
+	Digest    string                 `yaml:"digest,omitempty"`
+	Ports     []interface{}          `yaml:"ports,omitempty"`
+	Resources map[string]interface{} `yaml:"resources,omitempty"`
+	Env       []string               `yaml:"env,omitempty"`
+}
+
+func buildComponents(rs *ResourceSet) map[string]interface{} {
+	record := make(map[string]interface{})
+
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			km := make(map[string]interface{})
+			insertPath(record, recordPath(r), km)
+			for _, section := range containerSections {
+				containers := extractContainers(r, section)
+				if len(containers) > 0 {
+					km[section] = containers
+				}
+			}
+		}
+	}
+
+	return record
+}
+
+// extractContainers returns the containers in the section of the pod spec of a workload by name, including the
+// pod templates of Jobs and the job templates of CronJobs
+func extractContainers(r *Resource, section string) map[string]componentContainer {
+	spec, ok := podSpecPath(r.Kind)
+	if !ok {
+		return nil
+	}
+
+	containers := make(map[string]componentContainer)
+	for _, c := range lookupPath(r.Contents, append(spec, pathElem{key: section}, pathElem{wildcard: true})) {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := container["name"].(string)
+		containers[name] = containerDetails(container)
+	}
+	return containers
+}
+
+// containerDetails collects the image, declared ports, resources and env var names of a container
+func containerDetails(container map[string]interface{}) componentContainer {
+	var details componentContainer
+	details.Image, _ = container["image"].(string)
+	details.Tag, details.Digest = imageTag(details.Image)
+	details.Ports, _ = container["ports"].([]interface{})
+	details.Resources, _ = container["resources"].(map[string]interface{})
+	if len(details.Resources) == 0 {
+		details.Resources = nil
+	}
+
+	env, _ := container["env"].([]interface{})
+	for _, e := range env {
+		if v, ok := e.(map[string]interface{}); ok {
+			if name, ok := v["name"].(string); ok {
+				details.Env = append(details.Env, name)
+			}
+		}
+	}
+	return details
+}
+
+// imageTag returns the tag and digest an image reference names explicitly
+func imageTag(image string) (string, string) {
+	if image == "" {
+		return "", ""
+	}
+	ref := parseImageReference(image)
+	withoutDigest := strings.SplitN(image, "@", 2)[0]
+	if idx := strings.LastIndex(withoutDigest, ":"); idx < 0 || idx < strings.LastIndex(withoutDigest, "/") {
+		// the tag defaults to latest without a digest
+		if ref.digest != "" {
+			return "", ref.digest
+		}
+	}
+	return ref.tag, ref.digest
+}
+
+// encodeComponents renders the components output as yaml, json or toml
+func encodeComponents(components interface{}, format string) ([]byte, error) {
+	yamlBytes, err := yaml.Marshal(components)
+	if err != nil || format == "yaml" {
+		return yamlBytes, err
+	}
+
+	// the yaml encoding flattens the structs into plain maps and lists
+	var plain map[string]interface{}
+	err = yaml.Unmarshal(yamlBytes, &plain)
+	if err != nil {
+		return nil, err
+	}
+	if plain == nil {
+		plain = make(map[string]interface{})
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(plain, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(jsonBytes, '\n'), nil
+	case "toml":
+		return encodeTOML(plain)
+	default:
+		return nil, fmt.Errorf("unknown components format %q", format)
+	}
+}
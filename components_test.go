@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBuildComponentsContainers(t *testing.T) {
+	var contents map[string]interface{}
+	err := yaml.Unmarshal([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      containers:
+        - name: frontend
+          image: index.docker.io/sourcegraph/frontend:3.20.0@sha256:abc
+          ports:
+            - name: http
+              containerPort: 3080
+          resources:
+            limits:
+              cpu: "2"
+            requests:
+              memory: 1G
+          env:
+            - name: PGHOST
+              value: pgsql
+            - name: SRC_GIT_SERVERS
+              value: gitserver:3178
+        - name: jaeger-agent
+          image: jaegertracing/jaeger-agent@sha256:def
+      initContainers:
+        - name: migrator
+          image: sourcegraph/migrator:3.20.0
+      ephemeralContainers:
+        - name: debugger
+          image: busybox
+`), &contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"frontend": {{Component: "frontend", Kind: "Deployment", Name: "frontend", Contents: contents}},
+	}}
+	var got bytes.Buffer
+	err = encodeYaml(&got, buildComponents(rs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Frontend:
+    Deployment:
+        frontend:
+            containers:
+                frontend:
+                    image: index.docker.io/sourcegraph/frontend:3.20.0@sha256:abc
+                    tag: 3.20.0
+                    digest: sha256:abc
+                    ports:
+                        - containerPort: 3080
+                          name: http
+                    resources:
+                        limits:
+                            cpu: "2"
+                        requests:
+                            memory: 1G
+                    env:
+                        - PGHOST
+                        - SRC_GIT_SERVERS
+                jaeger-agent:
+                    image: jaegertracing/jaeger-agent@sha256:def
+                    digest: sha256:def
+            ephemeralContainers:
+                debugger:
+                    image: busybox
+                    tag: latest
+            initContainers:
+                migrator:
+                    image: sourcegraph/migrator:3.20.0
+                    tag: 3.20.0
+`
+	if got.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got.String())
+	}
+}
+
+func TestBuildComponentsBatchContainers(t *testing.T) {
+	var contents map[string]interface{}
+	err := yaml.Unmarshal([]byte(`
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  schedule: "0 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: cleanup
+              image: sourcegraph/cleanup:1.0
+`), &contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Resource{Component: "cleanup", Kind: "CronJob", Name: "cleanup", Contents: contents}
+	containers := extractContainers(r, "containers")
+	if len(containers) != 1 || containers["cleanup"].Tag != "1.0" {
+		t.Errorf("expected the cleanup container of the job template, got %v", containers)
+	}
+}
+
+func TestBuildComponentsV2(t *testing.T) {
+	var resources []*Resource
+	for _, manifest := range []string{`
+apiVersion: apps/v1
+kind: StatefulSet
+metadata: {name: gitserver, namespace: prod}
+spec:
+  template:
+    metadata:
+      labels: {app: gitserver, tier: backend}
+    spec:
+      containers:
+        - name: gitserver
+          image: sourcegraph/gitserver:3.20
+          envFrom:
+            - configMapRef: {name: gitserver-env}
+      volumes:
+        - name: ssh
+          secret: {secretName: gitserver-ssh}
+  volumeClaimTemplates:
+    - metadata: {name: repos}
+      spec:
+        accessModes: [ReadWriteOnce]
+        resources: {requests: {storage: 200Gi}}
+`, `
+apiVersion: v1
+kind: Service
+metadata: {name: gitserver, namespace: prod}
+spec:
+  clusterIP: None
+  selector: {app: gitserver}
+  ports:
+    - name: unused
+      port: 10811
+`} {
+		var contents map[string]interface{}
+		err := yaml.Unmarshal([]byte(manifest), &contents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resources = append(resources, &Resource{Component: "gitserver", Kind: contents["kind"].(string),
+			Name: contents["metadata"].(map[string]interface{})["name"].(string), Contents: contents})
+	}
+
+	got, err := encodeComponents(buildComponentsV2(&ResourceSet{Components: map[string][]*Resource{"gitserver": resources}}), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `schemaVersion: 2
+components:
+    Gitserver:
+        resources:
+            - kind: Service
+              name: gitserver
+              namespace: prod
+            - kind: StatefulSet
+              name: gitserver
+              namespace: prod
+        workloads:
+            - kind: StatefulSet
+              name: gitserver
+              namespace: prod
+              containers:
+                gitserver:
+                    image: sourcegraph/gitserver:3.20
+                    tag: "3.20"
+        services:
+            - kind: Service
+              name: gitserver
+              namespace: prod
+              type: ClusterIP
+              ports:
+                - name: unused
+                  port: 10811
+              workloads:
+                - kind: StatefulSet
+                  name: gitserver
+                  namespace: prod
+        volumeClaimTemplates:
+            - workload: gitserver
+              name: repos
+              accessModes:
+                - ReadWriteOnce
+              storage: 200Gi
+        configMaps:
+            - gitserver-env
+        secrets:
+            - gitserver-ssh
+`
+	if string(got) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
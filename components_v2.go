@@ -0,0 +1,225 @@
+package main
+
+import "sort"
+
+// ComponentsSchemaVersion is the current version of the components output schema. Version 1 is the record
+// shaped listing of containers by component, kind and name.
+const ComponentsSchemaVersion = 2
+
+// componentsV2 is the components output keyed by component, schemaVersion lets consumers tell the layouts apart
+type componentsV2 struct {
+	SchemaVersion int                     `yaml:"schemaVersion"`
+	Components    map[string]*componentV2 `yaml:"components"`
+}
+
+type componentV2 struct {
+	Resources            []componentResource    `yaml:"resources"`
+	Workloads            []componentWorkload    `yaml:"workloads,omitempty"`
+	Services             []componentService     `yaml:"services,omitempty"`
+	VolumeClaimTemplates []componentVolumeClaim `yaml:"volumeClaimTemplates,omitempty"`
+	// ConfigMaps and Secrets are the names referenced by the workloads and ingresses of the component
+	ConfigMaps []string `yaml:"configMaps,omitempty"`
+	Secrets    []string `yaml:"secrets,omitempty"`
+}
+
+type componentResource struct {
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type componentWorkload struct {
+	componentResource   `yaml:",inline"`
+	Containers          map[string]componentContainer `yaml:"containers,omitempty"`
+	InitContainers      map[string]componentContainer `yaml:"initContainers,omitempty"`
+	EphemeralContainers map[string]componentContainer `yaml:"ephemeralContainers,omitempty"`
+}
+
+type componentService struct {
+	componentResource `yaml:",inline"`
+	Type              string        `yaml:"type"`
+	Ports             []interface{} `yaml:"ports,omitempty"`
+	// Workloads are the workloads whose pods the selector of the service matches, in any component
+	Workloads []componentResource `yaml:"workloads,omitempty"`
+}
+
+type componentVolumeClaim struct {
+	// Workload is the name of the StatefulSet the claims are created for
+	Workload         string   `yaml:"workload"`
+	Name             string   `yaml:"name"`
+	StorageClassName string   `yaml:"storageClassName,omitempty"`
+	AccessModes      []string `yaml:"accessModes,omitempty"`
+	Storage          string   `yaml:"storage,omitempty"`
+}
+
+// buildComponentsV2 lists per component its resources, workloads with their containers, services, volume claim
+// templates and the ConfigMaps and Secrets it references
+func buildComponentsV2(rs *ResourceSet) *componentsV2 {
+	components := &componentsV2{SchemaVersion: ComponentsSchemaVersion, Components: make(map[string]*componentV2)}
+	references := make(map[string]map[string]map[string]bool)
+
+	for _, r := range sortedResources(rs) {
+		key := componentKey(r.Component)
+		c, ok := components.Components[key]
+		if !ok {
+			c = &componentV2{}
+			components.Components[key] = c
+			references[key] = map[string]map[string]bool{"ConfigMap": {}, "Secret": {}}
+		}
+
+		resource := componentResource{Kind: r.Kind, Name: r.Name}
+		if !clusterScopedKinds[r.Kind] {
+			resource.Namespace = resourceNamespace(r)
+		}
+		c.Resources = append(c.Resources, resource)
+
+		if _, ok := podSpecPath(r.Kind); ok {
+			c.Workloads = append(c.Workloads, componentWorkload{
+				componentResource:   resource,
+				Containers:          nilIfEmpty(extractContainers(r, "containers")),
+				InitContainers:      nilIfEmpty(extractContainers(r, "initContainers")),
+				EphemeralContainers: nilIfEmpty(extractContainers(r, "ephemeralContainers")),
+			})
+		}
+
+		switch r.Kind {
+		case "Service":
+			spec, _ := r.Contents["spec"].(map[string]interface{})
+			serviceType, _ := spec["type"].(string)
+			if serviceType == "" {
+				serviceType = "ClusterIP"
+			}
+			ports, _ := spec["ports"].([]interface{})
+			c.Services = append(c.Services, componentService{componentResource: resource, Type: serviceType, Ports: ports,
+				Workloads: selectedWorkloads(rs, r)})
+		case "StatefulSet":
+			c.VolumeClaimTemplates = append(c.VolumeClaimTemplates, volumeClaimTemplates(r)...)
+		}
+
+		for kind, names := range references[key] {
+			for _, name := range referencedNames(r, kind) {
+				names[name] = true
+			}
+		}
+	}
+
+	for key, c := range components.Components {
+		c.ConfigMaps = sortedKeys(references[key]["ConfigMap"])
+		c.Secrets = sortedKeys(references[key]["Secret"])
+	}
+	return components
+}
+
+func nilIfEmpty(containers map[string]componentContainer) map[string]componentContainer {
+	if len(containers) == 0 {
+		return nil
+	}
+	return containers
+}
+
+func volumeClaimTemplates(r *Resource) []componentVolumeClaim {
+	var claims []componentVolumeClaim
+	for _, t := range lookupPath(r.Contents, fieldPath{{key: "spec"}, {key: "volumeClaimTemplates"}, {wildcard: true}}) {
+		template, _ := t.(map[string]interface{})
+		metadata, _ := template["metadata"].(map[string]interface{})
+		spec, _ := template["spec"].(map[string]interface{})
+
+		claim := componentVolumeClaim{Workload: r.Name}
+		claim.Name, _ = metadata["name"].(string)
+		claim.StorageClassName, _ = spec["storageClassName"].(string)
+		claim.AccessModes = stringList(spec["accessModes"])
+		for _, storage := range lookupPath(spec, fieldPath{{key: "resources"}, {key: "requests"}, {key: "storage"}}) {
+			claim.Storage, _ = storage.(string)
+		}
+		claims = append(claims, claim)
+	}
+	return claims
+}
+
+// referencedNames returns the names of resources of kind the resource refers to
+func referencedNames(r *Resource, kind string) []string {
+	var paths []string
+	if spec, ok := podSpecPath(r.Kind); ok {
+		for _, ref := range podSpecNameReferences {
+			if ref.kind == kind {
+				paths = append(paths, spec.String()+ref.path)
+			}
+		}
+	}
+	for _, ref := range resourceNameReferences[r.Kind] {
+		if ref.kind == kind {
+			paths = append(paths, ref.path)
+		}
+	}
+
+	var names []string
+	for _, p := range paths {
+		path, err := parseFieldPath(p)
+		if err != nil {
+			continue
+		}
+		for _, v := range lookupPath(r.Contents, path) {
+			if name, ok := v.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// podTemplateLabels returns the labels of the pods of a workload
+func podTemplateLabels(r *Resource) (map[string]interface{}, bool) {
+	path := fieldPath{{key: "metadata"}}
+	if r.Kind != "Pod" {
+		template, ok := podTemplateMetadata[r.Kind]
+		if !ok {
+			return nil, false
+		}
+		path = template
+	}
+	for _, metadata := range lookupPath(r.Contents, path) {
+		m, _ := metadata.(map[string]interface{})
+		labels, _ := m["labels"].(map[string]interface{})
+		return labels, true
+	}
+	return nil, true
+}
+
+// selectedWorkloads returns the workloads in the namespace of the service whose pod labels match its selector
+func selectedWorkloads(rs *ResourceSet, service *Resource) []componentResource {
+	spec, _ := service.Contents["spec"].(map[string]interface{})
+	selector, _ := spec["selector"].(map[string]interface{})
+	if len(selector) == 0 {
+		// services without selector have their endpoints managed elsewhere
+		return nil
+	}
+
+	var workloads []componentResource
+	namespace := resourceNamespace(service)
+	for _, r := range sortedResources(rs) {
+		labels, ok := podTemplateLabels(r)
+		if !ok || resourceNamespace(r) != namespace {
+			continue
+		}
+		matches := true
+		for k, v := range selector {
+			if labels[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			workloads = append(workloads, componentResource{Kind: r.Kind, Name: r.Name, Namespace: namespace})
+		}
+	}
+	return workloads
+}
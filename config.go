@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration file passed with --config, for settings that don't fit on a command line
+type Config struct {
+	// Drop lists fields removed from resources before conversion, as <Kind or *>:<field path>
+	Drop []string `yaml:"drop"`
+	// Defaults set fields on matching resources that don't have them yet
+	Defaults []FieldRule `yaml:"defaults"`
+	// Overrides set fields on matching resources, replacing existing values
+	Overrides []FieldRule `yaml:"overrides"`
+	// CompatPatches extend the built-in patches making embedded objects match the dhall-kubernetes types
+	CompatPatches []CompatPatch `yaml:"compatPatches"`
+	// Components rename derived components, see ComponentMapping
+	Components ComponentMappings `yaml:"components"`
+}
+
+// FieldRule sets the field at Path to Value on resources of Kind, * matches all kinds
+type FieldRule struct {
+	Kind  string      `yaml:"kind"`
+	Path  string      `yaml:"path"`
+	Value interface{} `yaml:"value"`
+}
+
+var config Config
+
+func loadConfig(file string) (Config, error) {
+	var c Config
+	if file == "" {
+		return c, nil
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return c, err
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(string(contents)))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&c)
+	if err != nil {
+		return c, fmt.Errorf("failed to decode config file %s: %v", file, err)
+	}
+	return c, nil
+}
+
+// kindSelector matches resources by kind, * matches all kinds
+type kindSelector string
+
+func (s kindSelector) matches(r *Resource) bool {
+	return s == "*" || string(s) == r.Kind
+}
+
+// dropRule removes the values at path from resources matching kind
+type dropRule struct {
+	kind kindSelector
+	path fieldPath
+}
+
+func parseDropRules(specs []string) ([]dropRule, error) {
+	var rules []dropRule
+	for _, spec := range specs {
+		idx := strings.Index(spec, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid drop rule %q, expected <Kind or *>:<field path>", spec)
+		}
+		path, err := parseFieldPath(spec[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid drop rule %q: %v", spec, err)
+		}
+		rules = append(rules, dropRule{kind: kindSelector(spec[:idx]), path: path})
+	}
+	return rules, nil
+}
+
+// setRule sets value at path on resources matching kind, keeping existing values when onlyMissing
+type setRule struct {
+	kind        kindSelector
+	path        fieldPath
+	value       interface{}
+	onlyMissing bool
+}
+
+// parseSetRules turns the config defaults and overrides into set rules, defaults first so overrides win
+func parseSetRules(c Config) ([]setRule, error) {
+	var rules []setRule
+	for _, section := range []struct {
+		name        string
+		rules       []FieldRule
+		onlyMissing bool
+	}{
+		{name: "defaults", rules: c.Defaults, onlyMissing: true},
+		{name: "overrides", rules: c.Overrides},
+	} {
+		for _, fr := range section.rules {
+			if fr.Kind == "" {
+				return nil, fmt.Errorf("%s rule for %s is missing a kind, use * for all kinds", section.name, fr.Path)
+			}
+			path, err := parseFieldPath(fr.Path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s rule for %s: %v", section.name, fr.Kind, err)
+			}
+			rules = append(rules, setRule{
+				kind:        kindSelector(fr.Kind),
+				path:        path,
+				value:       fr.Value,
+				onlyMissing: section.onlyMissing,
+			})
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// conversionCache keeps yaml-to-dhall results on disk across runs, content addressed by the converted yaml, the
+// type it is converted against, the local files the type imports and the versions of the tools
+type conversionCache struct {
+	dir string
+	// salt is hashed into every key: the tool versions and the working directory relative imports are resolved
+	// against
+	salt    string
+	imports localImports
+}
+
+// defaultConversionCacheDir is the cache location when --cache-dir is not given
+func defaultConversionCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ds-to-dhall", "conversions"), nil
+}
+
+func newConversionCache(dir string) (*conversionCache, error) {
+	cmd := exec.Command("yaml-to-dhall", "--version")
+	cmd.Env = subprocessEnv()
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get yaml-to-dhall version: %v", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	salt := []string{"ds-to-dhall " + version, "yaml-to-dhall " + strings.TrimSpace(string(out)), cwd}
+	return &conversionCache{dir: dir, salt: strings.Join(salt, "\n")}, nil
+}
+
+// key hashes the salt, the schema, the local files it imports and the yaml encoding of contents, streamed into the
+// hash
+func (c *conversionCache) key(schema string, contents interface{}) (string, error) {
+	h := sha256.New()
+	// vendored schemas, schema packages, type map bases and local import mappings can change in place, unlike
+	// pinned remote imports
+	imports := c.imports.digest(schema, ".")
+	for _, part := range []string{c.salt, schema, imports} {
+		// length prefixed, so that parts can't run into each other
+		fmt.Fprintf(h, "%d:%s", len(part), part)
+	}
+	err := encodeYaml(h, contents)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// localImports hashes local imports, each file once per run
+type localImports struct {
+	mu sync.Mutex
+	// digests are the digests of the files hashed so far, by absolute path
+	digests map[string]string
+}
+
+// digest hashes the local files imported by expr, relative to dir, and the files they import in turn
+func (l *localImports) digest(expr, dir string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.digests == nil {
+		l.digests = make(map[string]string)
+	}
+	return l.exprDigest(expr, dir)
+}
+
+func (l *localImports) exprDigest(expr, dir string) string {
+	var digests []string
+	for _, m := range localImportRegexp.FindAllStringSubmatch(expr, -1) {
+		path := filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(m[1], `"`, "")))
+		digests = append(digests, l.fileDigest(path))
+	}
+	return strings.Join(digests, ",")
+}
+
+// fileDigest hashes the contents of file and of its local imports, or of every file below it for directories.
+// Missing files are left for yaml-to-dhall to report.
+func (l *localImports) fileDigest(file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "missing"
+	}
+	if digest, ok := l.digests[abs]; ok {
+		return digest
+	}
+	// dhall rejects import cycles, this only keeps a cycle from recursing forever
+	l.digests[abs] = "cycle"
+
+	h := sha256.New()
+	info, err := os.Stat(abs)
+	switch {
+	case err != nil:
+		fmt.Fprint(h, "missing")
+	case info.IsDir():
+		_ = filepath.Walk(abs, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && path != abs {
+				fmt.Fprintf(h, "%s:%s\n", path, l.fileDigest(path))
+			}
+			return nil
+		})
+	default:
+		contents, err := ioutil.ReadFile(abs)
+		if err != nil {
+			fmt.Fprint(h, "missing")
+			break
+		}
+		h.Write(contents)
+		fmt.Fprint(h, l.exprDigest(string(contents), filepath.Dir(abs)))
+	}
+
+	digest := hex.EncodeToString(h.Sum(nil))
+	l.digests[abs] = digest
+	return digest
+}
+
+func (c *conversionCache) file(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".dhall")
+}
+
+// get returns the cached conversion with key, if any
+func (c *conversionCache) get(key string) (string, bool) {
+	contents, err := ioutil.ReadFile(c.file(key))
+	if err != nil {
+		return "", false
+	}
+	conversionCacheStats.record(true)
+	return string(contents), true
+}
+
+// put caches a conversion, written to a temporary file first so that concurrent runs never read partial entries
+func (c *conversionCache) put(key, expr string) error {
+	conversionCacheStats.record(false)
+	file := c.file(key)
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(expr)
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// cacheStats counts the cache hits and misses of a run
+type cacheStats struct {
+	mu     sync.Mutex
+	hits   int
+	misses int
+}
+
+func (s *cacheStats) record(hit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hit {
+		s.hits++
+	} else {
+		s.misses++
+	}
+}
+
+var (
+	conversions          *conversionCache
+	conversionCacheStats cacheStats
+)
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConversionCache(t *testing.T) {
+	c := &conversionCache{dir: t.TempDir(), salt: "yaml-to-dhall 1.7.6"}
+	contents := map[string]interface{}{"kind": "Service"}
+	key := func(c *conversionCache, schema string) string {
+		k, err := c.key(schema, contents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	if _, ok := c.get(key(c, "k8s.Service.Type")); ok {
+		t.Fatal("expected an empty cache")
+	}
+	err := c.put(key(c, "k8s.Service.Type"), "{ kind = \"Service\" }\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expr, ok := c.get(key(c, "k8s.Service.Type")); !ok || expr != "{ kind = \"Service\" }\n" {
+		t.Errorf("expected the cached conversion, got %q, %v", expr, ok)
+	}
+
+	if _, ok := c.get(key(c, "k8s.Deployment.Type")); ok {
+		t.Error("expected a miss for another type")
+	}
+	other := &conversionCache{dir: c.dir, salt: "yaml-to-dhall 1.7.7"}
+	if _, ok := other.get(key(other, "k8s.Service.Type")); ok {
+		t.Error("expected a miss for another tool version")
+	}
+}
+
+func TestYamlToDhallCached(t *testing.T) {
+	conversions = &conversionCache{dir: t.TempDir(), salt: "test"}
+	defer func() { conversions = nil }()
+
+	contents := map[string]interface{}{"broken": true}
+	key, err := conversions.key("", contents)
+	if err == nil {
+		err = conversions.put(key, "{ broken = True }\n")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fake yaml-to-dhall fails on this input, so the result must come from the cache
+	fakeYamlToDhall(t)
+	expr, err := yamlToDhall(context.Background(), "", contents)
+	if err != nil || expr != "{ broken = True }\n" {
+		t.Errorf("expected the cached conversion, got %q, %v", expr, err)
+	}
+}
+
+func TestConversionCacheKeyHashesLocalImports(t *testing.T) {
+	dir := t.TempDir()
+	write := func(file, contents string) {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, file), []byte(contents), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("schemas.dhall", "{ Service = ./types/Service.dhall }")
+	write(filepath.Join("types", "Service.dhall"), "{ kind : Text }")
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(cwd, filepath.Join(dir, "schemas.dhall"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "let k8s = " + dhallLocalImport(rel) + " in k8s.Service"
+
+	key := func() string {
+		c := &conversionCache{dir: dir, salt: "test"}
+		k, err := c.key(schema, map[string]interface{}{"kind": "Service"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	before := key()
+	if key() != before {
+		t.Fatal("expected the same key for unchanged imports")
+	}
+	// a type imported by the schemas changes in place
+	write(filepath.Join("types", "Service.dhall"), "{ kind : Text, apiVersion : Text }")
+	if key() == before {
+		t.Error("expected another key after a transitively imported file changed")
+	}
+}
+
+// startedMarshaler encodes only once yaml-to-dhall has created started, the yaml must be streamed to be encoded
+type startedMarshaler string
+
+func (started startedMarshaler) MarshalYAML() (interface{}, error) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(string(started)); err == nil {
+			return "streamed", nil
+		}
+	}
+	return nil, errors.New("yaml-to-dhall didn't start before the yaml was encoded")
+}
+
+func TestYamlToDhallStreamsInput(t *testing.T) {
+	dir := t.TempDir()
+	started := filepath.Join(dir, "started")
+	script := fmt.Sprintf("#!/bin/sh\ntouch %s\ngrep -q 'name: streamed' && echo '{ name = \"streamed\" }'\n", started)
+	err := ioutil.WriteFile(filepath.Join(dir, "yaml-to-dhall"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	expr, err := yamlToDhall(context.Background(), "", map[string]interface{}{"name": startedMarshaler(started)})
+	if err != nil || expr != "{ name = \"streamed\" }\n" {
+		t.Errorf("expected the yaml to be encoded while yaml-to-dhall reads it, got %q, %v", expr, err)
+	}
+}
+
+func TestYamlToDhallTimeout(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "yaml-to-dhall"), []byte("#!/bin/sh\ncat >/dev/null\nexec sleep 5\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+	defer func(saved time.Duration) { timeout = saved }(timeout)
+	timeout = 100 * time.Millisecond
+
+	_, err = yamlToDhall(context.Background(), "", map[string]interface{}{"kind": "Service"})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("expected the conversion to time out, got %v", err)
+	}
+}
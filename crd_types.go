@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+)
+
+// crdTypeKey identifies the custom resources typed by a CRD version
+func crdTypeKey(apiVersion, kind string) string {
+	return apiVersion + "/" + kind
+}
+
+// collectCRDTypes synthesizes dhall types for the versions of all CustomResourceDefinitions in the set,
+// keyed by crdTypeKey. CRDs whose schema can't be expressed are skipped with a warning.
+func collectCRDTypes(rs *ResourceSet) map[string]string {
+	types := make(map[string]string)
+
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			if r.Kind != "CustomResourceDefinition" {
+				continue
+			}
+			crdTypes, err := crdDhallTypes(r.Contents)
+			if err != nil {
+				log15.Warn("failed to synthesize dhall type from CRD", "crd", r.Name, "source", r.Source, "error", err)
+				continue
+			}
+			for k, t := range crdTypes {
+				types[k] = t
+			}
+		}
+	}
+
+	return types
+}
+
+// crdDhallTypes synthesizes the dhall types of every version of a CRD from its openAPIV3Schema,
+// supporting both the apiextensions.k8s.io/v1 (per version) and v1beta1 (spec.validation) layout
+func crdDhallTypes(crd map[string]interface{}) (map[string]string, error) {
+	spec, ok := crd["spec"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("missing spec")
+	}
+	group, ok := spec["group"].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing spec.group")
+	}
+	names, _ := spec["names"].(map[string]interface{})
+	kind, ok := names["kind"].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing spec.names.kind")
+	}
+
+	var sharedSchema map[string]interface{}
+	if validation, ok := spec["validation"].(map[string]interface{}); ok {
+		sharedSchema, _ = validation["openAPIV3Schema"].(map[string]interface{})
+	}
+
+	schemas := make(map[string]map[string]interface{})
+	if versions, ok := spec["versions"].([]interface{}); ok {
+		for _, v := range versions {
+			version, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, ok := version["name"].(string)
+			if !ok {
+				continue
+			}
+			schemas[name] = sharedSchema
+			if s, ok := version["schema"].(map[string]interface{}); ok {
+				if openAPI, ok := s["openAPIV3Schema"].(map[string]interface{}); ok {
+					schemas[name] = openAPI
+				}
+			}
+		}
+	} else if version, ok := spec["version"].(string); ok {
+		schemas[version] = sharedSchema
+	}
+
+	types := make(map[string]string)
+	for version, schema := range schemas {
+		if schema == nil {
+			return nil, fmt.Errorf("version %s has no openAPIV3Schema", version)
+		}
+		t, err := openAPIResourceType(schema)
+		if err != nil {
+			return nil, fmt.Errorf("version %s: %v", version, err)
+		}
+		types[crdTypeKey(group+"/"+version, kind)] = t
+	}
+	return types, nil
+}
+
+// openAPIResourceType is the type of the top level object of a custom resource, which always carries
+// apiVersion, kind and standard object metadata
+func openAPIResourceType(schema map[string]interface{}) (string, error) {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	fields := []string{
+		"apiVersion : Text",
+		"kind : Text",
+		fmt.Sprintf("metadata : %s.ObjectMeta.Type", K8sBinding),
+	}
+	required := requiredFields(schema)
+
+	for _, name := range sortedProperties(properties) {
+		if name == "apiVersion" || name == "kind" || name == "metadata" {
+			continue
+		}
+		prop, _ := properties[name].(map[string]interface{})
+		t, err := openAPIType(prop)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+		if !required[name] {
+			t = "Optional " + parenthesize(t)
+		}
+		fields = append(fields, fmt.Sprintf("%s : %s", dhallLabel(name), t))
+	}
+
+	return fmt.Sprintf("{ %s }", strings.Join(fields, ", ")), nil
+}
+
+// openAPIType translates an OpenAPI v3 schema into the dhall type yaml-to-dhall converts matching values to,
+// following the conventions of dhall-kubernetes (integers are Naturals, maps are Map Text values)
+func openAPIType(schema map[string]interface{}) (string, error) {
+	if schema == nil {
+		return "", fmt.Errorf("missing schema")
+	}
+	if b, _ := schema["x-kubernetes-int-or-string"].(bool); b {
+		return fmt.Sprintf("%s.IntOrString", K8sBinding), nil
+	}
+
+	t, _ := schema["type"].(string)
+	switch t {
+	case "string":
+		return "Text", nil
+	case "integer":
+		return "Natural", nil
+	case "number":
+		return "Double", nil
+	case "boolean":
+		return "Bool", nil
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		it, err := openAPIType(items)
+		if err != nil {
+			return "", fmt.Errorf("items: %v", err)
+		}
+		return "List " + parenthesize(it), nil
+	case "object", "":
+		if b, _ := schema["x-kubernetes-preserve-unknown-fields"].(bool); b {
+			return "", fmt.Errorf("objects preserving unknown fields can't be typed")
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		if len(properties) == 0 {
+			additional, ok := schema["additionalProperties"].(map[string]interface{})
+			if !ok {
+				if t == "" {
+					return "", fmt.Errorf("schema without type")
+				}
+				return "{}", nil
+			}
+			vt, err := openAPIType(additional)
+			if err != nil {
+				return "", fmt.Errorf("additionalProperties: %v", err)
+			}
+			return fmt.Sprintf("List { mapKey : Text, mapValue : %s }", vt), nil
+		}
+
+		required := requiredFields(schema)
+		var fields []string
+		for _, name := range sortedProperties(properties) {
+			prop, _ := properties[name].(map[string]interface{})
+			ft, err := openAPIType(prop)
+			if err != nil {
+				return "", fmt.Errorf("%s: %v", name, err)
+			}
+			if !required[name] {
+				ft = "Optional " + parenthesize(ft)
+			}
+			fields = append(fields, fmt.Sprintf("%s : %s", dhallLabel(name), ft))
+		}
+		return fmt.Sprintf("{ %s }", strings.Join(fields, ", ")), nil
+	default:
+		return "", fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+func requiredFields(schema map[string]interface{}) map[string]bool {
+	required := make(map[string]bool)
+	names, _ := schema["required"].([]interface{})
+	for _, n := range names {
+		if name, ok := n.(string); ok {
+			required[name] = true
+		}
+	}
+	return required
+}
+
+func sortedProperties(properties map[string]interface{}) []string {
+	var names []string
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parenthesize wraps type applications so they can be used as an argument
+func parenthesize(t string) string {
+	if strings.Contains(t, " ") && !strings.HasPrefix(t, "{") {
+		return "(" + t + ")"
+	}
+	return t
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testCRD = `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: certificates.cert-manager.io
+spec:
+  group: cert-manager.io
+  names:
+    kind: Certificate
+  versions:
+    - name: v1
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            apiVersion:
+              type: string
+            kind:
+              type: string
+            metadata:
+              type: object
+            spec:
+              type: object
+              required:
+                - secretName
+              properties:
+                secretName:
+                  type: string
+                dnsNames:
+                  type: array
+                  items:
+                    type: string
+                duration:
+                  x-kubernetes-int-or-string: true
+                renewBefore:
+                  type: integer
+                labels:
+                  type: object
+                  additionalProperties:
+                    type: string
+          required:
+            - spec
+`
+
+func TestCRDDhallTypes(t *testing.T) {
+	var crd map[string]interface{}
+	err := yaml.Unmarshal([]byte(testCRD), &crd)
+	if err != nil {
+		t.Fatalf("failed to decode test CRD: %v", err)
+	}
+
+	types, err := crdDhallTypes(crd)
+	if err != nil {
+		t.Fatalf("unexpected error synthesizing CRD types: %v", err)
+	}
+
+	expected := "{ apiVersion : Text, kind : Text, metadata : k8s.ObjectMeta.Type, spec : { dnsNames : Optional (List Text), " +
+		"duration : Optional k8s.IntOrString, labels : Optional (List { mapKey : Text, mapValue : Text }), " +
+		"renewBefore : Optional Natural, secretName : Text } }"
+
+	got, ok := types[crdTypeKey("cert-manager.io/v1", "Certificate")]
+	if !ok {
+		t.Fatalf("expected type for cert-manager.io/v1 Certificate, got %v", types)
+	}
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestOpenAPITypePreserveUnknownFields(t *testing.T) {
+	_, err := openAPIType(map[string]interface{}{"type": "object", "x-kubernetes-preserve-unknown-fields": true})
+	if err == nil {
+		t.Errorf("expected objects preserving unknown fields to be rejected")
+	}
+}
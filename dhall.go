@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// composeDhallRecord converts the resources of every component with a single yaml-to-dhall run and assembles the
+// results into a record of named let bindings, one per resource, so the generated file stays navigable and
+// diffable
+func composeDhallRecord(ctx context.Context, rs *ResourceSet) (string, error) {
+	resources := sortedResources(rs)
+	exprs, err := convertAll(ctx, resources)
+	if err != nil {
+		return "", err
+	}
+	return assembleRecord(resources, exprs, 0), nil
+}
+
+// convertAll converts resources, in record order, with a yaml-to-dhall run per component. Components are converted
+// concurrently, up to --jobs at a time, and a failing component doesn't stop the others.
+func convertAll(ctx context.Context, resources []*Resource) ([]string, error) {
+	byComponent := make(map[string][]int)
+	for idx, r := range resources {
+		byComponent[r.Component] = append(byComponent[r.Component], idx)
+	}
+
+	exprs := make([]string, len(resources))
+	failures := make(map[string]*conversionError)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, conversionJobs)
+	for component, indices := range byComponent {
+		wg.Add(1)
+		go func(component string, indices []int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			var componentResources []*Resource
+			for _, idx := range indices {
+				componentResources = append(componentResources, resources[idx])
+			}
+			converted, err := convertComponent(ctx, componentResources)
+			if err != nil {
+				mu.Lock()
+				failures[component] = err
+				mu.Unlock()
+				return
+			}
+			for i, idx := range indices {
+				exprs[idx] = converted[i]
+			}
+		}(component, indices)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		var messages []string
+		var failed []*Resource
+		for component, err := range failures {
+			messages = append(messages, fmt.Sprintf("%s: %v", component, err))
+			failed = append(failed, err.resources...)
+		}
+		sort.Strings(messages)
+		return nil, &conversionError{
+			resources: failed,
+			err: fmt.Errorf("%d of %d components failed to convert:\n  %s", len(failures), len(byComponent),
+				strings.Join(messages, "\n  ")),
+		}
+	}
+	return exprs, nil
+}
+
+// assembleRecord binds the converted expression of every resource and returns the record of the bindings, laid
+// out by the record path of the resources without its first depth keys
+func assembleRecord(resources []*Resource, exprs []string, depth int) string {
+	var b strings.Builder
+	record := make(map[string]interface{})
+	for idx, r := range resources {
+		path := recordPath(r)
+		binding := resourceBinding(path)
+		fmt.Fprintf(&b, "let %s = %s\n\n", binding, exprs[idx])
+		insertPath(record, path[depth:], binding)
+	}
+
+	if len(record) == 0 {
+		return "{=}\n"
+	}
+
+	fmt.Fprintf(&b, "in  %s\n", recordLiteral(record))
+
+	return b.String()
+}
+
+// conversionError is returned for resources that failed to convert
+type conversionError struct {
+	resources []*Resource
+	err       error
+}
+
+func (e *conversionError) Error() string {
+	return e.err.Error()
+}
+
+// convertComponent converts the resources of a component with convertResources. When the component fails to
+// convert its resources are converted one by one, to tell which of them fail.
+func convertComponent(ctx context.Context, resources []*Resource) ([]string, *conversionError) {
+	exprs, err := convertResources(ctx, resources)
+	if err == nil {
+		return exprs, nil
+	}
+	if len(resources) == 1 {
+		return nil, &conversionError{resources: resources, err: err}
+	}
+	failed := &conversionError{err: err}
+	var messages []string
+	for _, r := range resources {
+		_, rerr := convertResources(ctx, []*Resource{r})
+		if rerr != nil {
+			failed.resources = append(failed.resources, r)
+			messages = append(messages, rerr.Error())
+		}
+	}
+	if len(failed.resources) == 0 {
+		// the resources only fail together
+		failed.resources = resources
+		return nil, failed
+	}
+	failed.err = errors.New(strings.Join(messages, "\n    "))
+	return nil, failed
+}
+
+// convertResources converts resources with a single yaml-to-dhall run, as the fields of a record whose type binds
+// the k8s schemas once, and returns the expression of every resource with the map fields split off set again
+func convertResources(ctx context.Context, resources []*Resource) ([]string, error) {
+	composed := timings.track("yamlComposition")
+	contents := make(map[string]interface{})
+	maps := make([][]splitMap, len(resources))
+	var fields []string
+	for idx, r := range resources {
+		resourceContents := r.Contents
+		if r.TypeSource != "json" {
+			// json values have no record fields to update
+			resourceContents, maps[idx] = splitMapFields(r, mapFields())
+		}
+		label := resourceLabel(r)
+		contents[label] = resourceContents
+		fields = append(fields, fmt.Sprintf("%s : %s", dhallLabel(label), resourceTypeExpr(r, "")))
+	}
+	schema := fmt.Sprintf("%s { %s }", typeBindings(""), strings.Join(fields, ", "))
+	composed()
+
+	expr, err := yamlToDhall(ctx, schema, contents)
+	if err != nil && len(resources) == 1 {
+		return nil, fmt.Errorf("failed to convert %s: %v", resources[0].Source, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %d resources: %v", len(resources), err)
+	}
+
+	converted, err := splitRecordLiteral(expr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the converted record: %v", err)
+	}
+	exprs := make([]string, len(resources))
+	for idx, r := range resources {
+		resourceExpr, ok := converted[resourceLabel(r)]
+		if !ok {
+			return nil, fmt.Errorf("%s is missing from the converted record", r.Source)
+		}
+		exprs[idx], err = withMapFields(resourceExpr, maps[idx], mapValueExpr(r))
+		if err != nil {
+			return nil, fmt.Errorf("failed to compose map fields of %s: %v", r.Source, err)
+		}
+	}
+	return exprs, nil
+}
+
+// resourceLabel is the field of a resource in the record converted by convertResources, named like its binding
+func resourceLabel(r *Resource) string {
+	return strings.Join(recordPath(r), "-")
+}
+
+// splitRecordLiteral returns the fields of a dhall record literal like { a = x, `b-c` = y }, labels unquoted
+func splitRecordLiteral(expr string) (map[string]string, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "{") || !strings.HasSuffix(expr, "}") {
+		return nil, fmt.Errorf("expected a record literal")
+	}
+	body := strings.TrimSpace(expr[1 : len(expr)-1])
+	fields := make(map[string]string)
+	if body == "" || body == "=" {
+		return fields, nil
+	}
+
+	var entries []string
+	depth, start := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '"':
+			// skip the text literal, with its escapes
+			for i++; i < len(body) && body[i] != '"'; i++ {
+				if body[i] == '\\' {
+					i++
+				}
+			}
+		case strings.HasPrefix(body[i:], "''"):
+			// skip the multi-line text literal, where ''' and ''${ are escapes
+			for i += 2; i < len(body) && !strings.HasPrefix(body[i:], "''"); i++ {
+			}
+			for strings.HasPrefix(body[i:], "'''") || strings.HasPrefix(body[i:], "''${") {
+				for i += 3; i < len(body) && !strings.HasPrefix(body[i:], "''"); i++ {
+				}
+			}
+			i++
+		case body[i] == '`':
+			for i++; i < len(body) && body[i] != '`'; i++ {
+			}
+		case strings.IndexByte("([{", body[i]) >= 0:
+			depth++
+		case strings.IndexByte(")]}", body[i]) >= 0:
+			depth--
+		case body[i] == ',' && depth == 0:
+			entries = append(entries, body[start:i])
+			start = i + 1
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced brackets in the record literal")
+	}
+	entries = append(entries, body[start:])
+
+	for _, entry := range entries {
+		labels, value, err := splitRecordField(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, err
+		}
+		for i := len(labels) - 1; i > 0; i-- {
+			value = fmt.Sprintf("{ %s = %s }", dhallLabel(labels[i]), value)
+		}
+		fields[labels[0]] = value
+	}
+	return fields, nil
+}
+
+// splitRecordField splits a record literal field like a.`b-c` = x into its unquoted labels and its value
+func splitRecordField(entry string) ([]string, string, error) {
+	var labels []string
+	for {
+		var label string
+		if strings.HasPrefix(entry, "`") {
+			end := strings.IndexByte(entry[1:], '`')
+			if end < 0 {
+				return nil, "", fmt.Errorf("unterminated label in %q", entry)
+			}
+			label, entry = entry[1:end+1], entry[end+2:]
+		} else {
+			end := strings.IndexAny(entry, " \t\n.=")
+			if end <= 0 {
+				return nil, "", fmt.Errorf("expected a label in %q", entry)
+			}
+			label, entry = entry[:end], entry[end:]
+		}
+		labels = append(labels, label)
+		entry = strings.TrimSpace(entry)
+		switch {
+		case strings.HasPrefix(entry, "."):
+			entry = strings.TrimSpace(entry[1:])
+		case strings.HasPrefix(entry, "="):
+			return labels, strings.TrimSpace(entry[1:]), nil
+		default:
+			return nil, "", fmt.Errorf("expected = after %s", strings.Join(labels, "."))
+		}
+	}
+}
+
+// dhallToMap renders a text map as a toMap expression over a record literal
+func dhallToMap(m map[string]string) string {
+	exprs := make(map[string]string)
+	for k, v := range m {
+		exprs[k] = dhallText(v)
+	}
+	return dhallToMapExprs(exprs)
+}
+
+// dhallToMapExprs renders a map of dhall text expressions as a toMap expression over a record literal
+func dhallToMapExprs(m map[string]string) string {
+	if len(m) == 0 {
+		return "toMap {=} : List { mapKey : Text, mapValue : Text }"
+	}
+
+	var fields []string
+	for k, v := range m {
+		fields = append(fields, fmt.Sprintf("%s = %s", dhallLabel(k), v))
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("toMap { %s }", strings.Join(fields, ", "))
+}
+
+// dhallText renders s as a double quoted dhall text literal
+func dhallText(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '$':
+			b.WriteString(`\$`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(&b, `\u%04X`, c)
+			} else {
+				b.WriteRune(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// resourceBinding names the let binding holding the converted expression of a resource at path
+func resourceBinding(path []string) string {
+	return dhallLabel(strings.Join(path, "-"))
+}
+
+// recordLiteral renders a nested record whose leaves are binding names
+func recordLiteral(record map[string]interface{}) string {
+	var fields []string
+	for label, value := range record {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			fields = append(fields, fmt.Sprintf("%s = %s", dhallLabel(label), recordLiteral(v)))
+		default:
+			fields = append(fields, fmt.Sprintf("%s = %v", dhallLabel(label), v))
+		}
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("{ %s }", strings.Join(fields, ", "))
+}
+
+// recordTypeLiteral renders a nested record type whose leaves are type expressions
+func recordTypeLiteral(record map[string]interface{}) string {
+	var fields []string
+	for label, value := range record {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			fields = append(fields, fmt.Sprintf("%s : %s", dhallLabel(label), recordTypeLiteral(v)))
+		default:
+			fields = append(fields, fmt.Sprintf("%s : %v", dhallLabel(label), v))
+		}
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("{ %s }", strings.Join(fields, ", "))
+}
+
+func sortedComponents(rs *ResourceSet) []string {
+	var components []string
+	for component := range rs.Components {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	return components
+}
+
+// dhallReserved are the keywords and builtins that can't be used as a plain label
+var dhallReserved = map[string]bool{
+	"if": true, "then": true, "else": true, "let": true, "in": true, "using": true, "missing": true,
+	"assert": true, "as": true, "Infinity": true, "NaN": true, "merge": true, "Some": true, "toMap": true,
+	"forall": true, "with": true, "showConstructor": true,
+	"Bool": true, "Optional": true, "None": true, "Natural": true, "Integer": true, "Double": true,
+	"Text": true, "List": true, "Date": true, "Time": true, "TimeZone": true, "Bytes": true,
+	"True": true, "False": true, "Type": true, "Kind": true, "Sort": true,
+}
+
+// dhallLabel returns s as a valid dhall label, wrapping it in backticks if it isn't a plain identifier
+// (eg names containing dots or starting with a digit)
+func dhallLabel(s string) string {
+	if isSimpleDhallLabel(s) {
+		return s
+	}
+	return "`" + s + "`"
+}
+
+func isSimpleDhallLabel(s string) bool {
+	if len(s) == 0 || dhallReserved[s] {
+		return false
+	}
+
+	for idx, c := range s {
+		alpha := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+		if idx == 0 && !alpha {
+			return false
+		}
+		if !alpha && !(c >= '0' && c <= '9') && c != '-' && c != '/' {
+			return false
+		}
+	}
+	return true
+}
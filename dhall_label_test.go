@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestDhallLabel(t *testing.T) {
+	fixtures := []struct {
+		label    string
+		expected string
+	}{
+		{
+			label:    "frontend",
+			expected: "frontend",
+		},
+		{
+			label:    "indexed-search-indexer",
+			expected: "indexed-search-indexer",
+		},
+		{
+			label:    "_private",
+			expected: "_private",
+		},
+		{
+			label:    "cert-manager.io",
+			expected: "`cert-manager.io`",
+		},
+		{
+			label:    "2fa-service",
+			expected: "`2fa-service`",
+		},
+		{
+			label:    "-leading-dash",
+			expected: "`-leading-dash`",
+		},
+		{
+			label:    "system:controller:job",
+			expected: "`system:controller:job`",
+		},
+		{
+			label:    "let",
+			expected: "`let`",
+		},
+		{
+			label:    "List",
+			expected: "`List`",
+		},
+		{
+			label:    "",
+			expected: "``",
+		},
+	}
+
+	for _, fx := range fixtures {
+		got := dhallLabel(fx.label)
+		if got != fx.expected {
+			t.Errorf("expected %s, got %s for label %q", fx.expected, got, fx.label)
+		}
+	}
+}
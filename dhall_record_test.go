@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeYamlToDhall puts a yaml-to-dhall in PATH converting every top level key to the empty record, and failing on
+// inputs mentioning broken
+func fakeYamlToDhall(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\ninput=$(cat)\nif echo \"$input\" | grep -q broken; then echo 'cannot convert' >&2; exit 1; fi\n" +
+		"echo \"$input\" | awk -F: 'BEGIN { printf \"{ \" } /^[^ ]/ { printf \"%s`%s` = {=}\", sep, $1; sep = \", \" } END { print \" }\" }'\n"
+	err := ioutil.WriteFile(filepath.Join(dir, "yaml-to-dhall"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	t.Cleanup(func() { os.Setenv("PATH", path) })
+}
+
+func TestComposeDhallRecordConcurrently(t *testing.T) {
+	fakeYamlToDhall(t)
+	conversionJobs = 2
+	defer func() { conversionJobs = 0 }()
+
+	resource := func(component, kind, name string) *Resource {
+		return &Resource{Component: component, Kind: kind, Name: name, TypeSource: "json", Contents: map[string]interface{}{
+			"kind": kind, "metadata": map[string]interface{}{"name": name},
+		}}
+	}
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"frontend": {resource("frontend", "Service", "frontend"), resource("frontend", "Deployment", "frontend")},
+		"grafana":  {resource("grafana", "Service", "grafana")},
+		"zoekt":    {resource("zoekt", "Service", "zoekt")},
+	}}
+
+	record, err := composeDhallRecord(context.Background(), rs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "let Frontend-Deployment-frontend = {=}\n\nlet Frontend-Service-frontend = {=}\n\n" +
+		"let Grafana-Service-grafana = {=}\n\nlet Zoekt-Service-zoekt = {=}\n\n" +
+		"in  { Frontend = { Deployment = { frontend = Frontend-Deployment-frontend }, Service = { frontend = Frontend-Service-frontend } }, " +
+		"Grafana = { Service = { grafana = Grafana-Service-grafana } }, Zoekt = { Service = { zoekt = Zoekt-Service-zoekt } } }\n"
+	if record != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, record)
+	}
+
+	for _, component := range []string{"grafana", "zoekt"} {
+		rs.Components[component][0].Contents["metadata"] = map[string]interface{}{"name": "broken"}
+	}
+	_, err = composeDhallRecord(context.Background(), rs)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, fragment := range []string{"2 of 3 components failed", "grafana: failed to convert", "zoekt: failed to convert", "cannot convert"} {
+		if !strings.Contains(err.Error(), fragment) {
+			t.Errorf("expected %q in %v", fragment, err)
+		}
+	}
+
+	// a failing resource is pinpointed within its component
+	for _, component := range []string{"grafana", "zoekt"} {
+		rs.Components[component][0].Contents["metadata"] = map[string]interface{}{"name": component}
+	}
+	rs.Components["frontend"][1].Contents["metadata"] = map[string]interface{}{"name": "broken"}
+	rs.Components["frontend"][1].Source = "frontend/deployment.yaml"
+	_, err = composeDhallRecord(context.Background(), rs)
+	if err == nil || !strings.Contains(err.Error(), "frontend: failed to convert frontend/deployment.yaml") {
+		t.Errorf("expected the failing frontend resource to be named, got %v", err)
+	}
+	if failed, ok := err.(*conversionError); !ok || len(failed.resources) != 1 || failed.resources[0] != rs.Components["frontend"][1] {
+		t.Errorf("expected only the failing frontend resource to be reported, got %#v", err)
+	}
+}
+
+func TestSplitRecordLiteral(t *testing.T) {
+	fixtures := []struct {
+		expr     string
+		expected map[string]string
+	}{
+		{
+			expr:     "{=}",
+			expected: map[string]string{},
+		},
+		{
+			expr:     "{ a = { b = [ 1, 2 ] }, `c-d` = \"x, }\\\"y\", e.f = Some (g, h) }",
+			expected: map[string]string{"a": "{ b = [ 1, 2 ] }", "c-d": `"x, }\"y"`, "e": "{ f = Some (g, h) }"},
+		},
+		{
+			expr:     "{ data = ''\n  a, ''' }\n  ''${b}\n  '', other = 1 }",
+			expected: map[string]string{"data": "''\n  a, ''' }\n  ''${b}\n  ''", "other": "1"},
+		},
+	}
+
+	for _, fx := range fixtures {
+		got, err := splitRecordLiteral(fx.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", fx.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, fx.expected) {
+			t.Errorf("%s: expected %v, got %v", fx.expr, fx.expected, got)
+		}
+	}
+
+	for _, expr := range []string{"[ 1 ]", "{ a = (b }", "{ = 1 }"} {
+		if _, err := splitRecordLiteral(expr); err == nil {
+			t.Errorf("%s: expected an error", expr)
+		}
+	}
+}
+
+func TestComposeK8sDhallTypePerComponent(t *testing.T) {
+	resource := func(component, kind, name string) *Resource {
+		return &Resource{Component: component, Kind: kind, Name: name, Contents: map[string]interface{}{}}
+	}
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"frontend": {resource("frontend", "Service", "frontend"), resource("frontend", "Deployment", "frontend")},
+		"grafana":  {resource("grafana", "Service", "grafana")},
+	}}
+
+	dhallType := composeK8sDhallType(rs, "")
+	if count := strings.Count(dhallType, combineTypesOperator()); count != 1 {
+		t.Errorf("expected the 2 component types combined once, got %d times in %s", count, dhallType)
+	}
+	if !strings.Contains(dhallType, "{ Frontend : { Deployment : { frontend : ") {
+		t.Errorf("expected a single record type for Frontend, got %s", dhallType)
+	}
+}
+
+// BenchmarkComposeK8sDhallType compares, for a tree of 200 components of 10 resources, the record type combining a
+// nested record type per resource, as it was composed before, with the one combining a record type per component.
+// Besides the time and memory of the composition it reports the combine operators dhall has to type check.
+func BenchmarkComposeK8sDhallType(b *testing.B) {
+	rs := &ResourceSet{Components: make(map[string][]*Resource)}
+	for c := 0; c < 200; c++ {
+		component := fmt.Sprintf("component%d", c)
+		for r := 0; r < 10; r++ {
+			kind := []string{"Deployment", "Service", "ConfigMap"}[r%3]
+			rs.Components[component] = append(rs.Components[component], &Resource{
+				Component: component, Kind: kind, Name: fmt.Sprintf("%s-%d", component, r),
+				DhallType: fmt.Sprintf("%s.%s.Type", K8sBinding, kind), Contents: map[string]interface{}{},
+			})
+		}
+	}
+
+	chained := func(rs *ResourceSet, file string) string {
+		var schemas []string
+		for _, r := range sortedResources(rs) {
+			t := resourceTypeExpr(r, file)
+			path := recordPath(r)
+			for idx := len(path) - 1; idx >= 0; idx-- {
+				t = fmt.Sprintf("{ %s : %s }", dhallLabel(path[idx]), t)
+			}
+			schemas = append(schemas, t)
+		}
+		return fmt.Sprintf("%s %s", typeBindings(file), strings.Join(schemas, fmt.Sprintf(" %s ", combineTypesOperator())))
+	}
+
+	for _, bm := range []struct {
+		name    string
+		compose func(*ResourceSet, string) string
+	}{
+		{name: "per-resource", compose: chained},
+		{name: "per-component", compose: composeK8sDhallType},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var dhallType string
+			for i := 0; i < b.N; i++ {
+				dhallType = bm.compose(rs, "")
+			}
+			b.ReportMetric(float64(strings.Count(dhallType, combineTypesOperator())), "combines")
+			b.ReportMetric(float64(len(dhallType)), "type-bytes")
+		})
+	}
+}
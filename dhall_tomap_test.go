@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestDhallToMap(t *testing.T) {
+	fixtures := []struct {
+		m        map[string]string
+		expected string
+	}{
+		{
+			m:        map[string]string{},
+			expected: "toMap {=} : List { mapKey : Text, mapValue : Text }",
+		},
+		{
+			m:        map[string]string{"deploy": "sourcegraph", "app.kubernetes.io/component": "frontend"},
+			expected: "toMap { `app.kubernetes.io/component` = \"frontend\", deploy = \"sourcegraph\" }",
+		},
+		{
+			m:        map[string]string{"description": "say \"hi\"\nto ${USER}"},
+			expected: `toMap { description = "say \"hi\"\nto \${USER}" }`,
+		},
+	}
+
+	for _, fx := range fixtures {
+		got := dhallToMap(fx.m)
+		if got != fx.expected {
+			t.Errorf("expected %s, got %s", fx.expected, got)
+		}
+	}
+}
+
+func TestWithMapFields(t *testing.T) {
+	r := &Resource{
+		Kind: "Service",
+		Contents: map[string]interface{}{
+			"kind": "Service",
+			"metadata": map[string]interface{}{
+				"name":        "frontend",
+				"labels":      map[string]interface{}{"deploy": "sourcegraph"},
+				"annotations": map[string]interface{}{"description": "the web app"},
+			},
+		},
+	}
+	_, splits := splitMapFields(r, []mapField{
+		{path: []string{"metadata", "labels"}},
+		{path: []string{"metadata", "annotations"}},
+	})
+
+	got, err := withMapFields("converted", splits, func(field mapField, key, value string) (string, error) {
+		return dhallText(value), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `((converted) with metadata.labels = Some (toMap { deploy = "sourcegraph" })) with metadata.annotations = Some (toMap { description = "the web app" })`
+	if got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	flag "github.com/spf13/pflag"
+)
+
+// diffOutput is set by the diff command, which stages the outputs and compares the record with the existing one
+var diffOutput bool
+
+// resourceDiff is a resource added, removed or changed between two records
+type resourceDiff struct {
+	// group are the record keys above the kind, like the component
+	group    string
+	resource string
+	change   string
+	fields   []string
+}
+
+func runDiff(args []string) {
+	flag.CommandLine.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of ds-to-dhall diff: <conversion flags> <path>...\n")
+		fmt.Fprintln(os.Stderr, "Converts the inputs like ds-to-dhall would without touching the output files, and compares the resources")
+		fmt.Fprintln(os.Stderr, "of the new record with those of the existing --output file, exiting with 1 if they differ.")
+		fmt.Fprintln(os.Stderr, "OPTIONS:")
+		flag.PrintDefaults()
+	}
+	_ = flag.CommandLine.Parse(args)
+	diffOutput = true
+	convert()
+}
+
+// diffRecordFiles renders the existing record and the generated one and prints their differences to w, returning
+// how many resources differ. A missing existing record counts as empty.
+func diffRecordFiles(w io.Writer, existing, generated string) (int, error) {
+	before := make(map[string]interface{})
+	if _, err := os.Stat(existing); err == nil {
+		before, err = renderRecord(existing)
+		if err != nil {
+			return 0, fmt.Errorf("failed to render %s: %v", existing, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+	after, err := renderRecord(generated)
+	if err != nil {
+		return 0, fmt.Errorf("failed to render generated record: %v", err)
+	}
+
+	diffs, err := diffRecords(before, after)
+	if err != nil {
+		return 0, err
+	}
+	printRecordDiffs(w, diffs)
+	return len(diffs), nil
+}
+
+// diffRecords compares the resources of two rendered records, normalized like for --verify-roundtrip
+func diffRecords(before, after map[string]interface{}) ([]resourceDiff, error) {
+	beforeResources, err := renderedResources(before)
+	if err != nil {
+		return nil, err
+	}
+	afterResources, err := renderedResources(after)
+	if err != nil {
+		return nil, err
+	}
+
+	beforeByPath := make(map[string]renderedResource)
+	afterByPath := make(map[string]renderedResource)
+	paths := make(map[string]bool)
+	for _, r := range beforeResources {
+		beforeByPath[strings.Join(r.path, ".")] = r
+		paths[strings.Join(r.path, ".")] = true
+	}
+	for _, r := range afterResources {
+		afterByPath[strings.Join(r.path, ".")] = r
+		paths[strings.Join(r.path, ".")] = true
+	}
+
+	var diffs []resourceDiff
+	for _, path := range sortedKeys(paths) {
+		b, inBefore := beforeByPath[path]
+		a, inAfter := afterByPath[path]
+		r := a
+		if !inAfter {
+			r = b
+		}
+		diff := resourceDiff{
+			group:    strings.Join(r.path[:len(r.path)-2], "."),
+			resource: strings.Join(r.path[len(r.path)-2:], " "),
+		}
+		switch {
+		case !inBefore:
+			diff.change = "+"
+		case !inAfter:
+			diff.change = "-"
+		default:
+			diff.change = "~"
+			diff.fields = diffValues(nil, normalizeRoundtrip(b.contents), normalizeRoundtrip(a.contents))
+			if len(diff.fields) == 0 {
+				continue
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// printRecordDiffs prints the differences grouped by component, + for added resources, - for removed ones and ~
+// for changed ones followed by the changed fields
+func printRecordDiffs(w io.Writer, diffs []resourceDiff) {
+	group := ""
+	for idx, diff := range diffs {
+		if idx == 0 || diff.group != group {
+			group = diff.group
+			fmt.Fprintln(w, group)
+		}
+		fmt.Fprintf(w, "  %s %s\n", diff.change, diff.resource)
+		for _, field := range diff.fields {
+			fmt.Fprintf(w, "      %s\n", field)
+		}
+	}
+}
+
+// reportDiff compares the staged record with the configured one for the diff command and exits
+func reportDiff() {
+	existing := configuredOutput(destinationFile)
+	differences, err := diffRecordFiles(os.Stdout, existing, destinationFile)
+	removeStagedOutputs()
+	if err != nil {
+		logFatal("failed to compare records", "error", err, "destinationFile", existing)
+	}
+	if differences > 0 {
+		log15.Info("records differ", "resources", differences, "destinationFile", existing)
+		os.Exit(1)
+	}
+	log15.Info("records are the same", "destinationFile", existing)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDiffRecords(t *testing.T) {
+	decode := func(s string) map[string]interface{} {
+		var m map[string]interface{}
+		if err := yaml.Unmarshal([]byte(s), &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	before := decode(`
+Frontend:
+  ConfigMap:
+    frontend-old:
+      apiVersion: v1
+      kind: ConfigMap
+      metadata:
+        name: frontend-old
+  Deployment:
+    frontend:
+      apiVersion: apps/v1
+      kind: Deployment
+      metadata:
+        name: frontend
+      spec:
+        replicas: 1
+Grafana:
+  Service:
+    grafana:
+      apiVersion: v1
+      kind: Service
+      metadata:
+        name: grafana
+`)
+	after := decode(`
+Frontend:
+  Deployment:
+    frontend:
+      apiVersion: apps/v1
+      kind: Deployment
+      metadata:
+        name: frontend
+        labels:
+          app: frontend
+      spec:
+        replicas: 2
+  Service:
+    frontend:
+      apiVersion: v1
+      kind: Service
+      metadata:
+        name: frontend
+Grafana:
+  Service:
+    grafana:
+      apiVersion: v1
+      kind: Service
+      metadata:
+        name: grafana
+`)
+
+	diffs, err := diffRecords(before, after)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var b bytes.Buffer
+	printRecordDiffs(&b, diffs)
+	expected := `Frontend
+  - ConfigMap frontend-old
+  ~ Deployment frontend
+      .metadata.labels was added as a map
+      .spec.replicas changed from 1 to 2
+  + Service frontend
+`
+	if b.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
+
+func TestStageOutputs(t *testing.T) {
+	defer func() { destinationFile, checksumsFile, stagedOutputs = "", "", nil }()
+	destinationFile, checksumsFile = filepath.Join("deploy", "record.dhall"), "SHA256SUMS"
+
+	stageOutputs()
+	defer removeStagedOutputs()
+	// the staged outputs are laid out like the configured ones
+	rel, err := filepath.Rel(filepath.Dir(checksumsFile), destinationFile)
+	if err != nil || rel != filepath.Join("deploy", "record.dhall") || !strings.HasPrefix(destinationFile, stagingDir) {
+		t.Fatalf("unexpected staged outputs %s and %s", destinationFile, checksumsFile)
+	}
+	for file, expected := range map[string]string{
+		destinationFile:                        filepath.Join("deploy", "record.dhall"),
+		destinationFile + ".cbor":              filepath.Join("deploy", "record.dhall.cbor"),
+		filepath.Join("deploy", "other.dhall"): filepath.Join("deploy", "other.dhall"),
+	} {
+		if got := configuredOutput(file); got != expected {
+			t.Errorf("%s: expected %s, got %s", file, expected, got)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// manifestMediaTypes are accepted when resolving digests, manifest lists first so that multi-arch images
+// resolve to the digest of the list rather than the one of a single platform
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// imageReference is an image split into the parts addressing it in the registry API
+type imageReference struct {
+	registry   string
+	repository string
+	tag        string
+	digest     string
+}
+
+func parseImageReference(image string) imageReference {
+	var ref imageReference
+	qualified := qualifiedImage(image)
+	if idx := strings.Index(qualified, "@"); idx >= 0 {
+		ref.digest = qualified[idx+1:]
+		qualified = qualified[:idx]
+	}
+	slash := strings.Index(qualified, "/")
+	ref.registry, ref.repository = qualified[:slash], qualified[slash+1:]
+	if idx := strings.LastIndex(ref.repository, ":"); idx > strings.LastIndex(ref.repository, "/") {
+		ref.tag = ref.repository[idx+1:]
+		ref.repository = ref.repository[:idx]
+	}
+	if ref.tag == "" {
+		ref.tag = "latest"
+	}
+	return ref
+}
+
+// registryHost is the host serving the registry API
+func registryHost(registry string) string {
+	if registry == DefaultRegistry {
+		return "registry-1.docker.io"
+	}
+	return registry
+}
+
+// resolveDigest asks the registry for the digest of the tagged image manifest, authenticating anonymously
+// with a bearer token when the registry asks for it
+func resolveDigest(client *http.Client, ref imageReference) (string, error) {
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registryHost(ref.registry), ref.repository, ref.tag)
+
+	resp, err := headManifest(client, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := registryToken(client, resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", fmt.Errorf("failed to authenticate for %s: %v", manifestURL, err)
+		}
+		resp, err = headManifest(client, manifestURL, token)
+		if err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to resolve %s: %s", manifestURL, resp.Status)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not return a digest for %s", manifestURL)
+	}
+	return digest, nil
+}
+
+func headManifest(client *http.Client, manifestURL, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// registryToken requests an anonymous token from the realm of a Bearer challenge
+func registryToken(client *http.Client, challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	params := url.Values{}
+	var realm string
+	for _, param := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.Trim(kv[1], `"`)
+		if kv[0] == "realm" {
+			realm = value
+		} else {
+			params.Set(kv[0], value)
+		}
+	}
+	if realm == "" {
+		return "", fmt.Errorf("authentication challenge %q has no realm", challenge)
+	}
+
+	resp, err := client.Get(realm + "?" + params.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get token from %s: %s", realm, resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", err
+	}
+	if body.Token == "" {
+		return body.AccessToken, nil
+	}
+	return body.Token, nil
+}
+
+// digestCache keeps resolved digests on disk across runs, keyed by qualified image. Tags can be moved to other
+// images, so digests are resolved again once they are older than ttl.
+type digestCache struct {
+	file    string
+	ttl     time.Duration
+	client  *http.Client
+	digests map[string]cachedDigest
+	dirty   bool
+}
+
+// cachedDigest is a digest with the time it was resolved at
+type cachedDigest struct {
+	Digest   string    `json:"digest"`
+	Resolved time.Time `json:"resolved"`
+}
+
+// defaultDigestCacheFile is the cache location when --digest-cache is not given
+func defaultDigestCacheFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ds-to-dhall", "digests.json"), nil
+}
+
+// loadDigestCache reads the digests cached in file, resolving missing and expired ones with client
+func loadDigestCache(file string, ttl time.Duration, client *http.Client) (*digestCache, error) {
+	c := &digestCache{file: file, ttl: ttl, client: client, digests: make(map[string]cachedDigest)}
+	contents, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(contents, &c.digests)
+	if err != nil {
+		// caches written before digests expired map images to digests only, those are resolved again
+		var unversioned map[string]string
+		if json.Unmarshal(contents, &unversioned) != nil {
+			return nil, fmt.Errorf("failed to decode digest cache %s: %v", file, err)
+		}
+		c.digests = make(map[string]cachedDigest)
+	}
+	return c, nil
+}
+
+func (c *digestCache) save() error {
+	if !c.dirty {
+		return nil
+	}
+	contents, err := json.MarshalIndent(c.digests, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(c.file), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.file, contents, 0644)
+}
+
+// pin appends the digest of the image, resolving it when it is not cached yet. Images already pinned are kept.
+func (c *digestCache) pin(image string) (string, error) {
+	ref := parseImageReference(image)
+	if ref.digest != "" {
+		return image, nil
+	}
+
+	key := fmt.Sprintf("%s/%s:%s", ref.registry, ref.repository, ref.tag)
+	cached, ok := c.digests[key]
+	if !ok || time.Since(cached.Resolved) > c.ttl {
+		log15.Info("resolving image digest", "image", image)
+		digest, err := resolveDigest(c.client, ref)
+		if err != nil {
+			return "", err
+		}
+		cached = cachedDigest{Digest: digest, Resolved: time.Now()}
+		c.digests[key] = cached
+		c.dirty = true
+	}
+	return image + "@" + cached.Digest, nil
+}
+
+var digests *digestCache
+
+// pinImageDigests replaces the image tags of the resource with their digests
+func pinImageDigests(r *Resource) error {
+	return updateImages(r, digests.pin)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseImageReference(t *testing.T) {
+	fixtures := []struct {
+		image    string
+		expected imageReference
+	}{
+		{"nginx", imageReference{registry: "docker.io", repository: "library/nginx", tag: "latest"}},
+		{"sourcegraph/frontend:3.20", imageReference{registry: "docker.io", repository: "sourcegraph/frontend", tag: "3.20"}},
+		{"localhost:5000/app", imageReference{registry: "localhost:5000", repository: "app", tag: "latest"}},
+		{"gcr.io/app:1@sha256:abc", imageReference{registry: "gcr.io", repository: "app", tag: "1", digest: "sha256:abc"}},
+	}
+
+	for _, fx := range fixtures {
+		got := parseImageReference(fx.image)
+		if got != fx.expected {
+			t.Errorf("parseImageReference(%s): expected %+v, got %+v", fx.image, fx.expected, got)
+		}
+	}
+}
+
+func TestPinDigest(t *testing.T) {
+	var requests int
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/token":
+			fmt.Fprint(w, `{"token": "secret"}`)
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/token",service="registry"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/app/manifests/1.0":
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cacheFile := filepath.Join(t.TempDir(), "digests.json")
+	cache, err := loadDigestCache(cacheFile, time.Hour, server.Client())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	image := strings.TrimPrefix(server.URL, "https://") + "/app:1.0"
+	pinned, err := cache.pin(image)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pinned != image+"@sha256:abc" {
+		t.Errorf("expected %s@sha256:abc, got %s", image, pinned)
+	}
+
+	err = cache.save()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cache, err = loadDigestCache(cacheFile, time.Hour, server.Client())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resolved := requests
+	again, err := cache.pin(image)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again != pinned || requests != resolved {
+		t.Errorf("expected cached digest without registry requests, got %s after %d requests", again, requests-resolved)
+	}
+
+	cache, err = loadDigestCache(cacheFile, 0, server.Client())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resolved = requests
+	_, err = cache.pin(image)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests == resolved {
+		t.Errorf("expected an expired digest to be resolved again")
+	}
+
+	_, err = cache.pin(strings.TrimPrefix(server.URL, "https://") + "/missing")
+	if err == nil {
+		t.Errorf("expected an error for an unknown image")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+)
+
+// resolveDuplicates handles resources ending up at the same record path, which would otherwise overwrite each
+// other. strategy is one of error, first, last or merge, the latter strategic merging later resources into the
+// first one. Distinct record paths naming the same let binding are always errors.
+func resolveDuplicates(rs *ResourceSet, strategy string) error {
+	var ordered []*Resource
+	for _, component := range sortedComponents(rs) {
+		ordered = append(ordered, rs.Components[component]...)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Source < ordered[j].Source })
+
+	byPath := make(map[string][]*Resource)
+	var paths []string
+	for _, r := range ordered {
+		path := dhallSelector(recordPath(r))
+		if len(byPath[path]) == 0 {
+			paths = append(paths, path)
+		}
+		byPath[path] = append(byPath[path], r)
+	}
+
+	removed := make(map[*Resource]bool)
+	var duplicates loadErrors
+	for _, path := range paths {
+		resources := byPath[path]
+		if len(resources) < 2 {
+			continue
+		}
+
+		var sources []string
+		for _, r := range resources {
+			sources = append(sources, r.Source)
+		}
+
+		switch strategy {
+		case "first":
+			for _, r := range resources[1:] {
+				removed[r] = true
+			}
+		case "last":
+			for _, r := range resources[:len(resources)-1] {
+				removed[r] = true
+			}
+		case "merge":
+			for _, r := range resources[1:] {
+				resources[0].Contents = strategicMerge(resources[0].Contents, r.Contents)
+				if resources[0].Intended != nil {
+					resources[0].Intended = strategicMerge(resources[0].Intended, r.Intended)
+				}
+				removed[r] = true
+			}
+		default:
+			duplicates = append(duplicates, loadError{manifest: strings.Join(sources, ", "), err: fmt.Errorf("duplicate resources at %s", path)})
+			continue
+		}
+		log15.Warn("resolved duplicate resources", "path", path, "strategy", strategy, "sources", strings.Join(sources, ", "))
+	}
+
+	// the let bindings join the record path with -, so prod team-web and prod-team web would shadow each other
+	byBinding := make(map[string][]string)
+	var bindings []string
+	for _, path := range paths {
+		binding := resourceLabel(byPath[path][0])
+		if len(byBinding[binding]) == 0 {
+			bindings = append(bindings, binding)
+		}
+		byBinding[binding] = append(byBinding[binding], path)
+	}
+	for _, binding := range bindings {
+		if len(byBinding[binding]) < 2 {
+			continue
+		}
+		var sources []string
+		for _, path := range byBinding[binding] {
+			for _, r := range byPath[path] {
+				sources = append(sources, r.Source)
+			}
+		}
+		duplicates = append(duplicates, loadError{manifest: strings.Join(sources, ", "),
+			err: fmt.Errorf("record paths %s have the same let binding %s", strings.Join(byBinding[binding], " and "), binding)})
+	}
+
+	if len(duplicates) > 0 {
+		return duplicates
+	}
+
+	removeResources(rs, removed)
+	return nil
+}
+
+// removeResources removes the resources from the set, and the components left without resources
+func removeResources(rs *ResourceSet, removed map[*Resource]bool) {
+	for component, resources := range rs.Components {
+		var kept []*Resource
+		for _, r := range resources {
+			if !removed[r] {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) == 0 {
+			delete(rs.Components, component)
+			continue
+		}
+		rs.Components[component] = kept
+	}
+}
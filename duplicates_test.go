@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func duplicateTestSet(t *testing.T) (*ResourceSet, *Resource, *Resource) {
+	first := decodeTestResource(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  labels:
+    app: frontend
+spec:
+  type: ClusterIP
+`)
+	first.Source, first.Component = "base/frontend.yaml", "frontend"
+
+	second := decodeTestResource(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  annotations:
+    description: frontend
+spec:
+  type: NodePort
+`)
+	second.Source, second.Component = "overlay/frontend.yaml", "frontend"
+
+	return &ResourceSet{Components: map[string][]*Resource{"frontend": {second, first}}}, first, second
+}
+
+func TestResolveDuplicates(t *testing.T) {
+	rs, _, _ := duplicateTestSet(t)
+	err := resolveDuplicates(rs, "error")
+	if err == nil || !strings.Contains(err.Error(), "base/frontend.yaml, overlay/frontend.yaml") {
+		t.Errorf("expected an error naming both sources, got %v", err)
+	}
+	if _, ok := err.(loadErrors); !ok {
+		t.Errorf("expected the duplicates to be reported with the load errors, got %T", err)
+	}
+
+	for _, tc := range []struct {
+		strategy string
+		kept     func(first, second *Resource) *Resource
+	}{
+		{"first", func(first, second *Resource) *Resource { return first }},
+		{"last", func(first, second *Resource) *Resource { return second }},
+	} {
+		rs, first, second := duplicateTestSet(t)
+		err = resolveDuplicates(rs, tc.strategy)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resources := rs.Components["frontend"]
+		if len(resources) != 1 || resources[0] != tc.kept(first, second) {
+			t.Errorf("%s: expected to keep a single resource, got %v", tc.strategy, resources)
+		}
+	}
+
+	rs, first, _ := duplicateTestSet(t)
+	err = resolveDuplicates(rs, "merge")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rs.Components["frontend"]) != 1 {
+		t.Fatalf("expected a single merged resource, got %d", len(rs.Components["frontend"]))
+	}
+	assertContents(t, first, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  labels:
+    app: frontend
+  annotations:
+    description: frontend
+spec:
+  type: NodePort
+`)
+}
+
+func TestResolveDuplicatesRejectsSharedBindings(t *testing.T) {
+	defer func(c string, n bool) { componentCase, includeNamespace = c, n }(componentCase, includeNamespace)
+	componentCase, includeNamespace = "preserve", true
+
+	resource := func(source, namespace, component string) *Resource {
+		r := decodeTestResource(t, "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n  namespace: "+namespace+"\n")
+		r.Source, r.Component = source, component
+		return r
+	}
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"team-web": {resource("prod/team-web.yaml", "prod", "team-web")},
+		"web":      {resource("prod-team/web.yaml", "prod-team", "web")},
+	}}
+
+	err := resolveDuplicates(rs, "first")
+	if _, ok := err.(loadErrors); !ok || !strings.Contains(err.Error(), "prod-team/web.yaml, prod/team-web.yaml") ||
+		!strings.Contains(err.Error(), "same let binding prod-team-web-Service-web") {
+		t.Errorf("expected both resources to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReferenceRegexp matches ${VAR} references, the $VAR form is left alone since manifests embed shell scripts
+var envReferenceRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// substitutionEnv holds the variables available to --envsubst, nil when substitution is disabled
+var substitutionEnv map[string]string
+
+// loadSubstitutionEnv merges the --env-file files with the process environment, which takes precedence
+func loadSubstitutionEnv(envFiles []string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, file := range envFiles {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		vars, err := parseEnvFile(contents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid env file %s: %v", file, err)
+		}
+		for k, v := range vars {
+			env[k] = v
+		}
+	}
+	for _, kv := range os.Environ() {
+		idx := strings.Index(kv, "=")
+		if idx > 0 {
+			env[kv[:idx]] = kv[idx+1:]
+		}
+	}
+	return env, nil
+}
+
+// parseEnvFile parses KEY=VALUE lines, skipping blank lines and # comments and unquoting quoted values
+func parseEnvFile(contents []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		idx := strings.Index(line, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+		value := strings.TrimSpace(line[idx+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[strings.TrimSpace(line[:idx])] = value
+	}
+	return vars, scanner.Err()
+}
+
+// envsubst expands the ${VAR} references in the string scalars of a decoded document, keys included, failing on
+// references to undefined variables. The document is decoded first, so values can't change its structure and
+// references in comments are left alone. Plain scalars are resolved again, a plain ${REPLICAS} can become an int.
+func envsubst(doc *yaml.Node, env map[string]string) error {
+	undefined := make(map[string]bool)
+	substituteNode(doc, env, undefined)
+
+	if len(undefined) > 0 {
+		var names []string
+		for name := range undefined {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("undefined variables: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func substituteNode(node *yaml.Node, env map[string]string, undefined map[string]bool) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && strings.Contains(node.Value, "${") {
+		node.Value = envReferenceRegexp.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			name := envReferenceRegexp.FindStringSubmatch(ref)[1]
+			value, ok := env[name]
+			if !ok {
+				undefined[name] = true
+				return ref
+			}
+			return value
+		})
+		if node.Style == 0 {
+			node.Tag = ""
+			node.Tag = node.ShortTag()
+		}
+	}
+	for _, child := range node.Content {
+		substituteNode(child, env, undefined)
+	}
+}
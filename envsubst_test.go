@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	vars, err := parseEnvFile([]byte(`
+# release settings
+VERSION=3.20
+export REGISTRY="registry.internal"
+EMPTY=
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"VERSION": "3.20", "REGISTRY": "registry.internal", "EMPTY": ""}
+	for k, v := range expected {
+		if vars[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, vars[k])
+		}
+	}
+
+	_, err = parseEnvFile([]byte("NOT A VARIABLE"))
+	if err == nil {
+		t.Errorf("expected an error for a line without =")
+	}
+}
+
+func TestEnvsubst(t *testing.T) {
+	env := map[string]string{
+		"REGISTRY": "registry.internal",
+		"VERSION":  "3.20",
+		"REPLICAS": "3",
+		"PASSWORD": "p#ss: {word}\n- x",
+		"LABEL":    "team",
+	}
+
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(`# built from ${MISSING_IN_COMMENT}
+image: ${REGISTRY}/frontend:${VERSION} # tag ${ALSO_IN_COMMENT}
+replicas: ${REPLICAS}
+quoted: "${REPLICAS}"
+password: ${PASSWORD}
+${LABEL}: web
+command: echo $HOME
+`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = envsubst(&doc, env)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var actual map[string]interface{}
+	err = doc.Decode(&actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"image":    "registry.internal/frontend:3.20",
+		"replicas": 3,
+		"quoted":   "3",
+		"password": "p#ss: {word}\n- x",
+		"team":     "web",
+		"command":  "echo $HOME",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	err = yaml.Unmarshal([]byte("a: ${MISSING} ${REGISTRY}\nb: ${ALSO_MISSING}"), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = envsubst(&doc, env)
+	if err == nil || err.Error() != "undefined variables: ALSO_MISSING, MISSING" {
+		t.Errorf("expected error listing the undefined variables, got %v", err)
+	}
+}
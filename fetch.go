@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpClient makes the network requests of ds-to-dhall, a slow or stalled server fails the request instead of
+// hanging the run
+var httpClient = &http.Client{Timeout: time.Minute}
+
+// readImport reads the contents of a URL or local path, after applying the --import-map mappings which can point
+// remote imports at local copies
+func readImport(location string) ([]byte, error) {
+	location = mapImport(importMappings, location)
+	if strings.Contains(location, "://") {
+		return fetchURL(location)
+	}
+	return ioutil.ReadFile(location)
+}
+
+// fetchURL downloads the contents of a remote import
+func fetchURL(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := authHeaders(url)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
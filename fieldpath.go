@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathElem is one step of a field path: a map key, a list index or a wildcard over all list elements
+type pathElem struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// fieldPath addresses values inside resource contents, written like .spec.template.spec.containers[*].image
+// or .metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]
+type fieldPath []pathElem
+
+func (p fieldPath) String() string {
+	var b strings.Builder
+	for _, e := range p {
+		switch {
+		case e.wildcard:
+			b.WriteString("[*]")
+		case e.isIndex:
+			fmt.Fprintf(&b, "[%d]", e.index)
+		case strings.ContainsAny(e.key, ".[]\""):
+			fmt.Fprintf(&b, "[%q]", e.key)
+		default:
+			b.WriteString("." + e.key)
+		}
+	}
+	return b.String()
+}
+
+func parseFieldPath(s string) (fieldPath, error) {
+	var path fieldPath
+	rest := s
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("empty key in field path %s", s)
+			}
+			path = append(path, pathElem{key: key})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if strings.HasPrefix(rest, "[\"") {
+				end = strings.Index(rest, "\"]")
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated quoted key in field path %s", s)
+				}
+				key, err := strconv.Unquote(rest[1 : end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid quoted key in field path %s: %v", s, err)
+				}
+				path = append(path, pathElem{key: key})
+				rest = rest[end+2:]
+				continue
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated index in field path %s", s)
+			}
+			inner := rest[1:end]
+			if inner == "*" {
+				path = append(path, pathElem{wildcard: true})
+			} else {
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("invalid index %s in field path %s", inner, s)
+				}
+				path = append(path, pathElem{index: idx, isIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("field path %s must start with . or [", s)
+		}
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty field path")
+	}
+	return path, nil
+}
+
+// deletePath removes all values matched by path from v
+func deletePath(v interface{}, path fieldPath) interface{} {
+	if len(path) == 0 {
+		return v
+	}
+	e := path[0]
+	last := len(path) == 1
+
+	switch node := v.(type) {
+	case map[string]interface{}:
+		if e.isIndex || e.wildcard {
+			return node
+		}
+		if last {
+			delete(node, e.key)
+			return node
+		}
+		if child, ok := node[e.key]; ok {
+			node[e.key] = deletePath(child, path[1:])
+		}
+		return node
+	case []interface{}:
+		if !e.isIndex && !e.wildcard {
+			return node
+		}
+		if last {
+			if e.wildcard {
+				return []interface{}{}
+			}
+			if e.index < len(node) {
+				return append(node[:e.index:e.index], node[e.index+1:]...)
+			}
+			return node
+		}
+		for idx := range node {
+			if e.wildcard || idx == e.index {
+				node[idx] = deletePath(node[idx], path[1:])
+			}
+		}
+		return node
+	default:
+		return v
+	}
+}
+
+// setPath sets the values matched by path in v to value, creating missing maps along the way. With onlyMissing
+// existing values are kept, so the rule only provides a default.
+func setPath(v interface{}, path fieldPath, value interface{}, onlyMissing bool) interface{} {
+	if len(path) == 0 {
+		if onlyMissing && v != nil {
+			return v
+		}
+		return copyValue(value)
+	}
+	e := path[0]
+
+	switch node := v.(type) {
+	case nil:
+		if e.isIndex || e.wildcard {
+			return v
+		}
+		return map[string]interface{}{e.key: setPath(nil, path[1:], value, onlyMissing)}
+	case map[string]interface{}:
+		if e.isIndex || e.wildcard {
+			return node
+		}
+		node[e.key] = setPath(node[e.key], path[1:], value, onlyMissing)
+		return node
+	case []interface{}:
+		if !e.isIndex && !e.wildcard {
+			return node
+		}
+		for idx := range node {
+			if e.wildcard || idx == e.index {
+				node[idx] = setPath(node[idx], path[1:], value, onlyMissing)
+			}
+		}
+		return node
+	default:
+		return v
+	}
+}
+
+// copyValue deep copies decoded yaml so that values set on several resources don't share maps or lists
+func copyValue(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(node))
+		for k, child := range node {
+			m[k] = copyValue(child)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(node))
+		for idx, child := range node {
+			l[idx] = copyValue(child)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// updatePath replaces the existing values matched by path in v with the result of fn
+func updatePath(v interface{}, path fieldPath, fn func(interface{}) interface{}) interface{} {
+	if len(path) == 0 {
+		return fn(v)
+	}
+	e := path[0]
+
+	switch node := v.(type) {
+	case map[string]interface{}:
+		if e.isIndex || e.wildcard {
+			return node
+		}
+		if child, ok := node[e.key]; ok {
+			node[e.key] = updatePath(child, path[1:], fn)
+		}
+		return node
+	case []interface{}:
+		if !e.isIndex && !e.wildcard {
+			return node
+		}
+		for idx := range node {
+			if e.wildcard || idx == e.index {
+				node[idx] = updatePath(node[idx], path[1:], fn)
+			}
+		}
+		return node
+	default:
+		return v
+	}
+}
+
+// renamePath moves the values matched by path to the key to in their parent map
+func renamePath(v interface{}, path fieldPath, to string) interface{} {
+	last := path[len(path)-1]
+	if last.isIndex || last.wildcard {
+		return v
+	}
+	rename := func(parent interface{}) interface{} {
+		node, ok := parent.(map[string]interface{})
+		if !ok {
+			return parent
+		}
+		if value, ok := node[last.key]; ok {
+			delete(node, last.key)
+			node[to] = value
+		}
+		return node
+	}
+	return updatePath(v, path[:len(path)-1], rename)
+}
+
+// lookupPath returns the values matched by path in v, in order
+func lookupPath(v interface{}, path fieldPath) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+	e := path[0]
+
+	switch node := v.(type) {
+	case map[string]interface{}:
+		child, ok := node[e.key]
+		if e.isIndex || e.wildcard || !ok {
+			return nil
+		}
+		return lookupPath(child, path[1:])
+	case []interface{}:
+		var values []interface{}
+		for idx, child := range node {
+			if e.wildcard || (e.isIndex && idx == e.index) {
+				values = append(values, lookupPath(child, path[1:])...)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	fixtures := []struct {
+		path     string
+		expected fieldPath
+	}{
+		{
+			path:     ".spec.clusterIP",
+			expected: fieldPath{{key: "spec"}, {key: "clusterIP"}},
+		},
+		{
+			path: `.metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`,
+			expected: fieldPath{{key: "metadata"}, {key: "annotations"},
+				{key: "kubectl.kubernetes.io/last-applied-configuration"}},
+		},
+		{
+			path: ".spec.template.spec.containers[*].ports[0].name",
+			expected: fieldPath{{key: "spec"}, {key: "template"}, {key: "spec"}, {key: "containers"}, {wildcard: true},
+				{key: "ports"}, {index: 0, isIndex: true}, {key: "name"}},
+		},
+	}
+
+	for _, fx := range fixtures {
+		got, err := parseFieldPath(fx.path)
+		if err != nil {
+			t.Errorf("unexpected error parsing %s: %v", fx.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, fx.expected) {
+			t.Errorf("expected %v, got %v parsing %s", fx.expected, got, fx.path)
+		}
+		if got.String() != fx.path {
+			t.Errorf("expected %s to print as itself, got %s", fx.path, got.String())
+		}
+	}
+
+	for _, invalid := range []string{"", "spec", ".spec..x", ".a[x]", `.a["b`} {
+		_, err := parseFieldPath(invalid)
+		if err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestDeletePath(t *testing.T) {
+	r := decodeTestResource(t, `
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+        - name: a
+          imagePullPolicy: Always
+        - name: b
+          imagePullPolicy: Always
+`)
+
+	path, _ := parseFieldPath(".spec.template.spec.containers[*].imagePullPolicy")
+	deletePath(r.Contents, path)
+
+	path, _ = parseFieldPath(".spec.missing.field")
+	deletePath(r.Contents, path)
+
+	assertContents(t, r, `
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+        - name: a
+        - name: b
+`)
+}
+
+func TestSetPath(t *testing.T) {
+	r := decodeTestResource(t, `
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  revisionHistoryLimit: 3
+  template:
+    spec:
+      containers:
+        - name: a
+        - name: b
+          imagePullPolicy: Always
+`)
+
+	path, _ := parseFieldPath(".spec.revisionHistoryLimit")
+	setPath(r.Contents, path, 10, false)
+
+	path, _ = parseFieldPath(".metadata.namespace")
+	setPath(r.Contents, path, "default", true)
+
+	path, _ = parseFieldPath(".metadata.name")
+	setPath(r.Contents, path, "ignored", true)
+
+	path, _ = parseFieldPath(".spec.template.spec.containers[*].imagePullPolicy")
+	setPath(r.Contents, path, "IfNotPresent", true)
+
+	path, _ = parseFieldPath(".spec.template.metadata.labels.app")
+	setPath(r.Contents, path, "frontend", false)
+
+	assertContents(t, r, `
+kind: Deployment
+metadata:
+  name: frontend
+  namespace: default
+spec:
+  revisionHistoryLimit: 10
+  template:
+    metadata:
+      labels:
+        app: frontend
+    spec:
+      containers:
+        - name: a
+          imagePullPolicy: IfNotPresent
+        - name: b
+          imagePullPolicy: Always
+`)
+}
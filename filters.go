@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/inconshreveable/log15"
+)
+
+// filter selects the loaded resources that end up in the record, after the transforms were applied
+type filter struct {
+	name    string
+	enabled func() bool
+	keep    func(r *Resource) (bool, error)
+}
+
+// filters are applied in order, a resource is kept if every enabled filter keeps it
+var filters = []filter{
+	{name: "namespace", enabled: func() bool { return len(namespaces) > 0 }, keep: inNamespaces},
+	{name: "selector", enabled: func() bool { return len(selector) > 0 }, keep: matchesSelector},
+	{name: "secrets", enabled: func() bool { return secretsMode == "exclude" }, keep: excludeSecrets},
+	{name: "name", enabled: func() bool { return len(includeNames)+len(excludeNames) > 0 }, keep: matchesNames},
+}
+
+func applyFilters(rs *ResourceSet) error {
+	for _, f := range filters {
+		if !f.enabled() {
+			continue
+		}
+		for component, resources := range rs.Components {
+			var kept []*Resource
+			for _, r := range resources {
+				keep, err := f.keep(r)
+				if err != nil {
+					return fmt.Errorf("failed to apply %s filter to %s: %v", f.name, r.Source, err)
+				}
+				if !keep {
+					log15.Debug("filtered out resource", "filter", f.name, "manifest", r.Source, "kind", r.Kind, "name", r.Name)
+					continue
+				}
+				kept = append(kept, r)
+			}
+			if len(kept) == 0 {
+				delete(rs.Components, component)
+				continue
+			}
+			rs.Components[component] = kept
+		}
+	}
+	return nil
+}
+
+// inNamespaces keeps the namespaced resources of the --namespace namespaces, resources without namespace are in
+// --default-namespace. Cluster scoped resources belong to no namespace and are filtered out.
+func inNamespaces(r *Resource) (bool, error) {
+	if clusterScopedKinds[r.Kind] {
+		return false, nil
+	}
+	namespace := resourceNamespace(r)
+	for _, ns := range namespaces {
+		if ns == namespace {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestNamespaceFilter(t *testing.T) {
+	namespaces, defaultNamespace = []string{"staging", "default"}, "default"
+	clusterScopedKinds = map[string]bool{"ClusterRole": true}
+	defer func() { namespaces, defaultNamespace, clusterScopedKinds = nil, "", nil }()
+
+	staging := decodeTestResource(t, "kind: Service\nmetadata:\n  name: frontend\n  namespace: staging\n")
+	unqualified := decodeTestResource(t, "kind: Service\nmetadata:\n  name: gitserver\n")
+	production := decodeTestResource(t, "kind: Service\nmetadata:\n  name: frontend\n  namespace: production\n")
+	role := decodeTestResource(t, "kind: ClusterRole\nmetadata:\n  name: frontend\n")
+
+	rs := ResourceSet{Components: map[string][]*Resource{
+		"frontend":  {staging, production, role},
+		"gitserver": {unqualified},
+		"other":     {production},
+	}}
+	err := applyFilters(&rs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(rs.Components) != 2 {
+		t.Errorf("expected the emptied component to be removed, got %d components", len(rs.Components))
+	}
+	if len(rs.Components["frontend"]) != 1 || rs.Components["frontend"][0] != staging {
+		t.Errorf("expected only the staging service in frontend, got %v", rs.Components["frontend"])
+	}
+	if len(rs.Components["gitserver"]) != 1 {
+		t.Errorf("expected the service without namespace in the default namespace to be kept")
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/inconshreveable/log15"
+	flag "github.com/spf13/pflag"
+)
+
+// GoldenFiles are the generated files a golden test compares, as named in the fixture's expected directory
+var GoldenFiles = []struct {
+	flag string
+	name string
+}{
+	{flag: "--output", name: "record.dhall"},
+	{flag: "--type", name: "type.dhall"},
+	{flag: "--schema", name: "schema.dhall"},
+}
+
+func runGenTests(args []string) {
+	fs := flag.NewFlagSet("gen-tests", flag.ExitOnError)
+	dir := fs.StringP("dir", "d", "", "(required) fixture directory the inputs, conversion arguments and expected outputs are written to")
+	testFile := fs.String("test-file", "ds_to_dhall_golden_test.go", "go test file running the conversion of the fixture and comparing the outputs")
+	pkg := fs.String("package", "main", "package of the go test file")
+	var convertArgs []string
+	fs.StringArrayVar(&convertArgs, "arg", nil, "flag passed on to the conversion, eg --arg=--namespace=prod (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of ds-to-dhall gen-tests: --dir <dir> [--arg <flag>...] <path>...\n")
+		fmt.Fprintln(os.Stderr, "Copies the inputs into <dir>/inputs, converts them into the expected record, type and schema in <dir>/expected")
+		fmt.Fprintln(os.Stderr, "and writes a go test converting the inputs again with the ds-to-dhall in $PATH and comparing the outputs.")
+		fmt.Fprintln(os.Stderr, "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *dir == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	err := checkPortableArgs(convertArgs, *dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	log15.Info("copying inputs", "dir", *dir)
+	inputs, err := copyInputs(fs.Args(), filepath.Join(*dir, "inputs"))
+	if err != nil {
+		logFatal("failed to copy inputs", "error", err, "dir", *dir)
+	}
+	for idx := range inputs {
+		inputs[idx] = filepath.ToSlash(filepath.Join("inputs", inputs[idx]))
+	}
+	fixtureArgs := append(convertArgs[:len(convertArgs):len(convertArgs)], inputs...)
+	err = ioutil.WriteFile(filepath.Join(*dir, "args"), []byte(strings.Join(fixtureArgs, "\n")+"\n"), 0644)
+	if err != nil {
+		logFatal("failed to write conversion arguments", "error", err, "dir", *dir)
+	}
+
+	log15.Info("converting inputs", "dir", *dir)
+	err = convertFixture(*dir, fixtureArgs)
+	if err != nil {
+		logFatal("failed to convert inputs", "error", err, "dir", *dir)
+	}
+
+	fixture, err := filepath.Rel(filepath.Dir(*testFile), *dir)
+	if err != nil {
+		logFatal("failed to locate fixture", "error", err, "dir", *dir, "testFile", *testFile)
+	}
+	source, err := goldenTestSource(*pkg, filepath.ToSlash(fixture))
+	if err != nil {
+		logFatal("failed to compose go test", "error", err)
+	}
+	err = ioutil.WriteFile(*testFile, source, 0644)
+	if err != nil {
+		logFatal("failed to write go test", "error", err, "testFile", *testFile)
+	}
+
+	log15.Info("done", "testFile", *testFile)
+}
+
+// checkPortableArgs rejects conversion arguments naming files the fixture can't be converted with elsewhere:
+// absolute paths and paths relative to the working directory instead of the fixture directory, which the
+// conversion runs in
+func checkPortableArgs(args []string, dir string) error {
+	for _, arg := range args {
+		value := arg
+		if strings.HasPrefix(arg, "-") {
+			idx := strings.Index(arg, "=")
+			if idx < 0 {
+				continue
+			}
+			value = arg[idx+1:]
+		}
+		if value == "" {
+			continue
+		}
+		if filepath.IsAbs(value) {
+			return fmt.Errorf("--arg %s names an absolute path, copy the file into %s and pass it relative to it", arg, dir)
+		}
+		if _, err := os.Stat(filepath.Join(dir, value)); err == nil {
+			continue
+		}
+		if _, err := os.Stat(value); err == nil {
+			return fmt.Errorf("--arg %s names a path relative to the working directory, copy the file into %s and pass it relative to it", arg, dir)
+		}
+	}
+	return nil
+}
+
+// copyInputs copies the input files and directories into dir, keeping their layout relative to each other so that
+// components derived from directories stay the same. It returns the inputs relative to dir.
+func copyInputs(inputs []string, dir string) ([]string, error) {
+	pas, err := makeAbs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	var parents []string
+	for _, pa := range pas {
+		parents = append(parents, filepath.Dir(pa))
+	}
+	base, err := commonPrefix(parents)
+	if err != nil {
+		return nil, err
+	}
+
+	var copied []string
+	for _, pa := range pas {
+		rel, err := filepath.Rel(base, pa)
+		if err != nil {
+			return nil, err
+		}
+		copied = append(copied, rel)
+
+		err = filepath.Walk(pa, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			dst := filepath.Join(dir, rel)
+			err = os.MkdirAll(filepath.Dir(dst), 0755)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(dst, contents, 0644)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return copied, nil
+}
+
+// convertFixture runs this ds-to-dhall on the fixture in dir, writing the golden files to its expected directory
+func convertFixture(dir string, args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	expected, err := filepath.Abs(filepath.Join(dir, "expected"))
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(expected, 0755)
+	if err != nil {
+		return err
+	}
+
+	var outputArgs []string
+	for _, golden := range GoldenFiles {
+		outputArgs = append(outputArgs, golden.flag, filepath.Join(expected, golden.name))
+	}
+	cmd := exec.Command(executable, append(outputArgs, args...)...)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return runCommand(cmd)
+}
+
+// goldenTestTemplate is the go test of a fixture. It only depends on the standard library and skips when
+// ds-to-dhall isn't installed.
+var goldenTestTemplate = template.Must(template.New("golden").Parse(`// Code generated by ds-to-dhall gen-tests. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDsToDhallGolden(t *testing.T) {
+	binary, err := exec.LookPath("ds-to-dhall")
+	if err != nil {
+		t.Skip("ds-to-dhall is not installed")
+	}
+
+	fixture := {{ printf "%q" .Fixture }}
+	args, err := ioutil.ReadFile(filepath.Join(fixture, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	var cmdArgs []string
+{{- range .Files }}
+	cmdArgs = append(cmdArgs, {{ printf "%q" .flag }}, filepath.Join(out, {{ printf "%q" .name }}))
+{{- end }}
+	cmdArgs = append(cmdArgs, strings.Split(strings.TrimSpace(string(args)), "\n")...)
+
+	cmd := exec.Command(binary, cmdArgs...)
+	cmd.Dir = fixture
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("ds-to-dhall failed: %v\n%s", err, output)
+	}
+
+	for _, name := range []string{ {{- range $idx, $f := .Files }}{{ if $idx }}, {{ end }}{{ printf "%q" $f.name }}{{ end -}} } {
+		expected, err := ioutil.ReadFile(filepath.Join(fixture, "expected", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, expected) {
+			t.Errorf("%s differs from the expected output, run ds-to-dhall gen-tests again if the change is intended:\n%s", name, got)
+		}
+	}
+}
+`))
+
+func goldenTestSource(pkg, fixture string) ([]byte, error) {
+	var files []map[string]string
+	for _, golden := range GoldenFiles {
+		files = append(files, map[string]string{"flag": golden.flag, "name": golden.name})
+	}
+
+	var b bytes.Buffer
+	err := goldenTestTemplate.Execute(&b, struct {
+		Package string
+		Fixture string
+		Files   []map[string]string
+	}{pkg, fixture, files})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(b.Bytes())
+}
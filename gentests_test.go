@@ -0,0 +1,86 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCopyInputs(t *testing.T) {
+	src := t.TempDir()
+	for _, file := range []string{"base/frontend/deployment.yaml", "base/.ds-to-dhallignore", "overlay/service.yaml"} {
+		path := filepath.Join(src, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := t.TempDir()
+	copied, err := copyInputs([]string{filepath.Join(src, "base"), filepath.Join(src, "overlay", "service.yaml")}, dst)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"base", filepath.Join("overlay", "service.yaml")}
+	if !reflect.DeepEqual(copied, expected) {
+		t.Errorf("expected inputs %v, got %v", expected, copied)
+	}
+	for _, file := range []string{"base/frontend/deployment.yaml", "base/.ds-to-dhallignore", "overlay/service.yaml"} {
+		contents, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(file)))
+		if err != nil || string(contents) != file {
+			t.Errorf("%s: expected a copy, got %q, %v", file, contents, err)
+		}
+	}
+}
+
+func TestGoldenTestSource(t *testing.T) {
+	source, err := goldenTestSource("deploy", "testdata/golden")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "golden_test.go", source, 0)
+	if err != nil {
+		t.Fatalf("generated test does not parse: %v\n%s", err, source)
+	}
+	if f.Name.Name != "deploy" {
+		t.Errorf("expected package deploy, got %s", f.Name.Name)
+	}
+	for _, fragment := range []string{`fixture := "testdata/golden"`, `"--schema", filepath.Join(out, "schema.dhall")`, `"record.dhall", "type.dhall", "schema.dhall"`} {
+		if !strings.Contains(string(source), fragment) {
+			t.Errorf("expected %s in the generated test:\n%s", fragment, source)
+		}
+	}
+}
+
+func TestCheckPortableArgs(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "transform.yaml"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// gentests.go exists in the working directory of the test, but not in the fixture
+	fixtures := []struct {
+		args     []string
+		expected bool
+	}{
+		{args: []string{"--namespace=prod", "--strip-nulls"}, expected: true},
+		{args: []string{"--transform=transform.yaml"}, expected: true},
+		{args: []string{"--transform=" + filepath.Join(dir, "transform.yaml")}, expected: false},
+		{args: []string{"--transform", "gentests.go"}, expected: false},
+	}
+
+	for _, fx := range fixtures {
+		err := checkPortableArgs(fx.args, dir)
+		got := err == nil
+		if got != fx.expected {
+			t.Errorf("%v: expected portable %t, got %v", fx.args, fx.expected, err)
+		}
+	}
+}
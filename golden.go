@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// goldenFiles groups the resources of a rendered record by component, the record keys above the kind, into the
+// yaml file of the component, eg Frontend.yaml or prod/Frontend.yaml with --include-namespace
+func goldenFiles(resources []renderedResource) (map[string][]renderedResource, error) {
+	files := make(map[string][]renderedResource)
+	for _, r := range resources {
+		if len(r.path) < 3 {
+			return nil, fmt.Errorf("resource %s is not nested below a component", strings.Join(r.path, "."))
+		}
+		group := r.path[:len(r.path)-2]
+		for _, k := range group {
+			if k == "." || k == ".." || strings.ContainsAny(k, `/\`) {
+				return nil, fmt.Errorf("record key %q can't be used as a file name", k)
+			}
+		}
+		file := filepath.Join(group...) + ".yaml"
+		files[file] = append(files[file], r)
+	}
+	return files, nil
+}
+
+// writeGolden renders the generated record in file and writes every component as a multi document yaml file to dir
+func writeGolden(file, dir string) error {
+	record, err := renderRecord(file)
+	if err != nil {
+		return err
+	}
+	resources, err := renderedResources(record)
+	if err != nil {
+		return err
+	}
+	files, err := goldenFiles(resources)
+	if err != nil {
+		return err
+	}
+
+	for name, componentResources := range files {
+		documents, err := encodeDocuments(componentResources)
+		if err != nil {
+			return err
+		}
+		written := stageOutput(filepath.Join(dir, name))
+		err = os.MkdirAll(filepath.Dir(written), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(written, documents, 0644)
+		if err != nil {
+			return err
+		}
+		recordOutput(written)
+	}
+	return nil
+}
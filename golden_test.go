@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGoldenFiles(t *testing.T) {
+	resource := func(path ...string) renderedResource {
+		return renderedResource{path: path, contents: map[string]interface{}{"kind": path[len(path)-2]}}
+	}
+	resources := []renderedResource{
+		resource("prod", "Frontend", "Deployment", "frontend"),
+		resource("prod", "Frontend", "Service", "frontend"),
+		resource("Cluster", "ClusterRole", "frontend"),
+	}
+
+	files, err := goldenFiles(resources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string][]renderedResource{
+		filepath.Join("prod", "Frontend.yaml"): resources[:2],
+		"Cluster.yaml":                         resources[2:],
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+
+	documents, err := encodeDocuments(files[filepath.Join("prod", "Frontend.yaml")])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(documents) != "kind: Deployment\n---\nkind: Service\n" {
+		t.Errorf("unexpected documents %q", documents)
+	}
+
+	_, err = goldenFiles([]renderedResource{resource("Deployment", "frontend")})
+	if err == nil {
+		t.Error("expected an error for a resource outside of a component")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// recordPath is the sequence of labels addressing a resource in the generated type and record, by default
+// Component.Kind.Name, optionally preceded by the namespace and the system. With --cluster-scoped-key cluster
+// scoped resources are placed at <key>.Kind.Name instead.
+func recordPath(r *Resource) []string {
+	if clusterScopedKey != "" && clusterScopedKinds[r.Kind] {
+		return []string{clusterScopedKey, kindLabel(r), r.Name}
+	}
+
+	var path []string
+	if includeNamespace {
+		path = append(path, resourceNamespace(r))
+	}
+	if systemKey != "" {
+		path = append(path, componentKey(r.System))
+	}
+	return append(path, componentKey(r.Component), kindLabel(r), r.Name)
+}
+
+// kindAPIVersions holds the apiVersions each kind of the loaded resources is present at
+var kindAPIVersions map[string]map[string]bool
+
+// builtinClusterScopedKinds are the cluster scoped kinds of the Kubernetes API
+var builtinClusterScopedKinds = []string{
+	"APIService", "CertificateSigningRequest", "ClusterRole", "ClusterRoleBinding", "ComponentStatus",
+	"CSIDriver", "CSINode", "CustomResourceDefinition", "IngressClass", "MutatingWebhookConfiguration",
+	"Namespace", "Node", "PersistentVolume", "PodSecurityPolicy", "PriorityClass", "RuntimeClass",
+	"StorageClass", "ValidatingWebhookConfiguration", "VolumeAttachment",
+}
+
+// clusterScopedKinds holds the built-in cluster scoped kinds and the ones of the loaded cluster scoped CRDs
+var clusterScopedKinds map[string]bool
+
+func collectClusterScopedKinds(rs *ResourceSet) {
+	clusterScopedKinds = make(map[string]bool)
+	for _, kind := range builtinClusterScopedKinds {
+		clusterScopedKinds[kind] = true
+	}
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			if r.Kind != "CustomResourceDefinition" {
+				continue
+			}
+			spec, _ := r.Contents["spec"].(map[string]interface{})
+			names, _ := spec["names"].(map[string]interface{})
+			if kind, ok := names["kind"].(string); ok && spec["scope"] == "Cluster" {
+				clusterScopedKinds[kind] = true
+			}
+		}
+	}
+}
+
+func collectKindVersions(rs *ResourceSet) {
+	kindAPIVersions = make(map[string]map[string]bool)
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			if kindAPIVersions[r.Kind] == nil {
+				kindAPIVersions[r.Kind] = make(map[string]bool)
+			}
+			kindAPIVersions[r.Kind][r.ApiVersion] = true
+		}
+	}
+}
+
+// kindLabel is the kind level of a resource, qualified with its version depending on --kind-versions, eg
+// Ingress_v1beta1. The whole apiVersion qualifies it when the version alone is ambiguous, eg
+// Ingress_extensions_v1beta1.
+func kindLabel(r *Resource) string {
+	versions := kindAPIVersions[r.Kind]
+	if kindVersions == "none" || kindVersions == "" || (kindVersions == "conflicting" && len(versions) <= 1) {
+		return r.Kind
+	}
+
+	version := r.ApiVersion[strings.LastIndex(r.ApiVersion, "/")+1:]
+	for other := range versions {
+		if other != r.ApiVersion && other[strings.LastIndex(other, "/")+1:] == version {
+			return r.Kind + "_" + strings.NewReplacer("/", "_", ".", "_").Replace(r.ApiVersion)
+		}
+	}
+	return r.Kind + "_" + version
+}
+
+// insertPath stores leaf in the nested record at path, creating the intermediate records
+func insertPath(record map[string]interface{}, path []string, leaf interface{}) {
+	for _, label := range path[:len(path)-1] {
+		child, ok := record[label].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			record[label] = child
+		}
+		record = child
+	}
+	record[path[len(path)-1]] = leaf
+}
+
+// dhallSelector renders path as a field selection, eg Frontend.Service.`sourcegraph-frontend`
+func dhallSelector(path []string) string {
+	labels := make([]string, len(path))
+	for idx, label := range path {
+		labels[idx] = dhallLabel(label)
+	}
+	return strings.Join(labels, ".")
+}
+
+// resourceNamespace returns the namespace of a resource, --default-namespace for resources without one
+func resourceNamespace(r *Resource) string {
+	metadata, _ := r.Contents["metadata"].(map[string]interface{})
+	if namespace, ok := metadata["namespace"].(string); ok && namespace != "" {
+		return namespace
+	}
+	return defaultNamespace
+}
+
+// resourceSystem returns the value of the --system-key label or annotation of a resource
+func resourceSystem(labels, annotations map[string]interface{}) string {
+	if system, ok := labels[systemKey].(string); ok && system != "" {
+		return system
+	}
+	if system, ok := annotations[systemKey].(string); ok && system != "" {
+		return system
+	}
+	return systemDefault
+}
+
+// sortedResources returns the resources ordered by record path
+func sortedResources(rs *ResourceSet) []*Resource {
+	var resources []*Resource
+	for _, component := range sortedComponents(rs) {
+		resources = append(resources, rs.Components[component]...)
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		return strings.Join(recordPath(resources[i]), ".") < strings.Join(recordPath(resources[j]), ".")
+	})
+	return resources
+}
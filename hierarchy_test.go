@@ -0,0 +1,147 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordPathWithSystem(t *testing.T) {
+	systemKey, systemDefault = "app.kubernetes.io/part-of", "ungrouped"
+	defer func() { systemKey, systemDefault = "", "" }()
+
+	labels := map[string]interface{}{"app.kubernetes.io/part-of": "search"}
+	annotations := map[string]interface{}{"app.kubernetes.io/part-of": "ignored"}
+
+	r := &Resource{Component: "zoekt", Kind: "StatefulSet", Name: "indexed-search", System: resourceSystem(labels, annotations)}
+	expected := []string{"Search", "Zoekt", "StatefulSet", "indexed-search"}
+	if got := recordPath(r); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	r.System = resourceSystem(nil, nil)
+	expected[0] = "Ungrouped"
+	if got := recordPath(r); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestNestedRecords(t *testing.T) {
+	path := []string{"Search", "Zoekt", "StatefulSet", "indexed-search"}
+
+	record := make(map[string]interface{})
+	insertPath(record, path, "binding")
+	insertPath(record, []string{"Search", "Zoekt", "Service", "indexed-search"}, "other")
+
+	expectedLiteral := "{ Search = { Zoekt = { Service = { indexed-search = other }, StatefulSet = { indexed-search = binding } } } }"
+	if got := recordLiteral(record); got != expectedLiteral {
+		t.Errorf("expected %s, got %s", expectedLiteral, got)
+	}
+
+	types := make(map[string]interface{})
+	insertPath(types, path, "k8s.StatefulSet.Type")
+	insertPath(types, []string{"Search", "Zoekt", "Service", "indexed-search"}, "k8s.Service.Type")
+	expectedType := "{ Search : { Zoekt : { Service : { indexed-search : k8s.Service.Type }, StatefulSet : { indexed-search : k8s.StatefulSet.Type } } } }"
+	if got := recordTypeLiteral(types); got != expectedType {
+		t.Errorf("expected %s, got %s", expectedType, got)
+	}
+
+	if got := dhallSelector([]string{"Frontend", "Service", "sourcegraph.frontend"}); got != "Frontend.Service.`sourcegraph.frontend`" {
+		t.Errorf("unexpected selector %s", got)
+	}
+}
+
+func TestRecordPathWithNamespace(t *testing.T) {
+	includeNamespace, defaultNamespace = true, "default"
+	defer func() { includeNamespace, defaultNamespace = false, "" }()
+
+	r := decodeTestResource(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  namespace: staging
+`)
+	r.Component = "frontend"
+
+	expected := []string{"staging", "Frontend", "Service", "frontend"}
+	if got := recordPath(r); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	delete(r.Contents["metadata"].(map[string]interface{}), "namespace")
+	expected[0] = "default"
+	if got := recordPath(r); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestKindLabel(t *testing.T) {
+	defer func() { kindVersions, kindAPIVersions = "", nil }()
+
+	v1 := &Resource{Kind: "Ingress", ApiVersion: "networking.k8s.io/v1"}
+	beta := &Resource{Kind: "Ingress", ApiVersion: "networking.k8s.io/v1beta1"}
+	extensions := &Resource{Kind: "Ingress", ApiVersion: "extensions/v1beta1"}
+	service := &Resource{Kind: "Service", ApiVersion: "v1"}
+	collectKindVersions(&ResourceSet{Components: map[string][]*Resource{"frontend": {v1, beta, extensions, service}}})
+
+	testCases := []struct {
+		mode     string
+		r        *Resource
+		expected string
+	}{
+		{"none", v1, "Ingress"},
+		{"conflicting", v1, "Ingress_v1"},
+		{"conflicting", beta, "Ingress_networking_k8s_io_v1beta1"},
+		{"conflicting", extensions, "Ingress_extensions_v1beta1"},
+		{"conflicting", service, "Service"},
+		{"always", service, "Service_v1"},
+	}
+
+	for _, tc := range testCases {
+		kindVersions = tc.mode
+		if got := kindLabel(tc.r); got != tc.expected {
+			t.Errorf("%s %s/%s: expected %s, got %s", tc.mode, tc.r.ApiVersion, tc.r.Kind, tc.expected, got)
+		}
+	}
+}
+
+func TestRecordPathClusterScoped(t *testing.T) {
+	clusterScopedKey, includeNamespace, defaultNamespace = "Cluster", true, "default"
+	defer func() {
+		clusterScopedKey, includeNamespace, defaultNamespace, clusterScopedKinds = "", false, "", nil
+	}()
+
+	crd := decodeTestResource(t, `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: certificates.cert-manager.io
+spec:
+  scope: Cluster
+  names:
+    kind: ClusterIssuer
+`)
+	crd.Component = "cert-manager"
+	role := &Resource{Component: "frontend", Kind: "ClusterRole", Name: "frontend", Contents: map[string]interface{}{}}
+	issuer := &Resource{Component: "cert-manager", Kind: "ClusterIssuer", Name: "letsencrypt", Contents: map[string]interface{}{}}
+	service := &Resource{Component: "frontend", Kind: "Service", Name: "frontend", Contents: map[string]interface{}{}}
+	collectClusterScopedKinds(&ResourceSet{Components: map[string][]*Resource{
+		"cert-manager": {crd, issuer},
+		"frontend":     {role, service},
+	}})
+
+	testCases := []struct {
+		r        *Resource
+		expected []string
+	}{
+		{crd, []string{"Cluster", "CustomResourceDefinition", "certificates.cert-manager.io"}},
+		{role, []string{"Cluster", "ClusterRole", "frontend"}},
+		{issuer, []string{"Cluster", "ClusterIssuer", "letsencrypt"}},
+		{service, []string{"default", "Frontend", "Service", "frontend"}},
+	}
+	for _, tc := range testCases {
+		if got := recordPath(tc.r); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("expected %v, got %v", tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// ignorePattern is a parsed .gitignore pattern
+type ignorePattern struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// ignoreMatcher matches slash separated paths relative to an input root against .gitignore patterns, the last
+// matching pattern decides
+type ignoreMatcher struct {
+	patterns []ignorePattern
+}
+
+// newIgnoreMatcher parses .gitignore lines, blank lines and # comments are skipped
+func newIgnoreMatcher(lines []string) (*ignoreMatcher, error) {
+	m := &ignoreMatcher{}
+	for _, line := range lines {
+		p, ok, err := parseIgnorePattern(line)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	return m, nil
+}
+
+func parseIgnorePattern(line string) (ignorePattern, bool, error) {
+	p := ignorePattern{pattern: line}
+	line = strings.TrimRight(line, " \t")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false, nil
+	}
+
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return p, false, nil
+	}
+
+	// patterns with a slash other than a trailing one are relative to the root, others match at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return p, false, fmt.Errorf("invalid ignore pattern %q: %v", p.pattern, err)
+	}
+	p.re = re
+	return p, true, nil
+}
+
+// globToRegexp translates the .gitignore glob syntax, including ** over any number of directories
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for idx := 0; idx < len(glob); idx++ {
+		c := glob[idx]
+		switch {
+		case strings.HasPrefix(glob[idx:], "**/"):
+			b.WriteString("(?:.*/)?")
+			idx += 2
+		case strings.HasPrefix(glob[idx:], "**") && idx+2 == len(glob):
+			b.WriteString(".*")
+			idx++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.Index(glob[idx+1:], "]")
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[idx+1 : idx+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			idx += end + 1
+		case c == '\\' && idx+1 < len(glob):
+			idx++
+			b.WriteString(regexp.QuoteMeta(string(glob[idx])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// match returns whether a pattern matches the path and if so whether it is ignored or re-included by a negation
+func (m *ignoreMatcher) match(path string, isDir bool) (matched, ignored bool) {
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(path) {
+			matched, ignored = true, !p.negate
+		}
+	}
+	return matched, ignored
+}
+
+// ignored reports whether the path or one of its parent directories is ignored. As with git, files in an
+// ignored directory can't be re-included by a negation.
+func (m *ignoreMatcher) ignored(path string, isDir bool) bool {
+	parts := strings.Split(path, "/")
+	for idx := 1; idx < len(parts); idx++ {
+		if _, ignored := m.match(strings.Join(parts[:idx], "/"), true); ignored {
+			return true
+		}
+	}
+	_, ignored := m.match(path, isDir)
+	return ignored
+}
+
+// IgnoreFile is read from the input directories, holding .gitignore patterns relative to the directory
+const IgnoreFile = ".ds-to-dhallignore"
+
+var ignoreMatchers, includeMatchers *ignoreMatcher
+
+// rootIgnoreMatcher combines the patterns of the ignore file in the input directory root with the --ignore
+// patterns, which come last and so take precedence
+func rootIgnoreMatcher(root string) (*ignoreMatcher, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(root, IgnoreFile))
+	if os.IsNotExist(err) || isNotDir(err) {
+		return ignoreMatchers, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := newIgnoreMatcher(strings.Split(strings.Replace(string(contents), "\r\n", "\n", -1), "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Join(root, IgnoreFile), err)
+	}
+	if ignoreMatchers != nil {
+		m.patterns = append(m.patterns, ignoreMatchers.patterns...)
+	}
+	return m, nil
+}
+
+func isNotDir(err error) bool {
+	pathErr, ok := err.(*os.PathError)
+	return ok && pathErr.Err == syscall.ENOTDIR
+}
+
+// ignorePath reports whether path, found walking root, is ignored and not re-included by --include
+func ignorePath(ignore *ignoreMatcher, root, path string, isDir bool) (bool, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false, err
+	}
+	if rel == "." {
+		// inputs given explicitly are matched by their name
+		rel = filepath.Base(path)
+	}
+	rel = filepath.ToSlash(rel)
+
+	if ignore == nil || !ignore.ignored(rel, isDir) {
+		return false, nil
+	}
+	if includeMatchers == nil || len(includeMatchers.patterns) == 0 {
+		return true, nil
+	}
+	if isDir {
+		// keep walking ignored directories, files in them may be included
+		return false, nil
+	}
+	_, included := includeMatchers.match(rel, isDir)
+	return !included, nil
+}
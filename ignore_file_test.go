@@ -1,127 +1,125 @@
 package main
 
-import "testing"
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
 
-func TestMatchIgnore(t *testing.T) {
+func TestIgnoreMatcher(t *testing.T) {
 	fixtures := []struct {
-		pattern  string
+		patterns []string
 		path     string
+		isDir    bool
 		expected bool
 	}{
-		{
-			pattern:  "*foo.yaml",
-			path:     "/Users/uwe/work/tarfoo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "foo.yaml",
-			path:     "/Users/uwe/work/tarfoo.yaml",
-			expected: false,
-		},
-		{
-			pattern:  "foo.yaml",
-			path:     "/Users/uwe/work/foo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "*foo.yaml",
-			path:     "/Users/uwe/work/tarfoo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "tar*.yaml",
-			path:     "/Users/uwe/work/tarfoo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "tar?.yaml",
-			path:     "/Users/uwe/work/tarfoo.yaml",
-			expected: false,
-		},
-		{
-			pattern:  "wo*/*foo.yaml",
-			path:     "/Users/uwe/work/tarfoo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "uwe/work/*foo.yaml",
-			path:     "/Users/uwe/work/tarfoo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "gus/*foo.yaml",
-			path:     "/Users/uwe/work/tarfoo.yaml",
-			expected: false,
-		},
-		{
-			pattern:  "*foo.*",
-			path:     "/Users/uwe/work/tarfoo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "*foo.yaml",
-			path:     "uwe/work/tarfoo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "foo.yaml",
-			path:     "work/tarfoo.yaml",
-			expected: false,
-		},
-		{
-			pattern:  "foo.yaml",
-			path:     "uwe/work/foo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "*foo.yaml",
-			path:     "work/tarfoo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "tar*.yaml",
-			path:     "Users/uwe/work/tarfoo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "tar?.yaml",
-			path:     "Users/uwe/work/tarfoo.yaml",
-			expected: false,
-		},
-		{
-			pattern:  "wo*/*foo.yaml",
-			path:     "tarfoo.yaml",
-			expected: false,
-		},
-		{
-			pattern:  "uwe/work/*foo.yaml",
-			path:     "work/tarfoo.yaml",
-			expected: false,
-		},
-		{
-			pattern:  "gus/*foo.yaml",
-			path:     "work/tarfoo.yaml",
-			expected: false,
-		},
-		{
-			pattern:  "*foo.*",
-			path:     "work/tarfoo.yaml",
-			expected: true,
-		},
-		{
-			pattern:  "uwe/work",
-			path:     "/Users/uwe/work",
-			expected: true,
-		},
+		{patterns: []string{"*foo.yaml"}, path: "tarfoo.yaml", expected: true},
+		{patterns: []string{"*foo.yaml"}, path: "uwe/work/tarfoo.yaml", expected: true},
+		{patterns: []string{"foo.yaml"}, path: "work/tarfoo.yaml", expected: false},
+		{patterns: []string{"foo.yaml"}, path: "uwe/work/foo.yaml", expected: true},
+		{patterns: []string{"tar?.yaml"}, path: "work/tarfoo.yaml", expected: false},
+		{patterns: []string{"tar???.yaml"}, path: "work/tarfoo.yaml", expected: true},
+		{patterns: []string{"*foo.*"}, path: "work/tarfoo.yaml", expected: true},
+		{patterns: []string{"[a-c]ar.yaml"}, path: "bar.yaml", expected: true},
+		{patterns: []string{"[!a-c]ar.yaml"}, path: "bar.yaml", expected: false},
+		// a slash anchors the pattern to the input root
+		{patterns: []string{"work/*foo.yaml"}, path: "work/tarfoo.yaml", expected: true},
+		{patterns: []string{"work/*foo.yaml"}, path: "uwe/work/tarfoo.yaml", expected: false},
+		{patterns: []string{"/foo.yaml"}, path: "foo.yaml", expected: true},
+		{patterns: []string{"/foo.yaml"}, path: "work/foo.yaml", expected: false},
+		{patterns: []string{"wo*/*foo.yaml"}, path: "work/tarfoo.yaml", expected: true},
+		// * doesn't cross directories, ** does
+		{patterns: []string{"uwe/*.yaml"}, path: "uwe/work/foo.yaml", expected: false},
+		{patterns: []string{"uwe/**/*.yaml"}, path: "uwe/work/foo.yaml", expected: true},
+		{patterns: []string{"uwe/**/*.yaml"}, path: "uwe/foo.yaml", expected: true},
+		{patterns: []string{"**/test/*.yaml"}, path: "test/foo.yaml", expected: true},
+		{patterns: []string{"**/test/*.yaml"}, path: "a/b/test/foo.yaml", expected: true},
+		{patterns: []string{"uwe/**"}, path: "uwe/work/foo.yaml", expected: true},
+		// ignored directories ignore everything below them
+		{patterns: []string{"work"}, path: "uwe/work", isDir: true, expected: true},
+		{patterns: []string{"work"}, path: "uwe/work/foo.yaml", expected: true},
+		{patterns: []string{"work/"}, path: "uwe/work/foo.yaml", expected: true},
+		{patterns: []string{"foo.yaml/"}, path: "foo.yaml", expected: false},
+		// negation re-includes, the last matching pattern wins
+		{patterns: []string{"*.yaml", "!keep.yaml"}, path: "work/keep.yaml", expected: false},
+		{patterns: []string{"*.yaml", "!keep.yaml"}, path: "work/drop.yaml", expected: true},
+		{patterns: []string{"!keep.yaml", "*.yaml"}, path: "work/keep.yaml", expected: true},
+		{patterns: []string{"work/", "!work/keep.yaml"}, path: "work/keep.yaml", expected: true},
+		{patterns: []string{"# comment", "", `\#foo.yaml`}, path: "#foo.yaml", expected: true},
 	}
 
 	for _, fx := range fixtures {
-		ign, err := matchIgnore(fx.pattern, fx.path)
+		m, err := newIgnoreMatcher(fx.patterns)
 		if err != nil {
-			t.Errorf("error matching %s against pattern %s: %v", fx.path, fx.pattern, err)
+			t.Fatalf("unexpected error parsing %q: %v", fx.patterns, err)
 		}
+		ign := m.ignored(fx.path, fx.isDir)
 		if ign != fx.expected {
-			t.Errorf("extected %t, got %t matching %s against pattern %s", fx.expected, ign, fx.path, fx.pattern)
+			t.Errorf("expected %t, got %t matching %s against patterns %q", fx.expected, ign, fx.path, fx.patterns)
 		}
 	}
 }
+
+func TestIgnorePathInclude(t *testing.T) {
+	var err error
+	ignoreMatchers, err = newIgnoreMatcher([]string{"vendor/", "*.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	includeMatchers, err = newIgnoreMatcher([]string{"vendor/**/crds/*.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { ignoreMatchers, includeMatchers = nil, nil }()
+
+	fixtures := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{path: "/in/vendor", isDir: true, expected: false},
+		{path: "/in/vendor/dep/crds/widget.yaml", expected: false},
+		{path: "/in/vendor/dep/deploy.yaml", expected: true},
+		{path: "/in/app.yaml", expected: true},
+		{path: "/in/app.json", expected: false},
+	}
+	for _, fx := range fixtures {
+		ign, err := ignorePath(ignoreMatchers, "/in", fx.path, fx.isDir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ign != fx.expected {
+			t.Errorf("expected %t, got %t for %s", fx.expected, ign, fx.path)
+		}
+	}
+}
+
+func TestRootIgnoreMatcher(t *testing.T) {
+	root := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(root, IgnoreFile), []byte("# generated\nrendered/\n*.yaml\n!keep.yaml\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m *ignoreMatcher
+	ignoreMatchers, err = newIgnoreMatcher([]string{"keep.yaml"})
+	if err == nil {
+		m, err = rootIgnoreMatcher(root)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { ignoreMatchers = nil }()
+
+	for path, expected := range map[string]bool{"rendered/a.json": true, "app.yaml": true, "keep.yaml": true, "app.json": false} {
+		if got := m.ignored(path, false); got != expected {
+			t.Errorf("expected %t, got %t for %s", expected, got, path)
+		}
+	}
+
+	// file inputs have no ignore file
+	m, err = rootIgnoreMatcher(filepath.Join(root, IgnoreFile))
+	if err != nil || m != ignoreMatchers {
+		t.Errorf("expected the --ignore patterns for a file input, got %v", err)
+	}
+}
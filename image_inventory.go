@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// imageUse is a container referencing an image
+type imageUse struct {
+	Component string `yaml:"component"`
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Container string `yaml:"container"`
+}
+
+// inventoryImage is an image of the --images inventory with the containers using it
+type inventoryImage struct {
+	Image  string     `yaml:"image"`
+	UsedBy []imageUse `yaml:"usedBy"`
+}
+
+// buildImageInventory lists every image referenced by the containers of the workloads, sorted by image
+func buildImageInventory(rs *ResourceSet) []inventoryImage {
+	uses := make(map[string][]imageUse)
+	for _, r := range sortedResources(rs) {
+		for _, section := range containerSections {
+			containers := extractContainers(r, section)
+			names := make([]string, 0, len(containers))
+			for name := range containers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				image := containers[name].Image
+				if image == "" {
+					continue
+				}
+				uses[image] = append(uses[image], imageUse{Component: componentKey(r.Component), Kind: r.Kind, Name: r.Name, Container: name})
+			}
+		}
+	}
+
+	inventory := make([]inventoryImage, 0, len(uses))
+	for image, usedBy := range uses {
+		inventory = append(inventory, inventoryImage{Image: image, UsedBy: usedBy})
+	}
+	sort.Slice(inventory, func(i, j int) bool { return inventory[i].Image < inventory[j].Image })
+	return inventory
+}
+
+func writeImageInventory(rs *ResourceSet, file string) error {
+	contents, err := yaml.Marshal(buildImageInventory(rs))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, 0644)
+}
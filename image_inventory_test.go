@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildImageInventory(t *testing.T) {
+	podSpec := func(images ...string) map[string]interface{} {
+		var containers []interface{}
+		for idx, image := range images {
+			containers = append(containers, map[string]interface{}{"name": []string{"main", "sidecar"}[idx], "image": image})
+		}
+		return map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{
+			"spec": map[string]interface{}{"containers": containers},
+		}}}
+	}
+
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"frontend": {{Component: "frontend", Kind: "Deployment", Name: "frontend", Contents: podSpec("sourcegraph/frontend:3.20", "jaeger-agent:1.17")}},
+		"gitserver": {
+			{Component: "gitserver", Kind: "StatefulSet", Name: "gitserver", Contents: podSpec("sourcegraph/gitserver:3.20", "jaeger-agent:1.17")},
+			{Component: "gitserver", Kind: "Service", Name: "gitserver", Contents: map[string]interface{}{}},
+		},
+	}}
+
+	expected := []inventoryImage{
+		{Image: "jaeger-agent:1.17", UsedBy: []imageUse{
+			{Component: "Frontend", Kind: "Deployment", Name: "frontend", Container: "sidecar"},
+			{Component: "Gitserver", Kind: "StatefulSet", Name: "gitserver", Container: "sidecar"},
+		}},
+		{Image: "sourcegraph/frontend:3.20", UsedBy: []imageUse{{Component: "Frontend", Kind: "Deployment", Name: "frontend", Container: "main"}}},
+		{Image: "sourcegraph/gitserver:3.20", UsedBy: []imageUse{{Component: "Gitserver", Kind: "StatefulSet", Name: "gitserver", Container: "main"}}},
+	}
+	if got := buildImageInventory(rs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
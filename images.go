@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultRegistry is the registry of image references that don't name one
+const DefaultRegistry = "docker.io"
+
+// podSpecImages are the fields of a pod spec holding image references
+var podSpecImages = []string{
+	".containers[*].image",
+	".initContainers[*].image",
+	".ephemeralContainers[*].image",
+}
+
+// qualifiedImage expands an image reference to include its registry, like docker does: nginx is
+// docker.io/library/nginx
+func qualifiedImage(image string) string {
+	slash := strings.Index(image, "/")
+	if slash < 0 {
+		return DefaultRegistry + "/library/" + image
+	}
+	host := image[:slash]
+	if host != "localhost" && !strings.ContainsAny(host, ".:") {
+		return DefaultRegistry + "/" + image
+	}
+	return image
+}
+
+// rewriteRegistry replaces the longest rule prefix matching the qualified image, images matching no rule are
+// returned unchanged
+func rewriteRegistry(image string, rules map[string]string) string {
+	prefixes := make([]string, 0, len(rules))
+	for prefix := range rules {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	qualified := qualifiedImage(image)
+	for _, prefix := range prefixes {
+		from := strings.TrimSuffix(prefix, "/") + "/"
+		if strings.HasPrefix(qualified, from) {
+			return strings.TrimSuffix(rules[prefix], "/") + "/" + strings.TrimPrefix(qualified, from)
+		}
+	}
+	return image
+}
+
+// updateImages replaces the image references in the pod spec of workloads with the result of fn
+func updateImages(r *Resource, fn func(image string) (string, error)) error {
+	spec, ok := podSpecPath(r.Kind)
+	if !ok {
+		return nil
+	}
+
+	var err error
+	for _, field := range podSpecImages {
+		path, perr := parseFieldPath(spec.String() + field)
+		if perr != nil {
+			return perr
+		}
+		updatePath(r.Contents, path, func(v interface{}) interface{} {
+			image, ok := v.(string)
+			if !ok || err != nil {
+				return v
+			}
+			image, err = fn(image)
+			return image
+		})
+	}
+	return err
+}
+
+// rewriteImageRegistries applies the --rewrite-registry rules to the images of the resource
+func rewriteImageRegistries(r *Resource) error {
+	return updateImages(r, func(image string) (string, error) {
+		return rewriteRegistry(image, registryRewrites), nil
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestRewriteRegistry(t *testing.T) {
+	rules := map[string]string{
+		"docker.io":             "registry.internal",
+		"docker.io/sourcegraph": "registry.internal/sg",
+		"gcr.io/":               "registry.internal/gcr/",
+	}
+
+	fixtures := []struct {
+		image    string
+		expected string
+	}{
+		{"nginx:1.19", "registry.internal/library/nginx:1.19"},
+		{"redis/redis-stack", "registry.internal/redis/redis-stack"},
+		{"index.docker.io/redis", "index.docker.io/redis"},
+		{"sourcegraph/frontend:3.20@sha256:abc", "registry.internal/sg/frontend:3.20@sha256:abc"},
+		{"gcr.io/distroless/base", "registry.internal/gcr/distroless/base"},
+		{"gcr.io.example.com/base", "gcr.io.example.com/base"},
+		{"localhost:5000/app", "localhost:5000/app"},
+	}
+
+	for _, fx := range fixtures {
+		got := rewriteRegistry(fx.image, rules)
+		if got != fx.expected {
+			t.Errorf("rewriteRegistry(%s): expected %s, got %s", fx.image, fx.expected, got)
+		}
+	}
+}
+
+func TestRewriteImageRegistries(t *testing.T) {
+	registryRewrites = map[string]string{"docker.io": "registry.internal"}
+	defer func() { registryRewrites = nil }()
+
+	r := decodeTestResource(t, `
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+            - name: init
+              image: busybox
+          containers:
+            - name: backup
+              image: quay.io/backup:1.0
+`)
+
+	err := rewriteImageRegistries(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertContents(t, r, `
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+            - name: init
+              image: registry.internal/library/busybox
+          containers:
+            - name: backup
+              image: quay.io/backup:1.0
+`)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// importMapping rewrites remote imports starting with prefix to start with replacement instead
+type importMapping struct {
+	prefix      string
+	replacement string
+}
+
+func parseImportMappings(specs []string) ([]importMapping, error) {
+	var mappings []importMapping
+	for _, spec := range specs {
+		idx := strings.Index(spec, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid import mapping %q, expected <prefix>=<replacement>", spec)
+		}
+		mappings = append(mappings, importMapping{prefix: spec[:idx], replacement: spec[idx+1:]})
+	}
+	return mappings, nil
+}
+
+// mapImport applies the first matching mapping to url. Prefixes without a scheme are matched against
+// the url with its scheme stripped, so raw.githubusercontent.com=mirror.internal/dhall keeps https. Prefixes match
+// whole path segments: https://host/a maps https://host/a/b.dhall but not https://host/abc/b.dhall.
+func mapImport(mappings []importMapping, url string) string {
+	scheme := ""
+	rest := url
+	if idx := strings.Index(url, "://"); idx >= 0 {
+		scheme = url[:idx+3]
+		rest = url[idx+3:]
+	}
+
+	for _, m := range mappings {
+		if strings.Contains(m.prefix, "://") {
+			if hasPathPrefix(url, m.prefix) {
+				return m.replacement + strings.TrimPrefix(url, m.prefix)
+			}
+			continue
+		}
+		if hasPathPrefix(rest, m.prefix) {
+			return scheme + m.replacement + strings.TrimPrefix(rest, m.prefix)
+		}
+	}
+	return url
+}
+
+// hasPathPrefix reports whether s starts with prefix ending at a path segment boundary
+func hasPathPrefix(s, prefix string) bool {
+	if !strings.HasPrefix(s, prefix) {
+		return false
+	}
+	return len(s) == len(prefix) || strings.HasSuffix(prefix, "/") || s[len(prefix)] == '/'
+}
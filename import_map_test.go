@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMapImport(t *testing.T) {
+	mappings, err := parseImportMappings([]string{
+		"raw.githubusercontent.com=artifactory.internal/dhall",
+		"https://prelude.dhall-lang.org=http://mirror.internal/prelude",
+		"https://example.com/a=https://mirror.internal/a",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error parsing mappings: %v", err)
+	}
+
+	fixtures := []struct {
+		url      string
+		expected string
+	}{
+		{
+			url:      "https://raw.githubusercontent.com/dhall-lang/dhall-kubernetes/1.18/schemas.dhall",
+			expected: "https://artifactory.internal/dhall/dhall-lang/dhall-kubernetes/1.18/schemas.dhall",
+		},
+		{
+			url:      "https://prelude.dhall-lang.org/v20.0.0/package.dhall",
+			expected: "http://mirror.internal/prelude/v20.0.0/package.dhall",
+		},
+		{
+			url:      "https://example.com/schemas.dhall",
+			expected: "https://example.com/schemas.dhall",
+		},
+		{
+			url:      "https://example.com/a/schemas.dhall",
+			expected: "https://mirror.internal/a/schemas.dhall",
+		},
+		{
+			url:      "https://example.com/abc/schemas.dhall",
+			expected: "https://example.com/abc/schemas.dhall",
+		},
+		{
+			url:      "https://raw.githubusercontent.com.evil.example/schemas.dhall",
+			expected: "https://raw.githubusercontent.com.evil.example/schemas.dhall",
+		},
+	}
+
+	for _, fx := range fixtures {
+		got := mapImport(mappings, fx.url)
+		if got != fx.expected {
+			t.Errorf("expected %s, got %s", fx.expected, got)
+		}
+	}
+
+	_, err = parseImportMappings([]string{"no-replacement"})
+	if err == nil {
+		t.Errorf("expected error for mapping without =")
+	}
+}
+
+func TestReadImportMappedToLocalFile(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "schemas.dhall"), []byte("{=}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importMappings, err = parseImportMappings([]string{"https://raw.githubusercontent.com/dhall-lang/dhall-kubernetes/1.18=" + dir})
+	if err != nil {
+		t.Fatalf("unexpected error parsing mappings: %v", err)
+	}
+	defer func() { importMappings = nil }()
+
+	got, err := readImport("https://raw.githubusercontent.com/dhall-lang/dhall-kubernetes/1.18/schemas.dhall")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != "{=}" {
+		t.Errorf("expected the contents of the local copy, got %s", got)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// inferredType is the structural type of observed yaml values
+type inferredType struct {
+	// name is one of Text, Natural, Integer, Double, Bool, List or Record
+	name string
+	elem *inferredType
+	// nullableElem is set on lists with null elements
+	nullableElem bool
+	fields       map[string]*inferredType
+	optional     map[string]bool
+}
+
+// inferResourceType synthesizes a dhall type for a resource from its contents. apiVersion, kind and metadata
+// always get their k8s types, everything else is typed after the observed values.
+func inferResourceType(contents map[string]interface{}) (string, error) {
+	fields := []string{
+		"apiVersion : Text",
+		"kind : Text",
+		fmt.Sprintf("metadata : %s.ObjectMeta.Type", K8sBinding),
+	}
+
+	var names []string
+	for name := range contents {
+		if name != "apiVersion" && name != "kind" && name != "metadata" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if contents[name] == nil {
+			continue
+		}
+		t, err := inferType(contents[name])
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+		rendered, err := t.render()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+		fields = append(fields, fmt.Sprintf("%s : %s", dhallLabel(name), rendered))
+	}
+
+	return fmt.Sprintf("{ %s }", strings.Join(fields, ", ")), nil
+}
+
+func inferType(v interface{}) (*inferredType, error) {
+	switch value := v.(type) {
+	case string:
+		return &inferredType{name: "Text"}, nil
+	case bool:
+		return &inferredType{name: "Bool"}, nil
+	case int:
+		if value < 0 {
+			return &inferredType{name: "Integer"}, nil
+		}
+		return &inferredType{name: "Natural"}, nil
+	case float64:
+		return &inferredType{name: "Double"}, nil
+	case []interface{}:
+		t := &inferredType{name: "List"}
+		for idx, e := range value {
+			if e == nil {
+				t.nullableElem = true
+				continue
+			}
+			et, err := inferType(e)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", idx, err)
+			}
+			t.elem, err = mergeTypes(t.elem, et)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", idx, err)
+			}
+		}
+		return t, nil
+	case map[string]interface{}:
+		t := &inferredType{name: "Record", fields: make(map[string]*inferredType), optional: make(map[string]bool)}
+		for k, fv := range value {
+			if fv == nil {
+				continue
+			}
+			ft, err := inferType(fv)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+			t.fields[k] = ft
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("can't infer type of %T", v)
+	}
+}
+
+// mergeTypes unifies the types of two list elements. Record fields missing from either side become optional,
+// numbers widen to the more general type.
+func mergeTypes(a, b *inferredType) (*inferredType, error) {
+	if a == nil {
+		return b, nil
+	}
+	if b == nil {
+		return a, nil
+	}
+
+	numeric := map[string]int{"Natural": 1, "Integer": 2, "Double": 3}
+	if numeric[a.name] > 0 && numeric[b.name] > 0 {
+		if numeric[a.name] >= numeric[b.name] {
+			return a, nil
+		}
+		return b, nil
+	}
+
+	if a.name != b.name {
+		return nil, fmt.Errorf("mixed %s and %s values", a.name, b.name)
+	}
+
+	switch a.name {
+	case "List":
+		elem, err := mergeTypes(a.elem, b.elem)
+		if err != nil {
+			return nil, err
+		}
+		return &inferredType{name: "List", elem: elem, nullableElem: a.nullableElem || b.nullableElem}, nil
+	case "Record":
+		merged := &inferredType{name: "Record", fields: make(map[string]*inferredType), optional: make(map[string]bool)}
+		for k, ft := range a.fields {
+			bt, ok := b.fields[k]
+			if !ok {
+				merged.fields[k] = ft
+				merged.optional[k] = true
+				continue
+			}
+			mt, err := mergeTypes(ft, bt)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+			merged.fields[k] = mt
+			merged.optional[k] = a.optional[k] || b.optional[k]
+		}
+		for k, ft := range b.fields {
+			if _, ok := a.fields[k]; !ok {
+				merged.fields[k] = ft
+				merged.optional[k] = true
+			}
+		}
+		return merged, nil
+	default:
+		return a, nil
+	}
+}
+
+func (t *inferredType) render() (string, error) {
+	switch t.name {
+	case "List":
+		// lists that are empty everywhere get the empty union as element type, which types [] but no element
+		elem := "<>"
+		if t.elem != nil {
+			var err error
+			elem, err = t.elem.render()
+			if err != nil {
+				return "", err
+			}
+		}
+		if t.nullableElem {
+			elem = "Optional " + parenthesize(elem)
+		}
+		return "List " + parenthesize(elem), nil
+	case "Record":
+		var names []string
+		for name := range t.fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var fields []string
+		for _, name := range names {
+			ft, err := t.fields[name].render()
+			if err != nil {
+				return "", fmt.Errorf("%s: %v", name, err)
+			}
+			if t.optional[name] {
+				ft = "Optional " + parenthesize(ft)
+			}
+			fields = append(fields, fmt.Sprintf("%s : %s", dhallLabel(name), ft))
+		}
+		return fmt.Sprintf("{ %s }", strings.Join(fields, ", ")), nil
+	default:
+		return t.name, nil
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestInferResourceType(t *testing.T) {
+	manifest := `
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+spec:
+  replicas: 3
+  offset: -1
+  ratio: 0.5
+  enabled: true
+  removed: null
+  ports:
+    - name: http
+      port: 80
+    - name: https
+      port: 443
+      protocol: TCP
+`
+	var contents map[string]interface{}
+	err := yaml.Unmarshal([]byte(manifest), &contents)
+	if err != nil {
+		t.Fatalf("failed to decode manifest: %v", err)
+	}
+
+	got, err := inferResourceType(contents)
+	if err != nil {
+		t.Fatalf("unexpected error inferring type: %v", err)
+	}
+
+	expected := "{ apiVersion : Text, kind : Text, metadata : k8s.ObjectMeta.Type, spec : { enabled : Bool, offset : Integer, " +
+		"ports : List { name : Text, port : Natural, protocol : Optional Text }, ratio : Double, replicas : Natural } }"
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestInferTypeRejectsMixedLists(t *testing.T) {
+	_, err := inferType([]interface{}{"a", 1})
+	if err == nil {
+		t.Errorf("expected error inferring list of mixed values")
+	}
+}
+
+func TestInferEmptyAndNullableLists(t *testing.T) {
+	testCases := []struct {
+		value    interface{}
+		expected string
+	}{
+		{[]interface{}{}, "List <>"},
+		{[]interface{}{"a", nil}, "List (Optional Text)"},
+		{[]interface{}{map[string]interface{}{"args": []interface{}{}}, map[string]interface{}{"args": []interface{}{"-v"}}},
+			"List { args : List Text }"},
+	}
+
+	for _, tc := range testCases {
+		it, err := inferType(tc.value)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, err := it.render()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, got)
+		}
+	}
+}
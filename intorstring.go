@@ -0,0 +1,60 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// podSpecIntOrStringFields are the IntOrString fields of a pod spec
+var podSpecIntOrStringFields = func() []string {
+	var fields []string
+	for _, containers := range []string{".containers[*]", ".initContainers[*]"} {
+		for _, handler := range []string{".livenessProbe", ".readinessProbe", ".startupProbe", ".lifecycle.postStart", ".lifecycle.preStop"} {
+			fields = append(fields, containers+handler+".httpGet.port", containers+handler+".tcpSocket.port")
+		}
+	}
+	return fields
+}()
+
+// intOrStringFields are the IntOrString fields of kinds, in addition to the ones of their pod spec
+var intOrStringFields = map[string][]string{
+	"Service":             {".spec.ports[*].targetPort"},
+	"Deployment":          {".spec.strategy.rollingUpdate.maxUnavailable", ".spec.strategy.rollingUpdate.maxSurge"},
+	"DaemonSet":           {".spec.updateStrategy.rollingUpdate.maxUnavailable", ".spec.updateStrategy.rollingUpdate.maxSurge"},
+	"PodDisruptionBudget": {".spec.minAvailable", ".spec.maxUnavailable"},
+	"Ingress":             {".spec.backend.servicePort", ".spec.rules[*].http.paths[*].backend.servicePort"},
+	"NetworkPolicy":       {".spec.ingress[*].ports[*].port", ".spec.egress[*].ports[*].port"},
+}
+
+// numericStringRegexp matches strings holding an integer, which the API server would reject as port names
+var numericStringRegexp = regexp.MustCompile(`^[0-9]+$`)
+
+// normalizeIntOrString turns quoted integers like "8080" in IntOrString fields into integers, so that
+// yaml-to-dhall picks the Int alternative of the IntOrString union; percentages and port names stay Text
+func normalizeIntOrString(r *Resource) error {
+	fields := intOrStringFields[r.Kind]
+	if spec, ok := podSpecPath(r.Kind); ok {
+		for _, field := range podSpecIntOrStringFields {
+			fields = append(fields[:len(fields):len(fields)], spec.String()+field)
+		}
+	}
+
+	for _, field := range fields {
+		path, err := parseFieldPath(field)
+		if err != nil {
+			return err
+		}
+		updatePath(r.Contents, path, func(v interface{}) interface{} {
+			s, ok := v.(string)
+			if !ok || !numericStringRegexp.MatchString(s) {
+				return v
+			}
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				return v
+			}
+			return i
+		})
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestNormalizeIntOrString(t *testing.T) {
+	service := decodeTestResource(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+spec:
+  ports:
+    - port: 80
+      targetPort: "8080"
+    - port: 443
+      targetPort: https
+`)
+	deployment := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  strategy:
+    rollingUpdate:
+      maxSurge: "1"
+      maxUnavailable: 25%
+  template:
+    spec:
+      containers:
+        - name: frontend
+          readinessProbe:
+            httpGet:
+              port: "3080"
+          livenessProbe:
+            tcpSocket:
+              port: http
+`)
+
+	for _, r := range []*Resource{service, deployment} {
+		err := normalizeIntOrString(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	assertContents(t, service, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+spec:
+  ports:
+    - port: 80
+      targetPort: 8080
+    - port: 443
+      targetPort: https
+`)
+	assertContents(t, deployment, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  strategy:
+    rollingUpdate:
+      maxSurge: 1
+      maxUnavailable: 25%
+  template:
+    spec:
+      containers:
+        - name: frontend
+          readinessProbe:
+            httpGet:
+              port: 3080
+          livenessProbe:
+            tcpSocket:
+              port: http
+`)
+}
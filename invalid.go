@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// invalidManifestError is returned for yaml files that aren't Kubernetes manifests, lacking kind, apiVersion or
+// metadata. With --skip-invalid those files are skipped instead of failing the run.
+type invalidManifestError struct {
+	filename string
+	reason   string
+}
+
+func (e *invalidManifestError) Error() string {
+	return fmt.Sprintf("resource %s is %s", e.filename, e.reason)
+}
+
+// isInvalidManifest reports whether err is an invalidManifestError
+func isInvalidManifest(err error) bool {
+	_, ok := err.(*invalidManifestError)
+	return ok
+}
+
+// loadError is a manifest that failed to load
+type loadError struct {
+	manifest string
+	err      error
+}
+
+// loadErrors are all the manifests that failed to load, reported together so that a run lists every broken file
+// instead of stopping at the first
+type loadErrors []loadError
+
+func (e loadErrors) Error() string {
+	messages := make([]string, len(e))
+	for idx, failed := range e {
+		messages[idx] = fmt.Sprintf("%s: %v", failed.manifest, failed.err)
+	}
+	return fmt.Sprintf("%d manifests failed to load:\n  %s", len(e), strings.Join(messages, "\n  "))
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultK8sRelease is the dhall-kubernetes release assumed when it can't be derived from the schema import
+const DefaultK8sRelease = "1.18"
+
+// preferredVersions lists, per dhall-kubernetes release, the apiVersion schemas.dhall exposes for kinds that
+// are served at several apiVersions: the most stable, most recent one. Resources at any other apiVersion are typed
+// with the version specific type from the types directory next to schemas.dhall.
+var preferredVersions = releaseTables([]releaseChanges{
+	{release: "1.18", changes: map[string]string{
+		"CertificateSigningRequest":      "certificates.k8s.io/v1beta1",
+		"CronJob":                        "batch/v1beta1",
+		"CSIDriver":                      "storage.k8s.io/v1",
+		"CSINode":                        "storage.k8s.io/v1",
+		"CustomResourceDefinition":       "apiextensions.k8s.io/v1",
+		"DaemonSet":                      "apps/v1",
+		"Deployment":                     "apps/v1",
+		"Event":                          "v1",
+		"HorizontalPodAutoscaler":        "autoscaling/v1",
+		"Ingress":                        "networking.k8s.io/v1beta1",
+		"Lease":                          "coordination.k8s.io/v1",
+		"MutatingWebhookConfiguration":   "admissionregistration.k8s.io/v1",
+		"NetworkPolicy":                  "networking.k8s.io/v1",
+		"PodSecurityPolicy":              "policy/v1beta1",
+		"PriorityClass":                  "scheduling.k8s.io/v1",
+		"ReplicaSet":                     "apps/v1",
+		"RuntimeClass":                   "node.k8s.io/v1beta1",
+		"StatefulSet":                    "apps/v1",
+		"StorageClass":                   "storage.k8s.io/v1",
+		"ValidatingWebhookConfiguration": "admissionregistration.k8s.io/v1",
+		"VolumeAttachment":               "storage.k8s.io/v1",
+		"ClusterRole":                    "rbac.authorization.k8s.io/v1",
+		"ClusterRoleBinding":             "rbac.authorization.k8s.io/v1",
+		"Role":                           "rbac.authorization.k8s.io/v1",
+		"RoleBinding":                    "rbac.authorization.k8s.io/v1",
+		"APIService":                     "apiregistration.k8s.io/v1",
+	}},
+	{release: "1.19", changes: map[string]string{
+		"CertificateSigningRequest": "certificates.k8s.io/v1",
+		"Ingress":                   "networking.k8s.io/v1",
+		"IngressClass":              "networking.k8s.io/v1",
+	}},
+	{release: "1.20", changes: map[string]string{
+		"FlowSchema":                 "flowcontrol.apiserver.k8s.io/v1beta1",
+		"PriorityLevelConfiguration": "flowcontrol.apiserver.k8s.io/v1beta1",
+		"RuntimeClass":               "node.k8s.io/v1",
+	}},
+	{release: "1.21", changes: map[string]string{
+		"CronJob":             "batch/v1",
+		"CSIStorageCapacity":  "storage.k8s.io/v1beta1",
+		"EndpointSlice":       "discovery.k8s.io/v1",
+		"PodDisruptionBudget": "policy/v1",
+	}},
+	{release: "1.22"},
+	{release: "1.23", changes: map[string]string{
+		"FlowSchema":                 "flowcontrol.apiserver.k8s.io/v1beta2",
+		"HorizontalPodAutoscaler":    "autoscaling/v2",
+		"PriorityLevelConfiguration": "flowcontrol.apiserver.k8s.io/v1beta2",
+	}},
+	{release: "1.24", changes: map[string]string{
+		"CSIStorageCapacity": "storage.k8s.io/v1",
+	}},
+	{release: "1.25", changes: map[string]string{
+		"PodSecurityPolicy": "",
+	}},
+	{release: "1.26", changes: map[string]string{
+		"FlowSchema":                 "flowcontrol.apiserver.k8s.io/v1beta3",
+		"PriorityLevelConfiguration": "flowcontrol.apiserver.k8s.io/v1beta3",
+	}},
+	{release: "1.27"},
+	{release: "1.28"},
+	{release: "1.29", changes: map[string]string{
+		"FlowSchema":                 "flowcontrol.apiserver.k8s.io/v1",
+		"PriorityLevelConfiguration": "flowcontrol.apiserver.k8s.io/v1",
+	}},
+	{release: "1.30", changes: map[string]string{
+		"ValidatingAdmissionPolicy":        "admissionregistration.k8s.io/v1",
+		"ValidatingAdmissionPolicyBinding": "admissionregistration.k8s.io/v1",
+	}},
+})
+
+// releaseChanges are the kinds whose preferred apiVersion changed with a release, the empty string for kinds that
+// are served at a single apiVersion again
+type releaseChanges struct {
+	release string
+	changes map[string]string
+}
+
+// releaseTables builds the preferred versions of every release from those of the previous one and its changes
+func releaseTables(releases []releaseChanges) map[string]map[string]string {
+	tables := make(map[string]map[string]string)
+	previous := map[string]string{}
+	for _, r := range releases {
+		table := make(map[string]string)
+		for kind, apiVersion := range previous {
+			table[kind] = apiVersion
+		}
+		for kind, apiVersion := range r.changes {
+			if apiVersion == "" {
+				delete(table, kind)
+				continue
+			}
+			table[kind] = apiVersion
+		}
+		tables[r.release] = table
+		previous = table
+	}
+	return tables
+}
+
+// apiGroupPackages maps API groups to the package prefix of their definitions in the k8s OpenAPI spec,
+// which dhall-kubernetes uses to name the version specific types
+var apiGroupPackages = map[string]string{
+	"apiextensions.k8s.io":   "io.k8s.apiextensions-apiserver.pkg.apis.apiextensions",
+	"apiregistration.k8s.io": "io.k8s.kube-aggregator.pkg.apis.apiregistration",
+}
+
+// PreludeJSONType is the Prelude type resources of unknown kinds are converted to with --unknown-kind json
+const PreludeJSONType = "https://prelude.dhall-lang.org/v20.0.0/JSON/Type"
+
+// k8sVersionURLs pins the schemas.dhall of each known dhall-kubernetes release, extended and overridden
+// with --k8s-version-url
+var k8sVersionURLs = map[string]string{
+	"1.18": "https://raw.githubusercontent.com/dhall-lang/dhall-kubernetes/a4126b7f8f0c0935e4d86f0f596176c41efbe6fe/1.18/schemas.dhall",
+}
+
+// k8sReleaseBaseURL hosts the schemas.dhall of the releases that aren't pinned to a commit in k8sVersionURLs.
+// Those are pinned by their integrity hash instead, recorded by pinK8sRelease the first time they are used.
+const k8sReleaseBaseURL = "https://raw.githubusercontent.com/dhall-lang/dhall-kubernetes/master/"
+
+// resolveK8sVersion looks up the schemas.dhall URL of a dhall-kubernetes release, after applying the
+// version=url overrides
+func resolveK8sVersion(version string, overrides []string) (string, error) {
+	urls, err := k8sReleaseURLs(overrides)
+	if err != nil {
+		return "", err
+	}
+
+	u, ok := urls[version]
+	if !ok {
+		return "", fmt.Errorf("unknown k8s version %s, known versions are %s (add more with --k8s-version-url)",
+			version, strings.Join(sortedReleases(urls), ", "))
+	}
+	return u, nil
+}
+
+// k8sReleaseURLs are the schemas.dhall URLs of the pinned releases and of every release with preferred
+// versions, with the version=url overrides applied
+func k8sReleaseURLs(overrides []string) (map[string]string, error) {
+	urls := make(map[string]string)
+	for v := range preferredVersions {
+		urls[v] = k8sReleaseBaseURL + v + "/schemas.dhall"
+	}
+	for v, u := range k8sVersionURLs {
+		urls[v] = u
+	}
+	for _, o := range overrides {
+		idx := strings.Index(o, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid k8s version url %q, expected <version>=<url>", o)
+		}
+		urls[o[:idx]] = o[idx+1:]
+	}
+	return urls, nil
+}
+
+// pinK8sRelease returns the integrity hash of the schemas.dhall at url as recorded in lockFile. The hash is
+// computed with dhall hash and recorded the first time url is used, later runs import the same schemas or fail.
+func pinK8sRelease(url, lockFile string) (string, error) {
+	hashes := make(map[string]string)
+	contents, err := ioutil.ReadFile(lockFile)
+	if err == nil {
+		err = json.Unmarshal(contents, &hashes)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode %s: %v", lockFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	if hash, ok := hashes[url]; ok {
+		return hash, nil
+	}
+
+	log15.Info("pinning the integrity hash of the k8s schemas", "url", url, "lock", lockFile)
+	cmd := dhallCommand("hash")
+	cmd.Stdin = strings.NewReader(importFrom(url, ""))
+	cmd.Stderr = os.Stderr
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %v", url, err)
+	}
+	hash := strings.TrimSpace(string(out))
+	if !strings.HasPrefix(hash, "sha256:") {
+		return "", fmt.Errorf("unexpected hash of %s: %q", url, hash)
+	}
+	hashes[url] = hash
+
+	contents, err = json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(lockFile, append(contents, '\n'), 0644)
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// nearestK8sRelease returns the release with a schemas.dhall URL closest to version, the older one of two equally
+// close releases, and how many minor versions it is away from version
+func nearestK8sRelease(version string, overrides []string) (string, int, error) {
+	urls, err := k8sReleaseURLs(overrides)
+	if err != nil {
+		return "", 0, err
+	}
+	major, minor, ok := parseRelease(version)
+	if !ok {
+		return "", 0, fmt.Errorf("invalid k8s version %s, expected <major>.<minor>", version)
+	}
+
+	nearest, distance := "", 0
+	for _, release := range sortedReleases(urls) {
+		releaseMajor, releaseMinor, ok := parseRelease(release)
+		if !ok || releaseMajor != major {
+			continue
+		}
+		d := releaseMinor - minor
+		if d < 0 {
+			d = -d
+		}
+		if nearest == "" || d < distance || (d == distance && releaseMinor < minor) {
+			nearest, distance = release, d
+		}
+	}
+	if nearest == "" {
+		return "", 0, fmt.Errorf("no k8s release close to %s, known versions are %s", version, strings.Join(sortedReleases(urls), ", "))
+	}
+	return nearest, distance, nil
+}
+
+func parseRelease(version string) (int, int, bool) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+func sortedReleases(urls map[string]string) []string {
+	var releases []string
+	for v := range urls {
+		releases = append(releases, v)
+	}
+	sort.Strings(releases)
+	return releases
+}
+
+var releaseRegexp = regexp.MustCompile(`(\d+\.\d+)/schemas\.dhall$`)
+
+// k8sRelease is the dhall-kubernetes release of the configured schemas
+func k8sRelease() string {
+	if k8sVersion != "" {
+		return k8sVersion
+	}
+	imp := schemaURL
+	if schemaPath != "" {
+		imp = schemaPath
+	}
+	m := releaseRegexp.FindStringSubmatch(imp)
+	if m == nil {
+		return DefaultK8sRelease
+	}
+	return m[1]
+}
+
+// versionedTypePath returns the path, relative to schemas.dhall, of the type of kind at apiVersion if that
+// isn't the version schemas.dhall exposes, or the empty string if schemas.dhall can be used
+func versionedTypePath(release, apiVersion, kind string) string {
+	preferred, ok := preferredVersions[release][kind]
+	if !ok || preferred == apiVersion {
+		return ""
+	}
+
+	group, version := "", apiVersion
+	if idx := strings.LastIndex(apiVersion, "/"); idx >= 0 {
+		group, version = apiVersion[:idx], apiVersion[idx+1:]
+	}
+
+	pkg, ok := apiGroupPackages[group]
+	if !ok {
+		switch {
+		case group == "":
+			pkg = "io.k8s.api.core"
+		case strings.HasSuffix(group, ".k8s.io"):
+			pkg = "io.k8s.api." + strings.SplitN(group, ".", 2)[0]
+		default:
+			pkg = "io.k8s.api." + group
+		}
+	}
+
+	return fmt.Sprintf("types/%s.%s.%s.dhall", pkg, version, kind)
+}
+
+// siblingImport is an import of path relative to the directory of the k8sImport
+func siblingImport(k8sImport, path string) string {
+	idx := strings.LastIndex(k8sImport, "/")
+	if idx < 0 {
+		return "./" + path
+	}
+	return k8sImport[:idx+1] + path
+}
+
+// assignDhallTypes picks the dhall type of every resource in the set: types from the --type-map file first,
+// then types synthesized from CRDs in the set for custom resources, then the k8s schemas and additional
+// schema packages in order
+func assignDhallTypes(rs *ResourceSet) error {
+	typeMap, err := loadTypeMap(typeMapFile)
+	if err != nil {
+		return err
+	}
+	typeMapBase := ""
+	if typeMapFile != "" {
+		typeMapBase, err = filepath.Abs(filepath.Dir(typeMapFile))
+		if err != nil {
+			return err
+		}
+	}
+
+	crdTypes := collectCRDTypes(rs)
+	release := k8sRelease()
+
+	packages, err := parseSchemaPackages(schemaPackages)
+	if err != nil {
+		return err
+	}
+	k8sKinds, err := loadPackageKinds(packages, unknownKind != "fail" || validateKinds)
+	if err != nil {
+		return err
+	}
+
+	var unknown []string
+	var failed loadErrors
+
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			r.TypePath = ""
+			r.TypeBase = ""
+			if t, ok := typeMap[crdTypeKey(r.ApiVersion, r.Kind)]; ok {
+				r.DhallType = t
+				r.TypeBase = typeMapBase
+				r.TypeSource = "type-map"
+				continue
+			}
+			if t, ok := crdTypes[crdTypeKey(r.ApiVersion, r.Kind)]; ok {
+				r.DhallType = t
+				r.TypeSource = "crd"
+				continue
+			}
+			if pkg := lookupPackage(packages, r.Kind); pkg != nil {
+				r.DhallType = fmt.Sprintf("%s.%s.Type", pkg.name, dhallLabel(r.Kind))
+				r.TypeSource = pkg.name
+				continue
+			}
+			if unknownKind != "fail" && k8sKinds != nil && !k8sKinds[r.Kind] {
+				if unknownKind == "json" {
+					r.DhallType = ""
+					r.TypeSource = "json"
+				} else {
+					t, err := inferResourceType(r.Contents)
+					if err != nil {
+						failed = append(failed, loadError{manifest: r.Source, err: fmt.Errorf("failed to infer dhall type of %s: %v", r.Kind, err)})
+						continue
+					}
+					r.DhallType = t
+					r.TypeSource = "inferred"
+				}
+				unknown = append(unknown, r.Source)
+				continue
+			}
+			if k8sKinds != nil && !k8sKinds[r.Kind] {
+				failed = append(failed, loadError{manifest: r.Source, err: fmt.Errorf("kind %s/%s has no schema", r.ApiVersion, r.Kind)})
+				continue
+			}
+			r.DhallType = fmt.Sprintf("%s.%s.Type", K8sBinding, r.Kind)
+			r.TypePath = versionedTypePath(release, r.ApiVersion, r.Kind)
+			r.TypeSource = K8sBinding
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.SliceStable(failed, func(i, j int) bool { return failed[i].manifest < failed[j].manifest })
+		return failed
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		log15.Warn("resources of kinds without schema", "typed", unknownKind, "resources", unknown)
+	}
+	return nil
+}
+
+// loadTypeMap reads a yaml map of apiVersion/Kind to dhall type expressions
+func loadTypeMap(file string) (map[string]string, error) {
+	typeMap := make(map[string]string)
+	if file == "" {
+		return typeMap, nil
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(contents, &typeMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode type map %s: %v", file, err)
+	}
+
+	for key := range typeMap {
+		if strings.LastIndex(key, "/") <= 0 {
+			return nil, fmt.Errorf("invalid type map key %q in %s, expected <apiVersion>/<Kind>", key, file)
+		}
+	}
+	return typeMap, nil
+}
+
+// resourceTypeExpr is the dhall type of the resource, in terms of K8sBinding, with imports relative to
+// the generated file it is written to (the working directory if empty)
+func resourceTypeExpr(r *Resource, file string) string {
+	if r.TypeSource == "json" {
+		return importFrom(PreludeJSONType, file)
+	}
+	if r.TypeBase != "" {
+		return rebaseImports(r.DhallType, r.TypeBase, file)
+	}
+	if r.TypePath != "" {
+		return siblingImport(schemaImport(file), r.TypePath)
+	}
+	return r.DhallType
+}
+
+// rebaseImports rewrites the relative imports in expr, which are relative to baseDir, to be relative to file
+func rebaseImports(expr, baseDir, file string) string {
+	absDir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		logFatal("failed to resolve directory of generated file", "error", err, "file", file)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range localImportRegexp.FindAllStringSubmatchIndex(expr, -1) {
+		start, end := m[2], m[3]
+		b.WriteString(expr[last:start])
+
+		rel, err := filepath.Rel(absDir, filepath.Join(baseDir, filepath.FromSlash(expr[start:end])))
+		if err != nil {
+			logFatal("failed to rebase import", "error", err, "import", expr[start:end])
+		}
+		b.WriteString(dhallLocalImport(rel))
+		last = end
+	}
+	b.WriteString(expr[last:])
+
+	return b.String()
+}
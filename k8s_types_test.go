@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersionedTypePath(t *testing.T) {
+	fixtures := []struct {
+		apiVersion string
+		kind       string
+		expected   string
+	}{
+		{apiVersion: "networking.k8s.io/v1beta1", kind: "Ingress", expected: ""},
+		{apiVersion: "extensions/v1beta1", kind: "Ingress", expected: "types/io.k8s.api.extensions.v1beta1.Ingress.dhall"},
+		{apiVersion: "autoscaling/v2beta2", kind: "HorizontalPodAutoscaler", expected: "types/io.k8s.api.autoscaling.v2beta2.HorizontalPodAutoscaler.dhall"},
+		{apiVersion: "rbac.authorization.k8s.io/v1beta1", kind: "ClusterRole", expected: "types/io.k8s.api.rbac.v1beta1.ClusterRole.dhall"},
+		{apiVersion: "apiextensions.k8s.io/v1beta1", kind: "CustomResourceDefinition",
+			expected: "types/io.k8s.apiextensions-apiserver.pkg.apis.apiextensions.v1beta1.CustomResourceDefinition.dhall"},
+		{apiVersion: "events.k8s.io/v1beta1", kind: "Event", expected: "types/io.k8s.api.events.v1beta1.Event.dhall"},
+		{apiVersion: "v1", kind: "Service", expected: ""},
+	}
+
+	for _, fx := range fixtures {
+		got := versionedTypePath("1.18", fx.apiVersion, fx.kind)
+		if got != fx.expected {
+			t.Errorf("expected %q, got %q for %s %s", fx.expected, got, fx.apiVersion, fx.kind)
+		}
+	}
+}
+
+func TestSiblingImport(t *testing.T) {
+	got := siblingImport("https://example.com/dhall-kubernetes/1.18/schemas.dhall", "types/x.dhall")
+	if got != "https://example.com/dhall-kubernetes/1.18/types/x.dhall" {
+		t.Errorf("unexpected sibling of remote import: %s", got)
+	}
+	got = siblingImport("../vendor/k8s/schemas.dhall", "types/x.dhall")
+	if got != "../vendor/k8s/types/x.dhall" {
+		t.Errorf("unexpected sibling of local import: %s", got)
+	}
+}
+
+func TestResolveK8sVersion(t *testing.T) {
+	u, err := resolveK8sVersion("1.18", nil)
+	if err != nil || u != k8sVersionURLs["1.18"] {
+		t.Errorf("expected pinned 1.18 url, got %s (%v)", u, err)
+	}
+
+	u, err = resolveK8sVersion("1.24", []string{"1.24=https://mirror.internal/1.24/schemas.dhall"})
+	if err != nil || u != "https://mirror.internal/1.24/schemas.dhall" {
+		t.Errorf("expected overridden 1.24 url, got %s (%v)", u, err)
+	}
+
+	_, err = resolveK8sVersion("1.99", nil)
+	if err == nil {
+		t.Errorf("expected error for unknown version")
+	}
+
+	u, err = resolveK8sVersion("1.24", nil)
+	if err != nil || u != k8sReleaseBaseURL+"1.24/schemas.dhall" {
+		t.Errorf("expected a release with preferred versions to resolve to its schemas on master, got %s (%v)", u, err)
+	}
+}
+
+func TestPinK8sRelease(t *testing.T) {
+	bin := t.TempDir()
+	// the fake dhall hashes once, the lock must be used afterwards
+	script := "#!/bin/sh\n[ -e " + filepath.Join(bin, "hashed") + " ] && exit 1\ntouch " + filepath.Join(bin, "hashed") +
+		"\necho sha256:0123\n"
+	err := ioutil.WriteFile(filepath.Join(bin, "dhall"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	lock := filepath.Join(t.TempDir(), "k8s-versions.lock.json")
+	u := k8sReleaseBaseURL + "1.24/schemas.dhall"
+	for i := 0; i < 2; i++ {
+		hash, err := pinK8sRelease(u, lock)
+		if err != nil || hash != "sha256:0123" {
+			t.Fatalf("run %d: expected the hash of dhall hash, got %s (%v)", i, hash, err)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), `"`+u+`": "sha256:0123"`) {
+		t.Errorf("expected the hash to be recorded in the lock, got %s", contents)
+	}
+}
+
+func TestPreferredVersionsPerRelease(t *testing.T) {
+	for _, fx := range []struct {
+		release, kind, expected string
+	}{
+		{release: "1.18", kind: "HorizontalPodAutoscaler", expected: "autoscaling/v1"},
+		{release: "1.18", kind: "Ingress", expected: "networking.k8s.io/v1beta1"},
+		{release: "1.22", kind: "Ingress", expected: "networking.k8s.io/v1"},
+		{release: "1.24", kind: "HorizontalPodAutoscaler", expected: "autoscaling/v2"},
+		{release: "1.24", kind: "CronJob", expected: "batch/v1"},
+		{release: "1.24", kind: "PodSecurityPolicy", expected: "policy/v1beta1"},
+		{release: "1.25", kind: "PodSecurityPolicy", expected: ""},
+		{release: "1.30", kind: "FlowSchema", expected: "flowcontrol.apiserver.k8s.io/v1"},
+	} {
+		if got := preferredVersions[fx.release][fx.kind]; got != fx.expected {
+			t.Errorf("%s %s: expected %q, got %q", fx.release, fx.kind, fx.expected, got)
+		}
+	}
+
+	if got := versionedTypePath("1.24", "autoscaling/v1", "HorizontalPodAutoscaler"); got != "types/io.k8s.api.autoscaling.v1.HorizontalPodAutoscaler.dhall" {
+		t.Errorf("expected the v1 type of 1.24, got %s", got)
+	}
+}
+
+func TestRebaseImports(t *testing.T) {
+	expr := "(./types/Certificate.dhall).Type ⩓ { extra : ../shared/Extra.dhall, remote : https://example.com/./x.dhall }"
+	got := rebaseImports(expr, "/repo/dhall/types-map", "/repo/out/record.dhall")
+	expected := "(../dhall/types-map/types/Certificate.dhall).Type ⩓ { extra : ../dhall/shared/Extra.dhall, remote : https://example.com/./x.dhall }"
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestNearestK8sRelease(t *testing.T) {
+	overrides := []string{"1.40=https://mirror.internal/1.40/schemas.dhall"}
+	for _, fx := range []struct {
+		version, expected string
+		distance          int
+	}{
+		{version: "1.18", expected: "1.18", distance: 0},
+		{version: "1.17", expected: "1.18", distance: 1},
+		{version: "1.21", expected: "1.21", distance: 0},
+		{version: "1.31", expected: "1.30", distance: 1},
+		{version: "1.34", expected: "1.30", distance: 4},
+		{version: "1.36", expected: "1.40", distance: 4},
+	} {
+		got, distance, err := nearestK8sRelease(fx.version, overrides)
+		if err != nil || got != fx.expected || distance != fx.distance {
+			t.Errorf("%s: expected %s at %d, got %s at %d (%v)", fx.version, fx.expected, fx.distance, got, distance, err)
+		}
+	}
+
+	if _, _, err := nearestK8sRelease("2.0", nil); err == nil {
+		t.Error("expected an error for another major version")
+	}
+}
+
+func TestAssignDhallTypesFailsWhenKindsCantBeValidated(t *testing.T) {
+	defer func(path string, validate bool) { schemaPath, validateKinds = path, validate }(schemaPath, validateKinds)
+	schemaPath, validateKinds = filepath.Join(t.TempDir(), "missing", "schemas.dhall"), true
+
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"frontend": {{Component: "frontend", ApiVersion: "v1", Kind: "Service", Name: "frontend"}},
+	}}
+	err := assignDhallTypes(rs)
+	if err == nil || !strings.Contains(err.Error(), "failed to read schema package") {
+		t.Errorf("expected --validate-kinds to fail when the schemas can't be read, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kustomizationFiles are the file names kustomize recognizes
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// kustomization holds the fields of a kustomization used as component hints
+type kustomization struct {
+	NamePrefix   string            `yaml:"namePrefix"`
+	CommonLabels map[string]string `yaml:"commonLabels"`
+}
+
+// isKustomization reports whether file is a kustomization rather than a manifest
+func isKustomization(file string) bool {
+	for _, name := range kustomizationFiles {
+		if filepath.Base(file) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// kustomizationCache maps directories to their kustomization, nil for directories without one
+var kustomizationCache = make(map[string]*kustomization)
+
+func loadKustomization(dir string) (*kustomization, error) {
+	if k, ok := kustomizationCache[dir]; ok {
+		return k, nil
+	}
+
+	var k *kustomization
+	for _, name := range kustomizationFiles {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		k = &kustomization{}
+		err = yaml.Unmarshal(contents, k)
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	kustomizationCache[dir] = k
+	return k, nil
+}
+
+// kustomizationComponent derives the component of a manifest from the nearest kustomization between its
+// directory and rootDir: the component label of its commonLabels, else its namePrefix, else its directory
+func kustomizationComponent(rootDir, filename string) (string, bool, error) {
+	for dir := filepath.Dir(filename); ; dir = filepath.Dir(dir) {
+		k, err := loadKustomization(dir)
+		if err != nil {
+			return "", false, err
+		}
+		if k != nil {
+			if component := k.CommonLabels["app.kubernetes.io/component"]; component != "" {
+				return component, true, nil
+			}
+			if prefix := strings.TrimRight(k.NamePrefix, "-"); prefix != "" {
+				return prefix, true, nil
+			}
+			rel, err := filepath.Rel(rootDir, dir)
+			if err != nil {
+				return "", false, err
+			}
+			if rel == "." {
+				rel = filepath.Base(rootDir)
+			}
+			return rel, true, nil
+		}
+		if dir == rootDir || dir == filepath.Dir(dir) || !strings.HasPrefix(dir, rootDir) {
+			return "", false, nil
+		}
+	}
+}
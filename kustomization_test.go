@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKustomizationComponent(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"base/frontend/kustomization.yaml":  "namePrefix: frontend-\n",
+		"base/frontend/sub/deployment.yaml": "",
+		"base/redis/kustomization.yml":      "commonLabels:\n  app.kubernetes.io/component: redis-cache\n",
+		"base/redis/service.yaml":           "",
+		"base/plain/kustomization.yaml":     "resources: []\n",
+		"base/plain/service.yaml":           "",
+		"unkustomized/service.yaml":         "",
+	}
+	for name, contents := range files {
+		file := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(file, []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		manifest string
+		expected string
+		found    bool
+	}{
+		{"base/frontend/sub/deployment.yaml", "frontend", true},
+		{"base/redis/service.yaml", "redis-cache", true},
+		{"base/plain/service.yaml", "base/plain", true},
+		{"unkustomized/service.yaml", "", false},
+	}
+
+	for _, tc := range testCases {
+		component, found, err := kustomizationComponent(root, filepath.Join(root, tc.manifest))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if component != tc.expected || found != tc.found {
+			t.Errorf("%s: expected (%s, %t), got (%s, %t)", tc.manifest, tc.expected, tc.found, component, found)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadResourcesList(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "exported.yaml")
+	err := ioutil.WriteFile(file, []byte(`
+apiVersion: v1
+kind: List
+metadata:
+  resourceVersion: ""
+items:
+  - apiVersion: v1
+    kind: Service
+    metadata:
+      name: frontend
+      labels:
+        app.kubernetes.io/component: frontend
+  - apiVersion: apps/v1
+    kind: Deployment
+    metadata:
+      name: frontend
+      labels:
+        app.kubernetes.io/component: frontend
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err := loadResources(dir, file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+	for idx, kind := range []string{"Service", "Deployment"} {
+		r := resources[idx]
+		if r.Kind != kind || r.Name != "frontend" || r.Component != "frontend" {
+			t.Errorf("item %d: expected %s frontend in component frontend, got %s %s in %s", idx, kind, r.Kind, r.Name, r.Component)
+		}
+	}
+}
+
+func TestLoadResourcesInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"workflow.yaml": "name: ci\non: push\njobs: {}\n",
+		"values.yaml":   "- replicas: 1\n",
+		"service.yaml":  "apiVersion: v1\nkind: Service\n",
+		"list.yaml":     "apiVersion: v1\nkind: List\nitems:\n  - kind: Service\n",
+		"scalars.yaml":  "apiVersion: v1\nkind: List\nitems:\n  - frontend\n",
+	} {
+		file := filepath.Join(dir, name)
+		err := ioutil.WriteFile(file, []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = loadResources(dir, file)
+		if !isInvalidManifest(err) {
+			t.Errorf("%s: expected invalid manifest error, got %v", name, err)
+		}
+	}
+}
+
+func TestLoadResourceSetReportsEveryFailure(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"frontend.yaml": "apiVersion: v1\nkind: Service\nmetadata: {name: frontend}\n",
+		"broken.yaml":   "apiVersion: v1\nkind: [Service\n",
+		"values.yaml":   "- replicas: 1\n",
+		"unnamed.yaml":  "apiVersion: v1\nkind: Service\nmetadata: {}\n",
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := loadResourceSet([]string{dir})
+	failed, ok := err.(loadErrors)
+	if !ok {
+		t.Fatalf("expected the load errors, got %v", err)
+	}
+	var manifests []string
+	for _, f := range failed {
+		manifests = append(manifests, filepath.Base(f.manifest))
+	}
+	if strings.Join(manifests, " ") != "broken.yaml unnamed.yaml values.yaml" {
+		t.Errorf("expected every broken manifest, got %v", manifests)
+	}
+	if !strings.HasPrefix(err.Error(), "3 manifests failed to load:\n  "+filepath.Join(dir, "broken.yaml")+": ") {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+}
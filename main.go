@@ -1,15 +1,17 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -21,6 +23,12 @@ import (
 
 const GeneratedComment = "{- Generated by ds-to-dhall DO NOT EDIT -}\n\n"
 
+// DefaultSchemaURL is the pinned dhall-kubernetes schemas.dhall used unless configured otherwise
+var DefaultSchemaURL = k8sVersionURLs[DefaultK8sRelease]
+
+// K8sBinding is the name of the let binding the k8s schemas import is bound to in generated types
+const K8sBinding = "k8s"
+
 var (
 	version = "dev"
 	commit  = "unknown"
@@ -28,13 +36,114 @@ var (
 )
 
 var (
-	destinationFile string
-	typeFile        string
-	schemaFile      string
-	componentsFile  string
-	timeout         time.Duration
-	ignoreFiles     []string
-	schemaURL       string
+	destinationFile        string
+	splitDir               string
+	typeFile               string
+	schemaFile             string
+	componentsFile         string
+	typesUnionFile         string
+	toListFile             string
+	timeout                time.Duration
+	ignoreFiles            []string
+	includeFiles           []string
+	followSymlinks         bool
+	includeHidden          bool
+	skipInvalid            bool
+	changedSince           string
+	namespaces             []string
+	allNamespaces          bool
+	selectorSpec           string
+	includeNameSpecs       []string
+	excludeNameSpecs       []string
+	schemaURL              string
+	schemaPath             string
+	k8sVersion             string
+	k8sVersionURLOverrides []string
+	k8sVersionLock         string
+	schemaHash             string
+	detectK8sVersion       bool
+	k8sVersionFallback     bool
+	kubeContext            string
+	importMaps             []string
+	importMappings         []importMapping
+	asciiOutput            bool
+	componentCase          string
+	collisionSuffix        string
+	systemKey              string
+	includeNamespace       bool
+	clusterScopedKey       string
+	kindVersions           string
+	defaultNamespace       string
+	kustomizationHints     bool
+	ownerComponents        bool
+	generateNameSuffix     string
+	onDuplicate            string
+	secretsMode            string
+	secretEnvMapFile       string
+	decodeSecrets          bool
+	checksumsFile          string
+	offline                bool
+	auditLogFile           string
+	policyDir              string
+	rbacSummaryFile        string
+	componentsFormat       string
+	componentsSchema       int
+	imagesFile             string
+	capacityFile           string
+	portsFile              string
+	verifyRoundtrip        bool
+	validate               bool
+	checkOutputs           bool
+	goldenDir              string
+	conversionJobs         int
+	maxProcs               int
+	minFreeMemory          string
+	conversionCacheDir     string
+	noConversionCache      bool
+	cpuProfileFile         string
+	memProfileFile         string
+	traceFile              string
+	reportFile             string
+	validateSchemas        []string
+	signKeyFile            string
+	signKeyless            bool
+	encodeSecrets          bool
+	systemDefault          string
+
+	resolveImports    bool
+	lintOutput        bool
+	normalizeOutput   bool
+	outputEncoding    string
+	typeCheck         bool
+	typeMapFile       string
+	schemaPackages    []string
+	unknownKind       string
+	inferUnknownTypes bool
+	validateKinds     bool
+
+	configFile        string
+	stripServerFields bool
+	stripNulls        bool
+	yaml11Scalars     bool
+	dropSpecs         []string
+	transformFile     string
+	builtinPatches    bool
+	patchLocations    []string
+	substituteEnv     bool
+	envFiles          []string
+	addLabels         map[string]string
+	addAnnotations    map[string]string
+	addToTemplates    bool
+	namePrefix        string
+	nameSuffix        string
+	registryRewrites  map[string]string
+	pinDigests        bool
+	digestCacheFile   string
+	digestCacheTTL    time.Duration
+
+	configMapDataToMap     bool
+	configMapDataDir       string
+	configMapDataThreshold int
 
 	printHelp    bool
 	printVersion bool
@@ -42,13 +151,166 @@ var (
 
 func init() {
 	flag.StringVarP(&destinationFile, "output", "o", "", "(required) dhall output file")
+	flag.StringVar(&splitDir, "split-dir", "",
+		"directory to write the record of every component to its own file in, imported by the output file, regenerating only the components whose inputs changed since the previous run")
 	flag.StringVarP(&typeFile, "type", "t", "", "dhall output type file")
 	flag.StringVarP(&schemaFile, "schema", "s", "", "dhall output schema file")
-	flag.StringVarP(&componentsFile, "components", "c", "", "components yaml output file")
-	flag.DurationVar(&timeout, "timeout", 3*time.Minute, "length of time to run yaml-to-dhall command before timing out")
-	flag.StringArrayVarP(&ignoreFiles, "ignore", "i", nil, "input files matching glob pattern will be ignored")
-	flag.StringVarP(&schemaURL, "k8sSchemaURL", "u",
-		"https://raw.githubusercontent.com/dhall-lang/dhall-kubernetes/a4126b7f8f0c0935e4d86f0f596176c41efbe6fe/1.18/schemas.dhall", "URL to k8s schemas.dhall file")
+	flag.StringVarP(&componentsFile, "components", "c", "", "components output file, see --components-format")
+	flag.StringVar(&componentsFormat, "components-format", "yaml", "format of the --components output (yaml|json|toml)")
+	flag.IntVar(&componentsSchema, "components-schema", 1,
+		"schema version of the --components output, 1 for the record shaped listing of containers, 2 for the listing per component")
+	flag.StringVar(&imagesFile, "images", "", "yaml output file listing every container image with the workloads and containers using it")
+	flag.StringVar(&capacityFile, "capacity", "",
+		"yaml output file totaling the resource requests and limits of the workloads per component and overall, accounting for replicas")
+	flag.BoolVar(&verifyRoundtrip, "verify-roundtrip", false,
+		"render the generated record back to yaml with dhall-to-yaml and fail on differences with the yaml it was generated from")
+	flag.StringVar(&goldenDir, "golden", "",
+		"directory the generated record is rendered to with dhall-to-yaml, a multi document yaml file per component, as fixtures for consumers")
+	flag.BoolVar(&checkOutputs, "check", false,
+		"generate the outputs aside and fail listing the output files that are missing or stale, without touching them")
+	flag.BoolVar(&validate, "validate", false,
+		"validate the resources against the Kubernetes json schemas of the targeted release with kubeconform, and the rendered record too with --verify-roundtrip")
+	flag.StringArrayVar(&validateSchemas, "validate-schema-location", nil,
+		"kubeconform schema location for --validate, eg a local mirror of the Kubernetes json schemas (default the kubeconform default)")
+	flag.StringVar(&portsFile, "ports", "",
+		"yaml output file listing the container and Service ports, flagging reused NodePorts and host ports and Service targetPorts matching no containerPort")
+	flag.StringVar(&typesUnionFile, "types-union", "", "dhall output file for a union over the types of the resources present")
+	flag.StringVar(&toListFile, "to-list", "", "dhall output file for a function flattening the record into a list of the types union (requires --types-union)")
+	flag.StringVar(&conversionCacheDir, "cache-dir", "",
+		"directory caching yaml-to-dhall conversions across runs, by the converted yaml, its type, the local files the type imports and the tool versions (default <user cache dir>/ds-to-dhall/conversions)")
+	flag.BoolVar(&noConversionCache, "no-cache", false, "convert every resource with yaml-to-dhall, without reading or writing the conversion cache")
+	flag.StringVar(&cpuProfileFile, "cpuprofile", "", "write a pprof cpu profile of the run to this file")
+	flag.StringVar(&memProfileFile, "memprofile", "", "write a pprof heap profile at the end of the run to this file")
+	flag.StringVar(&traceFile, "trace", "", "write a go execution trace of the run to this file")
+	flag.StringVar(&reportFile, "report", "", "write a json report of the run, with the time spent in each phase, to this file")
+	flag.IntVar(&conversionJobs, "jobs", runtime.NumCPU(), "number of components converted with yaml-to-dhall concurrently")
+	flag.IntVar(&maxProcs, "max-procs", 0, "maximum number of yaml-to-dhall, dhall and other subprocesses running at once across the run, further ones wait (default --jobs)")
+	flag.StringVar(&minFreeMemory, "min-free-memory", "", "hold back subprocesses while less memory than this is available, eg 1Gi")
+	flag.DurationVar(&timeout, "timeout", 3*time.Minute, "length of time each yaml-to-dhall run and the type check may take before timing out")
+	flag.StringArrayVarP(&ignoreFiles, "ignore", "i", nil,
+		"ignore input files matching the .gitignore pattern relative to each input (repeatable), eg vendor/, **/test/*.yaml, !keep.yaml")
+	flag.StringArrayVar(&includeFiles, "include", nil,
+		"load input files matching the .gitignore pattern relative to each input even if they are ignored (repeatable)")
+	flag.BoolVar(&followSymlinks, "follow-symlinks", false,
+		"descend into symlinked input directories, by default only symlinked files are loaded")
+	flag.BoolVar(&includeHidden, "include-hidden", false,
+		"descend into input directories whose name starts with a dot, like .git, which are skipped by default")
+	flag.StringVar(&changedSince, "changed-since", "",
+		"only convert the resources of input files that differ from the git ref, eg origin/main, to outputs named like record.changed.dhall, all inputs are still loaded for stable record keys")
+	flag.BoolVar(&skipInvalid, "skip-invalid", false,
+		"skip yaml files that aren't Kubernetes manifests, lacking kind, apiVersion or metadata, instead of failing")
+	flag.StringArrayVarP(&namespaces, "namespace", "n", nil,
+		"only keep the namespaced resources of this namespace (repeatable), resources without namespace are in --default-namespace")
+	flag.StringVarP(&selectorSpec, "selector", "l", "",
+		"only keep the resources whose labels match the selector, eg app.kubernetes.io/part-of=search,tier!=debug")
+	flag.StringArrayVar(&includeNameSpecs, "include-name", nil,
+		"only keep the resources whose name matches the regexp (repeatable), Kind:regexp restricts the pattern to a kind")
+	flag.StringArrayVar(&excludeNameSpecs, "exclude-name", nil,
+		"drop the resources whose name matches the regexp (repeatable), Kind:regexp restricts the pattern to a kind")
+	flag.BoolVarP(&allNamespaces, "all-namespaces", "A", false, "keep the resources of all namespaces and cluster scoped resources (the default)")
+	flag.StringVarP(&schemaURL, "k8sSchemaURL", "u", DefaultSchemaURL, "URL to k8s schemas.dhall file")
+	flag.StringVar(&k8sVersion, "k8s-version", "", "dhall-kubernetes release (eg 1.18) whose pinned schemas.dhall is used instead of --k8sSchemaURL")
+	flag.StringArrayVar(&k8sVersionURLOverrides, "k8s-version-url", nil, "add or override the schemas.dhall URL of a release for --k8s-version, eg 1.24=<url>")
+	flag.StringVar(&k8sVersionLock, "k8s-version-lock", "k8s-versions.lock.json",
+		"file recording the integrity hash of the schemas.dhall of --k8s-version releases that aren't pinned to a commit, pinned on first use")
+	flag.BoolVar(&detectK8sVersion, "detect-k8s-version", false,
+		"pick the dhall-kubernetes release matching the server version of the current kubectl cluster, unless the schemas are pinned explicitly")
+	flag.BoolVar(&k8sVersionFallback, "k8s-version-fallback", false,
+		"let --detect-k8s-version use the nearest release even when it is more than one minor version away from the cluster")
+	flag.StringVar(&kubeContext, "context", "", "kubeconfig context used to talk to the cluster")
+	flag.StringVar(&typeMapFile, "type-map", "",
+		"yaml file mapping apiVersion/Kind to dhall type expressions used instead of the k8s schemas, relative imports are relative to the file")
+	flag.StringArrayVar(&schemaPackages, "schema-package", nil,
+		"additional schemas package (name=url or name=path) whose kinds are looked up in order after the k8s schemas, eg certManager=<url>")
+	flag.StringVar(&unknownKind, "unknown-kind", "fail",
+		"handling of resources whose kind has no schema: fail the conversion, infer a dhall type from their yaml, or type them as Prelude json")
+	flag.BoolVar(&inferUnknownTypes, "infer-unknown-types", false, "same as --unknown-kind infer")
+	flag.CommandLine.MarkDeprecated("infer-unknown-types", "use --unknown-kind infer instead")
+	flag.BoolVar(&validateKinds, "validate-kinds", false,
+		"fetch and inspect the k8s schemas before conversion and report every resource whose kind has no schema")
+	flag.StringVar(&schemaPath, "k8s-schema-path", "",
+		"local path to k8s schemas.dhall file, imported relatively from the generated files (takes precedence over --k8sSchemaURL)")
+	addAuthFlags(flag.CommandLine)
+	flag.StringArrayVar(&importMaps, "import-map", nil,
+		"rewrite remote imports starting with a prefix, matching whole path segments, to an internal mirror, eg raw.githubusercontent.com=artifactory.internal/dhall")
+	flag.BoolVar(&asciiOutput, "ascii", false, "emit ASCII-only dhall (//\\\\ instead of ⩓)")
+	flag.StringVar(&componentCase, "component-case", "title",
+		fmt.Sprintf("casing applied to component keys (%s)", strings.Join(caseStrategies(), "|")))
+	flag.BoolVar(&kustomizationHints, "kustomization-components", true,
+		"derive the component of manifests without component label from the commonLabels, namePrefix or directory of their kustomization")
+	flag.StringVar(&secretsMode, "secrets", "include",
+		"how Secrets end up in the record, include keeps them as they are, redact replaces their data values with placeholders, "+
+			"env imports their data values from environment variables, exclude drops them")
+	flag.StringVar(&secretEnvMapFile, "secret-env-map", "",
+		"yaml output file listing the environment variables imported with --secrets env and the Secret values they provide")
+	flag.BoolVar(&decodeSecrets, "decode-secret-data", false,
+		"move the base64 encoded data values of Secrets to stringData decoded, values that aren't text stay in data")
+	flag.BoolVar(&encodeSecrets, "encode-secret-data", false, "move the stringData values of Secrets to data base64 encoded")
+	flag.BoolVar(&offline, "offline", false,
+		"fail if any import is remote and disable network access of the conversion, imports must be local or cached")
+	flag.StringVar(&auditLogFile, "audit-log", "",
+		"file recording every subprocess execution and network request with its duration and outcome, one json object per line; "+
+			"dhall subprocesses are listed with the remote imports of their input, not the ones those import in turn")
+	flag.StringVar(&policyDir, "policy", "",
+		"directory of rego policies evaluated with conftest, package main against every resource and package record against the record, denials fail the run")
+	flag.StringVar(&rbacSummaryFile, "rbac-summary", "",
+		"yaml output file listing by component which subjects get which roles and rules from the RoleBindings and ClusterRoleBindings")
+	flag.StringVar(&checksumsFile, "checksums", "", "file listing the SHA-256 digests of all generated files, eg SHA256SUMS")
+	flag.StringVar(&signKeyFile, "sign-key", "", "sign the --checksums file with cosign using the key file, the signature is written to <checksums>.sig")
+	flag.BoolVar(&signKeyless, "sign-keyless", false,
+		"sign the --checksums file with cosign keyless signing, the signature is written to <checksums>.sig and the certificate to <checksums>.pem")
+	flag.StringVar(&onDuplicate, "on-duplicate", "error",
+		"handling of resources with the same record path (error|first|last|merge), merge strategic merges later resources into the first one")
+	flag.StringVar(&generateNameSuffix, "generate-name-suffix", "%d",
+		"appended to the generateName of resources without name to form their record key, fmt verb %d receives a counter")
+	flag.BoolVar(&ownerComponents, "owner-components", true,
+		"move resources whose component was derived from their directory to the component of their ownerReferences owner")
+	flag.StringVar(&clusterScopedKey, "cluster-scoped-key", "",
+		"place cluster scoped resources (ClusterRole, Namespace, PersistentVolume, ...) at <key>.Kind.Name instead of under their component, eg Cluster")
+	flag.BoolVar(&includeNamespace, "include-namespace", false, "add a namespace level above the components in the type and record")
+	flag.StringVar(&defaultNamespace, "default-namespace", "default", "namespace level of the resources without metadata.namespace")
+	flag.StringVar(&kindVersions, "kind-versions", "none",
+		"qualify the kind level with the apiVersion version (none|conflicting|always), eg Ingress_v1beta1, conflicting only qualifies kinds present at several apiVersions")
+	flag.StringVar(&systemKey, "system-key", "",
+		"label (or annotation) grouping components into systems, eg app.kubernetes.io/part-of, adds a System level above the components")
+	flag.StringVar(&systemDefault, "system-default", "ungrouped", "system of the resources without the --system-key label or annotation")
+	flag.StringVar(&collisionSuffix, "collision-suffix", "",
+		"disambiguate components whose keys collide after casing by appending this suffix (fmt verb %d receives a counter), instead of failing")
+	flag.BoolVar(&resolveImports, "resolve", false, "resolve imports in the generated files so they can be consumed without network access")
+	flag.BoolVar(&normalizeOutput, "normalize", false, "beta-normalize the generated files (best combined with --resolve)")
+	flag.BoolVar(&lintOutput, "lint", false, "run dhall lint on the generated files")
+	flag.StringVar(&outputEncoding, "encoding", "text",
+		"encoding of the generated files (text|cbor), cbor additionally writes the binary encoding of each file to <file>.cbor")
+	flag.BoolVar(&typeCheck, "typecheck", false, "type check the generated record against the generated type before writing it")
+	flag.StringVar(&configFile, "config", "", "yaml configuration file with drop, defaults and overrides rules")
+	flag.StringArrayVar(&dropSpecs, "drop", nil,
+		"remove a field from matching resources before conversion, eg Service:.spec.clusterIP (in addition to the drop rules of --config)")
+	flag.StringVar(&transformFile, "transform", "", "yaml file with set, delete and rename operations applied to the resources selected by kind, name and labels")
+	flag.BoolVar(&builtinPatches, "builtin-compat-patches", true,
+		"patch embedded objects to match the dhall-kubernetes types, like adding apiVersion and kind to StatefulSet volumeClaimTemplates")
+	flag.StringArrayVar(&patchLocations, "patch", nil,
+		"strategic merge or JSON6902 patch file, or directory of them, applied to the resources matching by group, kind and name")
+	flag.BoolVar(&substituteEnv, "envsubst", false, "expand ${VAR} references in the string values of the inputs, failing on undefined variables")
+	flag.StringArrayVar(&envFiles, "env-file", nil, "file of KEY=VALUE lines providing variables to --envsubst (implies --envsubst), the environment takes precedence")
+	flag.StringToStringVar(&addLabels, "add-label", nil, "add the label key=value to every resource, overriding existing values")
+	flag.StringToStringVar(&addAnnotations, "add-annotation", nil, "add the annotation key=value to every resource, overriding existing values")
+	flag.BoolVar(&addToTemplates, "add-to-pod-templates", false, "also add --add-label and --add-annotation to the pod templates of workloads")
+	flag.StringVar(&namePrefix, "name-prefix", "", "prepend to the name of every resource and to the references to it")
+	flag.StringVar(&nameSuffix, "name-suffix", "", "append to the name of every resource and to the references to it")
+	flag.StringToStringVar(&registryRewrites, "rewrite-registry", nil,
+		"rewrite container images from registry (or registry/repository prefix) to another, eg docker.io=registry.internal")
+	flag.BoolVar(&pinDigests, "pin-digests", false, "resolve container image tags to digests with the registry API and append them as image@sha256:...")
+	flag.StringVar(&digestCacheFile, "digest-cache", "", "file caching the digests resolved by --pin-digests (default <user cache dir>/ds-to-dhall/digests.json)")
+	flag.DurationVar(&digestCacheTTL, "digest-cache-ttl", 24*time.Hour, "resolve cached digests again once they are older than this, as tags can move")
+	flag.BoolVar(&stripServerFields, "strip-server-fields", false,
+		"remove status and server populated metadata (uid, resourceVersion, managedFields, ...) from the inputs")
+	flag.BoolVar(&stripNulls, "strip-nulls", false, "recursively remove fields with null values from the inputs")
+	flag.BoolVar(&yaml11Scalars, "yaml11-scalars", false,
+		"read plain yes/no/on/off values as booleans like kubectl does, and log the coerced values")
+	flag.BoolVar(&configMapDataToMap, "configmap-data-tomap", false, "emit ConfigMap data as toMap expressions")
+	flag.StringVar(&configMapDataDir, "configmap-data-dir", "",
+		"with --configmap-data-tomap, write ConfigMap data values larger than --configmap-data-threshold to files in this directory and import them as Text")
+	flag.IntVar(&configMapDataThreshold, "configmap-data-threshold", 1024, "size in bytes above which ConfigMap data values are externalized")
 	flag.BoolVarP(&printHelp, "help", "h", false, "print usage instructions")
 	flag.BoolVar(&printVersion, "version", false, "print version information")
 
@@ -57,14 +319,54 @@ func init() {
 		fmt.Fprintln(os.Stderr, "OPTIONS:")
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, usageArgs())
+		fmt.Fprintln(os.Stderr, usageCommands())
 	}
 }
 
+// commands are the subcommands of ds-to-dhall, invoked with the remaining command line arguments
+var commands = map[string]struct {
+	description string
+	run         func(args []string)
+}{
+	"apply":     {description: "apply the resources of a generated record to a cluster with server-side apply", run: runApply},
+	"bench":     {description: "run the conversion repeatedly, optionally of a generated tree, and report percentiles of its phases", run: runBench},
+	"diff":      {description: "compare the record the inputs convert to with the existing output file, per component and resource", run: runDiff},
+	"gen-tests": {description: "write a fixture of inputs and expected outputs with a go test checking the conversion against it", run: runGenTests},
+	"overlays":  {description: "render a generated record into a kustomize base and scaffold an overlay per environment", run: runOverlays},
+	"render":    {description: "write the resources of a generated record back to a directory of Kubernetes YAML files", run: runRender},
+	"vendor":    {description: "download the k8s schemas closure into a directory and point generated files at it", run: runVendor},
+}
+
 func main() {
 	log15.Root().SetHandler(log15.StreamHandler(os.Stdout, log15.LogfmtFormat()))
 
+	if command, ok := commandArg(os.Args[1:]); ok {
+		command(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
+	convert()
+}
 
+// commandArg returns the command named by the first argument, unless it is also an existing path which is converted
+func commandArg(args []string) (func(args []string), bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return nil, false
+	}
+	if _, err := os.Stat(args[0]); err == nil {
+		log15.Warn("converting the path named like a command, run the command from another directory", "path", args[0])
+		return nil, false
+	}
+	return command.run, true
+}
+
+// convert runs the conversion configured by the parsed flags
+func convert() {
 	if printHelp {
 		flag.Usage()
 		os.Exit(0)
@@ -81,6 +383,303 @@ func main() {
 		os.Exit(1)
 	}
 
+	if diffOutput && checkOutputs {
+		fmt.Fprintln(os.Stderr, "--check can't be combined with the diff command")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if changedSince != "" {
+		changedOutputs()
+	}
+	if diffOutput || checkOutputs {
+		stageOutputs()
+	}
+
+	timings = newPhaseTimings()
+
+	if err := startProfiling(cpuProfileFile, memProfileFile, traceFile); err != nil {
+		logFatal("failed to start profiling", "error", err)
+	}
+
+	if auditLogFile != "" {
+		var err error
+		audit, err = openAuditLog(auditLogFile)
+		if err != nil {
+			logFatal("failed to open audit log", "error", err, "auditLog", auditLogFile)
+		}
+	}
+
+	if err := validateComponentCase(componentCase); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err := validateCollisionSuffix(collisionSuffix); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var err error
+	config, err = loadConfig(configFile)
+	if err != nil {
+		logFatal("failed to load config", "error", err, "config", configFile)
+	}
+
+	dropRules, err = parseDropRules(append(config.Drop, dropSpecs...))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	setRules, err = parseSetRules(config)
+	if err != nil {
+		logFatal("invalid config", "error", err, "config", configFile)
+	}
+
+	var patchSpecs []CompatPatch
+	if builtinPatches {
+		patchSpecs = append(patchSpecs, builtinCompatPatches...)
+	}
+	compatPatches, err = parseCompatPatches(append(patchSpecs, config.CompatPatches...))
+	if err != nil {
+		logFatal("invalid config", "error", err, "config", configFile)
+	}
+
+	if substituteEnv || len(envFiles) > 0 {
+		substitutionEnv, err = loadSubstitutionEnv(envFiles)
+		if err != nil {
+			logFatal("failed to load env files", "error", err, "envFiles", envFiles)
+		}
+	}
+
+	patches, err = loadPatches(patchLocations)
+	if err != nil {
+		logFatal("failed to load patches", "error", err, "patch", patchLocations)
+	}
+
+	if transformFile != "" {
+		transformRules, err = loadTransformRules(transformFile)
+		if err != nil {
+			logFatal("failed to load transform rules", "error", err, "transform", transformFile)
+		}
+	}
+
+	pinned := k8sVersion != "" || schemaPath != "" || flag.CommandLine.Changed("k8sSchemaURL")
+	if detectK8sVersion && !pinned {
+		if offline {
+			fmt.Fprintln(os.Stderr, "--offline can't be combined with --detect-k8s-version, which queries the cluster")
+			os.Exit(1)
+		}
+		k8sVersion, err = detectClusterVersion()
+		if err != nil {
+			logFatal("failed to detect cluster version", "error", err)
+		}
+		log15.Info("detected cluster version", "version", k8sVersion)
+		if _, err := resolveK8sVersion(k8sVersion, k8sVersionURLOverrides); err != nil {
+			nearest, distance, err := nearestK8sRelease(k8sVersion, k8sVersionURLOverrides)
+			if err != nil {
+				logFatal("no k8s schemas for the cluster version", "error", err)
+			}
+			if distance > 1 && !k8sVersionFallback {
+				fmt.Fprintf(os.Stderr, "no k8s schemas within one minor version of the cluster version %s, the nearest release is %s: "+
+					"pass --k8s-version-url %s=<url>, or --k8s-version-fallback to use %s anyway\n", k8sVersion, nearest, k8sVersion, nearest)
+				os.Exit(1)
+			}
+			log15.Warn("no pinned k8s schemas for the cluster version, using the nearest release",
+				"version", k8sVersion, "release", nearest)
+			k8sVersion = nearest
+		}
+	}
+
+	if k8sVersion != "" {
+		if flag.CommandLine.Changed("k8sSchemaURL") {
+			fmt.Fprintln(os.Stderr, "--k8s-version and --k8sSchemaURL are mutually exclusive")
+			flag.Usage()
+			os.Exit(1)
+		}
+		schemaURL, err = resolveK8sVersion(k8sVersion, k8sVersionURLOverrides)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	importMappings, err = parseImportMappings(importMaps)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if _, err := dhallHeadersEntry(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if inferUnknownTypes {
+		if flag.CommandLine.Changed("unknown-kind") && unknownKind != "infer" {
+			fmt.Fprintf(os.Stderr, "--infer-unknown-types and --unknown-kind %s are mutually exclusive\n", unknownKind)
+			flag.Usage()
+			os.Exit(1)
+		}
+		unknownKind = "infer"
+	}
+
+	if unknownKind != "fail" && unknownKind != "infer" && unknownKind != "json" {
+		fmt.Fprintf(os.Stderr, "unknown --unknown-kind %q, expected fail|infer|json\n", unknownKind)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if offline {
+		err = checkOffline()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		enableOffline()
+	}
+
+	if audit != nil {
+		enableAudit()
+	}
+
+	if schemaPath == "" && strings.HasPrefix(schemaURL, k8sReleaseBaseURL) {
+		schemaHash, err = pinK8sRelease(schemaURL, k8sVersionLock)
+		if err != nil {
+			logFatal("failed to pin the k8s schemas", "error", err, "lock", k8sVersionLock)
+		}
+	}
+
+	if kindVersions != "none" && kindVersions != "conflicting" && kindVersions != "always" {
+		fmt.Fprintf(os.Stderr, "unknown --kind-versions %q, expected none|conflicting|always\n", kindVersions)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if allNamespaces && len(namespaces) > 0 {
+		fmt.Fprintln(os.Stderr, "--all-namespaces and --namespace are mutually exclusive")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	selector, err = parseSelector(selectorSpec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	ignoreMatchers, err = newIgnoreMatcher(ignoreFiles)
+	if err == nil {
+		includeMatchers, err = newIgnoreMatcher(includeFiles)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	includeNames, err = parseNamePatterns(includeNameSpecs)
+	if err == nil {
+		excludeNames, err = parseNamePatterns(excludeNameSpecs)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if componentsFormat != "yaml" && componentsFormat != "json" && componentsFormat != "toml" {
+		fmt.Fprintf(os.Stderr, "unknown --components-format %q, expected yaml|json|toml\n", componentsFormat)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if conversionJobs < 1 {
+		fmt.Fprintf(os.Stderr, "--jobs must be at least 1, got %d\n", conversionJobs)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if maxProcs < 0 {
+		fmt.Fprintf(os.Stderr, "--max-procs must be at least 1, got %d\n", maxProcs)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if maxProcs == 0 {
+		maxProcs = conversionJobs
+	}
+	var minFree uint64
+	if minFreeMemory != "" {
+		minFree, err = parseMemory(minFreeMemory)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		if _, ok := availableMemory(); !ok {
+			log15.Warn("available memory is unknown on this system, ignoring --min-free-memory")
+		}
+	}
+	procs = newProcLimiter(maxProcs, minFree)
+
+	if componentsSchema != 1 && componentsSchema != ComponentsSchemaVersion {
+		fmt.Fprintf(os.Stderr, "unknown --components-schema %d, expected 1|%d\n", componentsSchema, ComponentsSchemaVersion)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if secretsMode != "include" && secretsMode != "redact" && secretsMode != "env" && secretsMode != "exclude" {
+		fmt.Fprintf(os.Stderr, "unknown --secrets %q, expected include|redact|env|exclude\n", secretsMode)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if (signKeyFile != "" || signKeyless) && checksumsFile == "" {
+		fmt.Fprintln(os.Stderr, "--sign-key and --sign-keyless require --checksums")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if signKeyFile != "" && signKeyless {
+		fmt.Fprintln(os.Stderr, "--sign-key and --sign-keyless are mutually exclusive")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if decodeSecrets && encodeSecrets {
+		fmt.Fprintln(os.Stderr, "--decode-secret-data and --encode-secret-data are mutually exclusive")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if onDuplicate != "error" && onDuplicate != "first" && onDuplicate != "last" && onDuplicate != "merge" {
+		fmt.Fprintf(os.Stderr, "unknown --on-duplicate %q, expected error|first|last|merge\n", onDuplicate)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if splitDir != "" && (changedSince != "" || schemaFile != "" || secretsMode == "env") {
+		fmt.Fprintln(os.Stderr, "--split-dir can't be combined with --changed-since, --schema or --secrets env")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if toListFile != "" && typesUnionFile == "" {
+		fmt.Fprintln(os.Stderr, "--to-list requires --types-union")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if outputEncoding != "text" && outputEncoding != "cbor" {
+		fmt.Fprintf(os.Stderr, "unknown encoding %q, expected text|cbor\n", outputEncoding)
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	inputs := flag.Args()
 	if len(inputs) == 0 {
 		cwd, err := os.Getwd()
@@ -90,107 +689,393 @@ func main() {
 		inputs = []string{cwd}
 	}
 
+	if pinDigests {
+		if digestCacheFile == "" {
+			digestCacheFile, err = defaultDigestCacheFile()
+			if err != nil {
+				logFatal("failed to locate digest cache", "error", err)
+			}
+		}
+		ttl := digestCacheTTL
+		if offline {
+			// digests can't be resolved again without network access, cached ones are used however old
+			ttl = time.Duration(math.MaxInt64)
+		}
+		digests, err = loadDigestCache(digestCacheFile, ttl, httpClient)
+		if err != nil {
+			logFatal("failed to load digest cache", "error", err, "cache", digestCacheFile)
+		}
+	}
+
+	if !noConversionCache {
+		if conversionCacheDir == "" {
+			conversionCacheDir, err = defaultConversionCacheDir()
+			if err != nil {
+				log15.Warn("converting without a conversion cache, pass --cache-dir to use one", "error", err)
+			}
+		}
+		if conversionCacheDir != "" {
+			conversions, err = newConversionCache(conversionCacheDir)
+			if err != nil {
+				logFatal("failed to set up conversion cache", "error", err, "cache", conversionCacheDir)
+			}
+		}
+	}
+
 	log15.Info("loading resources", "inputs", inputs)
+	discovered := timings.track("discovery")
 	srcSet, err := loadResourceSet(inputs)
-	if err != nil {
+	reported.set = srcSet
+	// load errors, duplicates and --validate findings are reported together once the resources are validated
+	failed, _ := err.(loadErrors)
+	if err != nil && failed == nil {
 		logFatal("failed to load source resources", "error", err, "inputs", inputs)
 	}
 
-	yamlBytes, err := buildYaml(buildRecord(srcSet))
+	if digests != nil {
+		err = digests.save()
+		if err != nil {
+			logFatal("failed to save digest cache", "error", err, "cache", digestCacheFile)
+		}
+	}
+
+	err = resolveComponentCollisions(srcSet, collisionSuffix)
 	if err != nil {
-		logFatal("failed to compose yaml", "error", err)
+		logFatal("failed to assign component keys", "error", err)
+	}
+
+	err = resolveDuplicates(srcSet, onDuplicate)
+	if duplicates, ok := err.(loadErrors); ok {
+		failed = append(failed, duplicates...)
+	} else if err != nil {
+		logFatal("failed to assign record keys", "error", err)
+	}
+
+	if changedSince != "" {
+		changed, err := changedFiles(srcSet.Root, changedSince)
+		if err != nil {
+			logFatal("failed to list changed files", "error", err, "ref", changedSince)
+		}
+		keepChangedResources(srcSet, changed)
+	}
+	discovered()
+
+	if validate {
+		log15.Info("validating resources", "release", k8sRelease())
+		findings, err := validateResources(inputValidations(srcSet), validateSchemas)
+		if err != nil {
+			logFatal("failed to validate resources", "error", err)
+		}
+		failed = append(failed, findings...)
+	}
+
+	if len(failed) > 0 {
+		reported.loadErrors = failed
+		for _, f := range failed {
+			log15.Error("failed to load manifest", "manifest", f.manifest, "error", f.err)
+		}
+		logFatal("failed to load source resources", "manifests", len(failed), "inputs", inputs)
+	}
+
+	if policyDir != "" {
+		log15.Info("evaluating policies", "policy", policyDir)
+		err = evaluatePolicies(srcSet, policyDir)
+		if err != nil {
+			logFatal("failed policy evaluation", "error", err)
+		}
 	}
 
 	log15.Info("execute yaml-to-dhall", "destination", destinationFile)
 
-	dhallType := composeK8sDhallType(srcSet)
+	dhallType := composeK8sDhallType(srcSet, typeFile)
 	if typeFile != "" {
 		err = ioutil.WriteFile(typeFile, []byte(dhallType), 0644)
 		if err != nil {
 			logFatal("failed to write dhall type", "error", err, "typeFile", typeFile)
 		}
-		err = dhallFormat(typeFile)
+		err = finalizeDhallFile(typeFile)
 		if err != nil {
-			logFatal("failed to format dhall file", "error", err, "file", typeFile)
+			logFatal("failed to finalize dhall file", "error", err, "file", typeFile)
 		}
+	}
 
-		err = prependLine(typeFile, GeneratedComment)
+	var record string
+	if splitDir != "" {
+		splits, err = loadSplitOutputs(splitDir)
 		if err != nil {
-			logFatal("failed to prepend generated comment to dhall file", "error", err, "file", typeFile)
+			logFatal("failed to load split outputs", "error", err, "splitDir", splitDir)
 		}
+		record, err = splits.compose(context.Background(), srcSet)
+	} else {
+		record, err = composeDhallRecord(context.Background(), srcSet)
+	}
+	unconverted, ok := err.(*conversionError)
+	if ok && stagedOutputs == nil {
+		// --check and diff leave the working directory alone
+		_ = writeYaml("failed.yaml", buildRecord(&ResourceSet{Components: map[string][]*Resource{"": unconverted.resources}}))
+		logFatal("failed to execute yaml-to-dhall", "error", err, "yaml", "failed.yaml")
+	}
+	if err != nil {
+		logFatal("failed to execute yaml-to-dhall", "error", err)
+	}
+	if conversions != nil {
+		log15.Info("conversion cache", "hits", conversionCacheStats.hits, "misses", conversionCacheStats.misses)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	if secretEnvMapFile != "" {
+		err = writeSecretEnvMap(secretEnvMapFile)
+		if err != nil {
+			logFatal("failed to write secret env map", "error", err, "secretEnvMap", secretEnvMapFile)
+		}
+		recordOutput(secretEnvMapFile)
+	}
 
-	err = yamlToDhall(ctx, dhallType, yamlBytes, destinationFile)
-	if err != nil {
-		_ = ioutil.WriteFile("record.yaml", yamlBytes, 0644)
-		logFatal("failed to execute yaml-to-dhall", "error", err, "dhallType", dhallType, "yaml", "record.yaml")
+	if typeCheck && dhallType != "" {
+		log15.Info("type checking record against type")
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = dhallTypeCheck(ctx, record, composeK8sDhallType(srcSet, destinationFile))
+		cancel()
+		if err != nil {
+			logFatal("generated record does not match generated type", "error", err)
+		}
 	}
 
-	err = dhallFormat(destinationFile)
-	if err != nil {
-		logFatal("failed to format dhall file", "error", err, "file", destinationFile)
+	if splits != nil && splits.rootUnchanged(record) {
+		recordOutput(destinationFile)
+	} else {
+		err = ioutil.WriteFile(destinationFile, []byte(record), 0644)
+		if err != nil {
+			logFatal("failed to write dhall record", "error", err, "destinationFile", destinationFile)
+		}
+
+		err = finalizeDhallFile(destinationFile)
+		if err != nil {
+			logFatal("failed to finalize dhall file", "error", err, "file", destinationFile)
+		}
+	}
+	if splits != nil {
+		err = splits.save()
+		if err != nil {
+			logFatal("failed to save split outputs manifest", "error", err, "splitDir", splitDir)
+		}
 	}
 
-	err = prependLine(destinationFile, GeneratedComment)
-	if err != nil {
-		logFatal("failed to prepend generated comment to dhall file", "error", err, "file", destinationFile)
+	if verifyRoundtrip {
+		log15.Info("verifying round trip", "destination", destinationFile)
+		rendered, err := renderRecord(destinationFile)
+		if err != nil {
+			logFatal("failed to render generated record", "error", err, "destinationFile", destinationFile)
+		}
+		diffs, err := roundtripDiffs(intendedRecord(srcSet), rendered)
+		if err != nil {
+			logFatal("failed to compare rendered record", "error", err, "destinationFile", destinationFile)
+		}
+		for _, diff := range diffs {
+			log15.Error("round trip difference", "difference", diff)
+		}
+		if len(diffs) > 0 {
+			logFatal("generated record does not render back to its input", "differences", len(diffs))
+		}
+
+		if validate {
+			resources, err := renderedResources(rendered)
+			if err != nil {
+				logFatal("failed to collect rendered resources", "error", err)
+			}
+			findings, err := validateResources(renderedValidations(resources), validateSchemas)
+			if err != nil {
+				logFatal("failed to validate rendered resources", "error", err)
+			}
+			for _, finding := range findings {
+				reported.findings = append(reported.findings, fmt.Sprintf("%s: %v", finding.manifest, finding.err))
+				log15.Error("validation finding", "resource", finding.manifest, "finding", finding.err)
+			}
+			if len(findings) > 0 {
+				logFatal("invalid rendered resources", "findings", len(findings))
+			}
+		}
+	}
+
+	if goldenDir != "" {
+		log15.Info("rendering golden files", "golden", goldenDir)
+		err = writeGolden(destinationFile, goldenDir)
+		if err != nil {
+			logFatal("failed to write golden files", "error", err, "golden", goldenDir)
+		}
+	}
+
+	if schemaFile != "" {
+		schemaType := composeK8sDhallType(srcSet, schemaFile)
+		written := timings.track("schemaWriting")
+		recordContents, err := ioutil.ReadFile(destinationFile)
+		if err != nil {
+			logFatal("failed to read record contents", "error", err, "destinationFile", destinationFile)
+		}
+		schemaContents := fmt.Sprintf("{ Type = %s, default = %s }", schemaType, string(recordContents))
+
+		err = ioutil.WriteFile(schemaFile, []byte(schemaContents), 0644)
+		if err != nil {
+			logFatal("failed to write schema file", "error", err, "schemaFile", schemaFile)
+		}
+		written()
+
+		err = finalizeDhallFile(schemaFile)
+		if err != nil {
+			logFatal("failed to finalize dhall file", "error", err, "file", schemaFile)
+		}
+	}
+
+	if typesUnionFile != "" {
+		err = ioutil.WriteFile(typesUnionFile, []byte(composeTypesUnion(srcSet, typesUnionFile)), 0644)
+		if err != nil {
+			logFatal("failed to write types union file", "error", err, "typesUnionFile", typesUnionFile)
+		}
+
+		err = finalizeDhallFile(typesUnionFile)
+		if err != nil {
+			logFatal("failed to finalize dhall file", "error", err, "file", typesUnionFile)
+		}
+	}
+
+	if toListFile != "" {
+		toList, err := composeToList(srcSet, toListFile, typesUnionFile)
+		if err != nil {
+			logFatal("failed to compose toList function", "error", err)
+		}
+
+		err = ioutil.WriteFile(toListFile, []byte(toList), 0644)
+		if err != nil {
+			logFatal("failed to write toList file", "error", err, "toListFile", toListFile)
+		}
+
+		err = finalizeDhallFile(toListFile)
+		if err != nil {
+			logFatal("failed to finalize dhall file", "error", err, "file", toListFile)
+		}
+	}
+
+	if componentsFile != "" {
+		var components interface{} = buildComponentsV2(srcSet)
+		if componentsSchema == 1 {
+			components = buildComponents(srcSet)
+		}
+		componentsBytes, err := encodeComponents(components, componentsFormat)
+		if err != nil {
+			logFatal("failed to build components yaml", "error", err)
+		}
+
+		err = ioutil.WriteFile(componentsFile, componentsBytes, 0644)
+		if err != nil {
+			logFatal("failed to write components file", "error", err, "componentsFile", componentsFile)
+		}
+		recordOutput(componentsFile)
 	}
 
-	if schemaFile != "" {
-		recordContents, err := ioutil.ReadFile(destinationFile)
+	if imagesFile != "" {
+		err = writeImageInventory(srcSet, imagesFile)
 		if err != nil {
-			logFatal("failed to read record contents", "error", err, "destinationFile", destinationFile)
+			logFatal("failed to write images inventory", "error", err, "images", imagesFile)
 		}
-		schemaContents := fmt.Sprintf("{ Type = %s, default = %s }", dhallType, string(recordContents))
+		recordOutput(imagesFile)
+	}
 
-		err = ioutil.WriteFile(schemaFile, []byte(schemaContents), 0644)
+	if capacityFile != "" {
+		err = writeCapacitySummary(srcSet, capacityFile)
 		if err != nil {
-			logFatal("failed to write schema file", "error", err, "schemaFile", schemaFile)
+			logFatal("failed to write capacity summary", "error", err, "capacity", capacityFile)
 		}
+		recordOutput(capacityFile)
+	}
 
-		err = dhallFormat(schemaFile)
+	if portsFile != "" {
+		err = writePortsReport(srcSet, portsFile)
 		if err != nil {
-			logFatal("failed to format dhall file", "error", err, "file", schemaFile)
+			logFatal("failed to write ports report", "error", err, "ports", portsFile)
 		}
+		recordOutput(portsFile)
+	}
 
-		err = prependLine(schemaFile, GeneratedComment)
+	if rbacSummaryFile != "" {
+		err = writeRBACSummary(srcSet, rbacSummaryFile)
 		if err != nil {
-			logFatal("failed to prepend generated comment to dhall file", "error", err, "file", schemaFile)
+			logFatal("failed to write rbac summary", "error", err, "rbacSummary", rbacSummaryFile)
 		}
+		recordOutput(rbacSummaryFile)
 	}
 
-	if componentsFile != "" {
-		componentsBytes, err := buildYaml(buildComponents(srcSet))
+	if checksumsFile != "" {
+		err = writeChecksums(checksumsFile)
 		if err != nil {
-			logFatal("failed to build components yaml", "error", err)
+			logFatal("failed to write checksums", "error", err, "checksums", checksumsFile)
+		}
+		if (signKeyFile != "" || signKeyless) && stagedOutputs == nil {
+			log15.Info("signing checksums", "checksums", checksumsFile)
+			err = signChecksums(checksumsFile, signKeyFile, signKeyless)
+			if err != nil {
+				logFatal("failed to sign checksums", "error", err, "checksums", checksumsFile)
+			}
 		}
+	}
 
-		err = ioutil.WriteFile(componentsFile, componentsBytes, 0644)
+	if len(srcSet.Skipped) > 0 {
+		log15.Warn("skipped invalid manifests", "count", len(srcSet.Skipped), "manifests", strings.Join(srcSet.Skipped, ", "))
+	}
+
+	err = audit.close()
+	if err != nil {
+		logFatal("failed to close audit log", "error", err, "auditLog", auditLogFile)
+	}
+
+	err = stopProfiling()
+	if err != nil {
+		logFatal("failed to write profiles", "error", err)
+	}
+
+	if reportFile != "" {
+		err = writeRunReport(srcSet, reportFile)
 		if err != nil {
-			logFatal("failed to write components file", "error", err, "componentsFile", componentsFile)
+			logFatal("failed to write report", "error", err, "report", reportFile)
 		}
 	}
 
-	log15.Info("done")
+	if diffOutput {
+		reportDiff()
+		return
+	}
+	if checkOutputs {
+		reportStale()
+		log15.Info("generated files are up to date")
+		return
+	}
+
+	log15.Info("done", timings.logContext()...)
 }
 
 type Resource struct {
-	Source     string
-	Component  string
-	Kind       string
-	ApiVersion string
-	Name       string
-	DhallType  string
-	Labels     map[string]string
-	Contents   map[string]interface{}
+	Source    string
+	Component string
+	// DirectoryComponent is set when the component was derived from the directory, for lack of better hints
+	DirectoryComponent bool
+	System             string
+	Kind               string
+	ApiVersion         string
+	Name               string
+	DhallType          string
+	TypePath           string
+	TypeBase           string
+	TypeSource         string
+	Labels             map[string]string
+	Contents           map[string]interface{}
+	// Intended are the contents as loaded with the requested transforms but not the normalizing ones, kept
+	// for --verify-roundtrip
+	Intended map[string]interface{}
 }
 
 type ResourceSet struct {
 	Root       string
 	Components map[string][]*Resource
+	// Skipped are the invalid manifests skipped with --skip-invalid
+	Skipped []string
 }
 
 func versionString(version, commit, date string) string {
@@ -207,49 +1092,114 @@ func versionString(version, commit, date string) string {
 	return b.String()
 }
 
-func loadResource(rootDir string, filename string) (*Resource, error) {
-	relPath, err := filepath.Rel(rootDir, filename)
+// loadResources loads the resource of a manifest, or the items of a List
+func loadResources(rootDir string, filename string) ([]*Resource, error) {
+	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	f, err := os.Open(filename)
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	var doc yaml.Node
+	err = decoder.Decode(&doc)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to decode yaml file: %s: %v", filename, err)
+	}
+	expanded, err := expandAliases(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand yaml aliases: %s: %v", filename, err)
+	}
+	if substitutionEnv != nil {
+		err = envsubst(expanded, substitutionEnv)
+		if err != nil {
+			return nil, fmt.Errorf("failed to substitute variables in %s: %v", filename, err)
+		}
+	}
+	if yaml11Scalars {
+		coerced := normalizeYAML11(expanded)
+		if len(coerced) > 0 {
+			log15.Warn("coerced YAML 1.1 scalars", "manifest", filename, "values", strings.Join(coerced, ", "))
+		}
+	}
+	if len(expanded.Content) != 1 || expanded.Content[0].Kind != yaml.MappingNode {
+		return nil, &invalidManifestError{filename: filename, reason: "not a mapping"}
+	}
+	var contents map[string]interface{}
+	err = expanded.Decode(&contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode yaml file: %s: %v", filename, err)
 	}
-	defer f.Close()
 
-	br := bufio.NewReader(f)
-	decoder := yaml.NewDecoder(br)
+	if !isList(contents) {
+		res, err := loadResource(rootDir, filename, contents)
+		if err != nil {
+			return nil, err
+		}
+		return []*Resource{res}, nil
+	}
 
-	var res Resource
-	res.Source = filename
-	err = decoder.Decode(&res.Contents)
+	var resources []*Resource
+	for idx, item := range contents["items"].([]interface{}) {
+		itemContents, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, &invalidManifestError{filename: filename, reason: fmt.Sprintf("a list whose item %d is not a resource", idx)}
+		}
+		res, err := loadResource(rootDir, filename, itemContents)
+		if invalid, ok := err.(*invalidManifestError); ok {
+			// kept an invalidManifestError so that --skip-invalid skips the list like any other invalid manifest
+			return nil, &invalidManifestError{filename: filename, reason: fmt.Sprintf("%s in item %d of the list", invalid.reason, idx)}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("item %d of list: %v", idx, err)
+		}
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+// isList reports whether contents is a List, as printed by kubectl get -o yaml for several resources, or a typed
+// list like ConfigMapList
+func isList(contents map[string]interface{}) bool {
+	kind, _ := contents["kind"].(string)
+	_, hasItems := contents["items"].([]interface{})
+	return strings.HasSuffix(kind, "List") && hasItems
+}
+
+func loadResource(rootDir string, filename string, contents map[string]interface{}) (*Resource, error) {
+	relPath, err := filepath.Rel(rootDir, filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode yaml file: %s: %v", filename, err)
+		return nil, err
 	}
 
+	var res Resource
+	res.Source = filename
+	res.Contents = contents
+
 	kind, ok := res.Contents["kind"].(string)
 	if !ok {
-		return nil, fmt.Errorf("resource %s is missing a kind field", filename)
+		return nil, &invalidManifestError{filename: filename, reason: "missing a kind field"}
 	}
 	res.Kind = kind
 
 	apiVersion, ok := res.Contents["apiVersion"].(string)
 	if !ok {
-		return nil, fmt.Errorf("resource %s is missing a apiVersion field", filename)
+		return nil, &invalidManifestError{filename: filename, reason: "missing a apiVersion field"}
 	}
 	res.ApiVersion = apiVersion
 
-	res.DhallType = fmt.Sprintf("(%s).%s.Type", schemaURL, res.Kind)
-
 	metadata, ok := res.Contents["metadata"].(map[string]interface{})
 	if !ok {
-		return nil, fmt.Errorf("resource %s is missing metadata", filename)
+		return nil, &invalidManifestError{filename: filename, reason: "missing metadata"}
 	}
 
 	name, ok := metadata["name"].(string)
 	if !ok {
-		return nil, fmt.Errorf("resource %s is missing name field", filename)
+		generateName, hasGenerateName := metadata["generateName"].(string)
+		if !hasGenerateName {
+			return nil, fmt.Errorf("resource %s is missing name field", filename)
+		}
+		name = generatedName(kind, generateName)
 	}
 	res.Name = name
 
@@ -259,37 +1209,37 @@ func loadResource(rootDir string, filename string) (*Resource, error) {
 		labels = make(map[string]interface{})
 	}
 
-	componentLabel, ok := labels["app.kubernetes.io/component"].(string)
-	if ok {
-		res.Component = componentLabel
-	} else {
-		log15.Warn("deriving component from directory", "manifest", filename)
-		res.Component = filepath.Dir(relPath)
-		if res.Component == "." {
-			res.Component = filepath.Base(rootDir)
-		}
+	if systemKey != "" {
+		annotations, _ := metadata["annotations"].(map[string]interface{})
+		res.System = resourceSystem(labels, annotations)
 	}
 
-	// patch statefulsets
-	if res.Kind == "StatefulSet" {
-		spec, ok := res.Contents["spec"].(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("resource %s is missing spec section", filename)
-		}
-		volumeClaimTemplates, ok := spec["volumeClaimTemplates"].([]interface{})
-		if !ok {
-			return nil, fmt.Errorf("resource %s is missing volumeClaimTemplates section", filename)
+	componentLabel, fromLabel := labels["app.kubernetes.io/component"].(string)
+	if fromLabel {
+		res.Component = componentLabel
+	} else {
+		var fromKustomization bool
+		if kustomizationHints {
+			res.Component, fromKustomization, err = kustomizationComponent(rootDir, filename)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read kustomization of %s: %v", filename, err)
+			}
 		}
-		for _, volumeClaimTemplate := range volumeClaimTemplates {
-			vct, ok := volumeClaimTemplate.(map[string]interface{})
-			if !ok {
-				return nil, fmt.Errorf("resource %s is missing volumeClaimTemplate section", filename)
+		if !fromKustomization {
+			log15.Warn("deriving component from directory", "manifest", filename)
+			res.DirectoryComponent = true
+			res.Component = filepath.Dir(relPath)
+			if res.Component == "." {
+				res.Component = filepath.Base(rootDir)
 			}
-			vct["apiVersion"] = "apps/v1"
-			vct["kind"] = "PersistentVolumeClaim"
 		}
 	}
 
+	if mapped := mapComponent(config.Components, res.Component, fromLabel); mapped != res.Component {
+		log15.Debug("mapping component", "manifest", filename, "component", res.Component, "mapped", mapped)
+		res.Component = mapped
+	}
+
 	return &res, err
 }
 
@@ -304,6 +1254,24 @@ func usageArgs() string {
 	return fmt.Sprintf("ARGS:\n%s", b.String())
 }
 
+func usageCommands() string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := bytes.Buffer{}
+	w := tabwriter.NewWriter(&b, 0, 8, 1, ' ', 0)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "\t%s\t%s\n", name, commands[name].description)
+	}
+	w.Flush()
+
+	return fmt.Sprintf("COMMANDS:\n%s\nA first argument naming both a command and an existing path is converted as an input path\n", b.String())
+}
+
 func makeAbs(paths []string) ([]string, error) {
 	var pas []string
 
@@ -346,42 +1314,6 @@ func commonPrefix(paths []string) (string, error) {
 	return strings.Join(cp, string(os.PathSeparator)), nil
 }
 
-// implements a primitive suffix match using filepath.Match
-// note: these are not the same semantics as .gitignore
-func matchIgnore(pattern, path string) (bool, error) {
-	if len(path) == 0 {
-		return false, nil
-	}
-	sep := string(os.PathSeparator)
-	parts := strings.Split(path, sep)
-
-	for idx := len(parts) - 1; idx >= 0; idx-- {
-		p := strings.Join(parts[idx:], sep)
-
-		ignore, err := filepath.Match(pattern, p)
-		if err != nil {
-			return false, err
-		}
-		if ignore {
-			return true, nil
-		}
-	}
-	return false, nil
-}
-
-func ignorePath(path string) (bool, error) {
-	for _, ignorePattern := range ignoreFiles {
-		ignore, err := matchIgnore(ignorePattern, path)
-		if err != nil {
-			return false, err
-		}
-		if ignore {
-			return true, nil
-		}
-	}
-	return false, nil
-}
-
 func loadResourceSet(inputs []string) (*ResourceSet, error) {
 	pas, err := makeAbs(inputs)
 	if err != nil {
@@ -395,13 +1327,23 @@ func loadResourceSet(inputs []string) (*ResourceSet, error) {
 	rs.Components = make(map[string][]*Resource)
 	rs.Root = cr
 
+	var failed loadErrors
 	for _, input := range pas {
-		err = filepath.Walk(input, func(path string, info os.FileInfo, err error) error {
+		ignores, err := rootIgnoreMatcher(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ignore file: %v", err)
+		}
+		err = walkInput(input, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
-				return err
+				failed = append(failed, loadError{manifest: path, err: err})
+				return nil
+			}
+
+			if info.IsDir() && path != input && isHidden(path) && !includeHidden {
+				return filepath.SkipDir
 			}
 
-			ignore, err := ignorePath(path)
+			ignore, err := ignorePath(ignores, input, path, info.IsDir())
 			if err != nil {
 				return err
 			}
@@ -415,12 +1357,24 @@ func loadResourceSet(inputs []string) (*ResourceSet, error) {
 				return nil
 			}
 
+			if isKustomization(path) {
+				return nil
+			}
+
 			if filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml" {
-				res, err := loadResource(rs.Root, path)
+				resources, err := loadResources(rs.Root, path)
+				if err != nil && skipInvalid && isInvalidManifest(err) {
+					log15.Warn("skipping invalid manifest", "manifest", path, "error", err)
+					rs.Skipped = append(rs.Skipped, path)
+					return nil
+				}
 				if err != nil {
-					return err
+					failed = append(failed, loadError{manifest: path, err: err})
+					return nil
+				}
+				for _, res := range resources {
+					rs.Components[res.Component] = append(rs.Components[res.Component], res)
 				}
-				rs.Components[res.Component] = append(rs.Components[res.Component], res)
 			}
 			return nil
 		})
@@ -428,71 +1382,315 @@ func loadResourceSet(inputs []string) (*ResourceSet, error) {
 			return nil, err
 		}
 	}
+	// the resources of the manifests that loaded go on, so that a run reports the problems of every manifest
+	if ownerComponents {
+		groupByOwner(&rs)
+	}
+
+	err = applyTransforms(&rs)
+	if transformFailed, ok := err.(loadErrors); ok {
+		failed = append(failed, transformFailed...)
+	} else if err != nil {
+		return nil, err
+	}
+
+	collectClusterScopedKinds(&rs)
+
+	err = applyFilters(&rs)
+	if err != nil {
+		return nil, err
+	}
+
+	collectKindVersions(&rs)
+
+	err = assignDhallTypes(&rs)
+	if typeFailed, ok := err.(loadErrors); ok {
+		failed = append(failed, typeFailed...)
+	} else if err != nil {
+		return nil, err
+	}
 
+	if len(failed) > 0 {
+		return &rs, failed
+	}
 	return &rs, nil
 }
 
-func composeK8sDhallType(rs *ResourceSet) string {
-	var schemas []string
+// composeK8sDhallType composes the type of the record, with imports relative to the generated file it is written to
+func composeK8sDhallType(rs *ResourceSet, file string) string {
+	defer timings.track("typeComposition")()
 
-	for component, resources := range rs.Components {
-		for _, r := range resources {
-			s := fmt.Sprintf("{ %s : { %s : { %s : %s } } }", strings.Title(component), r.Kind, r.Name, r.DhallType)
-			schemas = append(schemas, s)
+	// every component is typed by a single record type, and only those are combined: type checking long chains of
+	// the combine operator, one per resource, slows down super-linearly
+	var schemas []string
+	for _, component := range sortedComponents(rs) {
+		types := make(map[string]interface{})
+		for _, r := range rs.Components[component] {
+			insertPath(types, recordPath(r), resourceTypeExpr(r, file))
 		}
+		if len(types) > 0 {
+			schemas = append(schemas, recordTypeLiteral(types))
+		}
+	}
+
+	if len(schemas) == 0 {
+		return ""
 	}
 
-	return strings.Join(schemas, " ⩓ ")
+	return fmt.Sprintf("%s %s", typeBindings(file), strings.Join(schemas, fmt.Sprintf(" %s ", combineTypesOperator())))
 }
 
 func buildRecord(rs *ResourceSet) map[string]interface{} {
 	record := make(map[string]interface{})
 
-	for component, resources := range rs.Components {
-		compRec := make(map[string]map[string]interface{})
-		record[strings.Title(component)] = compRec
+	for _, resources := range rs.Components {
 		for _, r := range resources {
-			kindRec := compRec[r.Kind]
-			if kindRec == nil {
-				kindRec = make(map[string]interface{})
-				compRec[r.Kind] = kindRec
-			}
-			kindRec[r.Name] = r.Contents
+			insertPath(record, recordPath(r), r.Contents)
 		}
 	}
 
 	return record
 }
 
-func buildYaml(record map[string]interface{}) ([]byte, error) {
-	var b bytes.Buffer
-	e := yaml.NewEncoder(&b)
-
-	err := e.Encode(record)
+// encodeYaml streams the yaml encoding of v to w, without holding it in memory
+func encodeYaml(w io.Writer, v interface{}) error {
+	e := yaml.NewEncoder(w)
+	err := e.Encode(v)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return e.Close()
+}
 
-	return b.Bytes(), nil
+// writeYaml streams the yaml encoding of v to file
+func writeYaml(file string, v interface{}) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = encodeYaml(f, v)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
-func yamlToDhall(ctx context.Context, schema string, yamlBytes []byte, dst string) error {
+// yamlToDhall converts contents with yaml-to-dhall against the schema, passing their yaml encoding on its stdin
+func yamlToDhall(ctx context.Context, schema string, contents interface{}) (string, error) {
+	var key string
+	if conversions != nil {
+		composed := timings.track("yamlComposition")
+		var err error
+		key, err = conversions.key(schema, contents)
+		composed()
+		if err != nil {
+			return "", fmt.Errorf("failed to encode yaml: %v", err)
+		}
+		if expr, ok := conversions.get(key); ok {
+			return expr, nil
+		}
+	}
+
+	defer timings.track("yamlToDhall")()
+	// every run gets its own --timeout, from the moment it has its turn with --max-procs
+	procs.acquire()
+	defer procs.release()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	var cmd *exec.Cmd
 	if schema == "" {
-		cmd = exec.CommandContext(ctx, "yaml-to-dhall", "--records-loose", "--output", dst)
+		cmd = exec.CommandContext(ctx, "yaml-to-dhall", "--records-loose")
 	} else {
-		cmd = exec.CommandContext(ctx, "yaml-to-dhall", schema, "--records-loose", "--output", dst)
+		cmd = exec.CommandContext(ctx, "yaml-to-dhall", schema, "--records-loose")
 	}
-	cmd.Stdin = bytes.NewReader(yamlBytes)
-	cmd.Stderr = os.Stderr
+	cmd.Env = subprocessEnv()
+	// conversions run concurrently, the errors are reported with the resource instead of interleaved
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	encoded := make(chan error, 1)
+	go func() {
+		// the yaml is encoded while yaml-to-dhall reads it, never held in memory
+		defer timings.track("yamlComposition")()
+		err := encodeYaml(stdin, contents)
+		stdin.Close()
+		encoded <- err
+	}()
+
+	out, err := auditedOutput(cmd)
+	encodeErr := <-encoded
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("timed out after %v", timeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if encodeErr != nil {
+		return "", fmt.Errorf("failed to stream yaml to yaml-to-dhall: %v", encodeErr)
+	}
+	if conversions != nil {
+		err = conversions.put(key, string(out))
+		if err != nil {
+			log15.Warn("failed to cache conversion", "error", err, "cache", conversions.dir)
+		}
+	}
+	return string(out), nil
+}
+
+// schemaImport is the import of the k8s schemas as seen from a generated file
+func schemaImport(file string) string {
+	if schemaPath == "" {
+		return importFrom(schemaURL, file)
+	}
+	return importFrom(schemaPath, file)
+}
+
+// importFrom is the import of a URL or local path as seen from a generated file (the working directory if empty).
+// URLs go through the import mappings, local paths are imported relatively.
+func importFrom(location, file string) string {
+	if strings.Contains(location, "://") {
+		return mapImport(importMappings, location)
+	}
+
+	absLocation, err := filepath.Abs(location)
+	if err != nil {
+		logFatal("failed to resolve import path", "error", err, "path", location)
+	}
+	absDir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		logFatal("failed to resolve directory of generated file", "error", err, "file", file)
+	}
+	rel, err := filepath.Rel(absDir, absLocation)
+	if err != nil {
+		logFatal("failed to compute relative import", "error", err, "path", location, "file", file)
+	}
+	return dhallLocalImport(rel)
+}
+
+func combineTypesOperator() string {
+	if asciiOutput {
+		return "//\\\\"
+	}
+	return "⩓"
+}
+
+// finalizeDhallFile post-processes a generated dhall file in place and marks it as generated
+func finalizeDhallFile(file string) error {
+	defer timings.track("formatting")()
+
+	if resolveImports {
+		err := dhallResolve(file)
+		if err != nil {
+			return fmt.Errorf("failed to resolve imports: %v", err)
+		}
+	}
+
+	if normalizeOutput {
+		err := dhallNormalize(file)
+		if err != nil {
+			return fmt.Errorf("failed to normalize: %v", err)
+		}
+	}
+
+	if lintOutput {
+		err := dhallLint(file)
+		if err != nil {
+			return fmt.Errorf("failed to lint: %v", err)
+		}
+	}
+
+	err := dhallFormat(file)
+	if err != nil {
+		return fmt.Errorf("failed to format: %v", err)
+	}
+
+	err = prependLine(file, GeneratedComment)
+	if err != nil {
+		return fmt.Errorf("failed to prepend generated comment: %v", err)
+	}
+
+	recordOutput(file)
+
+	if outputEncoding == "cbor" {
+		err = dhallEncode(file, file+".cbor")
+		if err != nil {
+			return fmt.Errorf("failed to encode: %v", err)
+		}
+		recordOutput(file + ".cbor")
+	}
+	return nil
+}
 
-	return cmd.Run()
+// dhallResolve replaces all imports in file with the expressions they refer to
+func dhallResolve(file string) error {
+	cmd := dhallCommand("resolve", "--file", file)
+	cmd.Stderr = os.Stderr
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, out, 0644)
 }
 
 func dhallFormat(file string) error {
-	cmd := exec.Command("dhall", "format", "--inplace", file)
+	cmd := dhallCommand("format", "--inplace", file)
+	cmd.Stderr = os.Stderr
+	return runCommand(cmd)
+}
+
+// dhallLint removes unused let bindings and normalizes style beyond what dhall format does
+func dhallLint(file string) error {
+	cmd := dhallCommand("lint", "--inplace", file)
+	cmd.Stderr = os.Stderr
+	return runCommand(cmd)
+}
+
+// dhallNormalize replaces the expression in file with its beta-normal form
+func dhallNormalize(file string) error {
+	cmd := dhallCommand("normalize", "--file", file)
+	cmd.Stderr = os.Stderr
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, out, 0644)
+}
+
+// dhallTypeCheck checks that the record expression has the given type. Relative imports in the record
+// are resolved against the directory of the destination file.
+func dhallTypeCheck(ctx context.Context, record, dhallType string) error {
+	cmd := exec.CommandContext(ctx, "dhall", "type")
+	cmd.Env = secretEnvPlaceholders(subprocessEnv())
+	cmd.Dir = filepath.Dir(destinationFile)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("(%s) : (%s)", record, dhallType))
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = os.Stderr
+	return runCommand(cmd)
+}
+
+// dhallEncode writes the binary CBOR encoding of the expression in file to dst
+func dhallEncode(file, dst string) error {
+	cmd := dhallCommand("encode", "--file", file)
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, out, 0644)
+}
+
+// dhallCommand builds a dhall command line, passing on global options like --ascii
+func dhallCommand(args ...string) *exec.Cmd {
+	if asciiOutput {
+		args = append([]string{"--ascii"}, args...)
+	}
+	cmd := exec.Command("dhall", args...)
+	cmd.Env = subprocessEnv()
+	return cmd
 }
 
 func prependLine(file string, line string) error {
@@ -525,59 +1723,18 @@ func prependLine(file string, line string) error {
 
 	cmd := exec.Command("cp", tmpFile.Name(), file)
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return runCommand(cmd)
 }
 
 func logFatal(message string, ctx ...interface{}) {
 	log15.Error(message, ctx...)
-	os.Exit(1)
-}
-
-func buildComponents(rs *ResourceSet) map[string]interface{} {
-	record := make(map[string]interface{})
-
-	for component, resources := range rs.Components {
-		compRec := make(map[string]map[string]interface{})
-		record[strings.Title(component)] = compRec
-		for _, r := range resources {
-			kindRec := compRec[r.Kind]
-			if kindRec == nil {
-				kindRec = make(map[string]interface{})
-				compRec[r.Kind] = kindRec
-			}
-			km := make(map[string]interface{})
-			kindRec[r.Name] = km
-			if r.Kind == "Deployment" || r.Kind == "StatefulSet" || r.Kind == "DaemonSet" {
-				containers := make(map[string]interface{})
-				found := extractContainersMap(r.Contents, containers)
-				if found {
-					km["containers"] = containers
-				}
-			}
-		}
-	}
-
-	return record
-}
-
-func extractContainersMap(contents, containers map[string]interface{}) bool {
-	for k, v := range contents {
-		cm, ok := v.(map[string]interface{})
-
-		if k == "containers" && ok {
-			for ck := range cm {
-				containers[ck] = struct{}{}
-			}
-			return true
-		}
-
-		if ok {
-			found := extractContainersMap(cm, containers)
-			if found {
-				return true
-			}
+	removeStagedOutputs()
+	_ = stopProfiling()
+	if reportFile != "" && timings != nil {
+		// the report of a failed run lists the load errors and findings that made it fail
+		if err := writeRunReport(reported.set, reportFile); err != nil {
+			log15.Error("failed to write report", "error", err, "report", reportFile)
 		}
 	}
-
-	return false
+	os.Exit(1)
 }
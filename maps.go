@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mapField is a text map field of a resource that is emitted as a toMap expression
+// instead of the list literal yaml-to-dhall produces
+type mapField struct {
+	// kind restricts the field to resources of this kind, empty applies to all kinds
+	kind string
+	path []string
+}
+
+func (f mapField) String() string {
+	var labels []string
+	for _, p := range f.path {
+		labels = append(labels, dhallLabel(p))
+	}
+	return strings.Join(labels, ".")
+}
+
+// splitMap holds the values of a map field split off the resource contents
+type splitMap struct {
+	field  mapField
+	values map[string]string
+}
+
+func mapFields() []mapField {
+	fields := []mapField{
+		{path: []string{"metadata", "labels"}},
+		{path: []string{"metadata", "annotations"}},
+	}
+	if configMapDataToMap {
+		fields = append(fields, mapField{kind: "ConfigMap", path: []string{"data"}})
+	}
+	if secretsMode == "env" {
+		fields = append(fields, mapField{kind: "Secret", path: []string{"data"}}, mapField{kind: "Secret", path: []string{"stringData"}})
+	}
+	return fields
+}
+
+// splitMapFields returns a copy of the resource contents without the given map fields, and those maps
+// separately. Maps holding anything but text values are left in place for yaml-to-dhall to deal with.
+func splitMapFields(r *Resource, fields []mapField) (map[string]interface{}, []splitMap) {
+	contents := r.Contents
+	var splits []splitMap
+
+	for _, field := range fields {
+		if field.kind != "" && field.kind != r.Kind {
+			continue
+		}
+		values, ok := lookupTextMap(contents, field.path)
+		if !ok {
+			continue
+		}
+		contents = removePath(contents, field.path)
+		splits = append(splits, splitMap{field: field, values: values})
+	}
+
+	return contents, splits
+}
+
+func lookupTextMap(contents map[string]interface{}, path []string) (map[string]string, bool) {
+	var v interface{} = contents
+	for _, p := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		v = m[p]
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil, false
+	}
+
+	values := make(map[string]string)
+	for k, v := range m {
+		text, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		values[k] = text
+	}
+	return values, true
+}
+
+// removePath returns a copy of m without the value at path, copying only the maps along the path
+func removePath(m map[string]interface{}, path []string) map[string]interface{} {
+	if len(path) == 0 {
+		return m
+	}
+
+	c := make(map[string]interface{})
+	for k, v := range m {
+		c[k] = v
+	}
+
+	if len(path) == 1 {
+		delete(c, path[0])
+		return c
+	}
+
+	child, ok := m[path[0]].(map[string]interface{})
+	if !ok {
+		return m
+	}
+	c[path[0]] = removePath(child, path[1:])
+	return c
+}
+
+// withMapFields sets the maps split off by splitMapFields on the converted expression, rendering every
+// value with valueExpr
+func withMapFields(expr string, splits []splitMap, valueExpr func(field mapField, key, value string) (string, error)) (string, error) {
+	for _, split := range splits {
+		exprs := make(map[string]string)
+		for k, v := range split.values {
+			e, err := valueExpr(split.field, k, v)
+			if err != nil {
+				return "", err
+			}
+			exprs[k] = e
+		}
+		expr = fmt.Sprintf("(%s) with %s = Some (%s)", expr, split.field, dhallToMapExprs(exprs))
+	}
+	return expr, nil
+}
+
+// mapValueExpr renders map values as text literals, except for ConfigMap data values larger than the
+// configured threshold which are written to their own file and imported as Text, and Secret values
+// imported from the environment with --secrets env
+func mapValueExpr(r *Resource) func(field mapField, key, value string) (string, error) {
+	// the files are laid out like the record without the kind level, eg <component>/<name>/<key>
+	path := recordPath(r)
+	dir := append(append([]string{configMapDataDir}, path[:len(path)-2]...), path[len(path)-1])
+	return func(field mapField, key, value string) (string, error) {
+		if field.kind == "Secret" && isSecret(r) {
+			return secretEnvImport(r, field, key)
+		}
+		if field.kind != "ConfigMap" || configMapDataDir == "" || len(value) <= configMapDataThreshold {
+			return dhallText(value), nil
+		}
+		return externalizeText(filepath.Join(append(dir, key)...), value, recordFile(r))
+	}
+}
+
+// externalizeText writes value to file and returns an import of it as Text, relative to the generated file
+// importing it
+func externalizeText(file, value, importer string) (string, error) {
+	written := stageOutput(file)
+	err := os.MkdirAll(filepath.Dir(written), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(written, []byte(value), 0644)
+	if err != nil {
+		return "", err
+	}
+	recordOutput(written)
+
+	// staged outputs are laid out like the configured ones, the import is the same
+	absFile, err := filepath.Abs(written)
+	if err != nil {
+		return "", err
+	}
+	absDst, err := filepath.Abs(importer)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(filepath.Dir(absDst), absFile)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s as Text", dhallLocalImport(rel)), nil
+}
+
+// dhallLocalImport renders a relative file path as a dhall local import, quoting path components
+// that contain characters not allowed in plain import paths
+func dhallLocalImport(rel string) string {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for idx, p := range parts {
+		if p != "." && p != ".." && !isPlainPathComponent(p) {
+			parts[idx] = `"` + p + `"`
+		}
+	}
+
+	path := strings.Join(parts, "/")
+	if parts[0] != ".." {
+		path = "./" + path
+	}
+	return path
+}
+
+func isPlainPathComponent(p string) bool {
+	if p == "" {
+		return false
+	}
+	for _, c := range p {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestSplitMapFields(t *testing.T) {
+	r := &Resource{
+		Kind: "Service",
+		Contents: map[string]interface{}{
+			"kind": "Service",
+			"metadata": map[string]interface{}{
+				"name":        "frontend",
+				"labels":      map[string]interface{}{"deploy": "sourcegraph"},
+				"annotations": map[string]interface{}{"replicas": 3},
+			},
+			"data": map[string]interface{}{"key": "value"},
+		},
+	}
+	fields := []mapField{
+		{path: []string{"metadata", "labels"}},
+		{path: []string{"metadata", "annotations"}},
+		{kind: "ConfigMap", path: []string{"data"}},
+	}
+
+	stripped, splits := splitMapFields(r, fields)
+
+	metadata := stripped["metadata"].(map[string]interface{})
+	if _, ok := metadata["labels"]; ok {
+		t.Errorf("expected labels to be split off")
+	}
+	if _, ok := metadata["annotations"]; !ok {
+		t.Errorf("expected annotations with non text values to be kept")
+	}
+	if _, ok := stripped["data"]; !ok {
+		t.Errorf("expected data of a non ConfigMap to be kept")
+	}
+	if len(splits) != 1 || splits[0].field.String() != "metadata.labels" || splits[0].values["deploy"] != "sourcegraph" {
+		t.Errorf("expected only labels to be split, got %v", splits)
+	}
+	if _, ok := r.Contents["metadata"].(map[string]interface{})["labels"]; !ok {
+		t.Errorf("expected original contents to be left untouched")
+	}
+}
+
+func TestDhallLocalImport(t *testing.T) {
+	fixtures := []struct {
+		rel      string
+		expected string
+	}{
+		{rel: "configmaps/Frontend/nginx/nginx.conf", expected: "./configmaps/Frontend/nginx/nginx.conf"},
+		{rel: "../data/My Component/x", expected: `../data/"My Component"/x`},
+	}
+
+	for _, fx := range fixtures {
+		got := dhallLocalImport(fx.rel)
+		if got != fx.expected {
+			t.Errorf("expected %s, got %s", fx.expected, got)
+		}
+	}
+}
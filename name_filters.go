@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// namePattern matches resource names, optionally only of one kind
+type namePattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// scopedPatternRegexp splits patterns of the form Kind:regexp, kinds are PascalCase identifiers
+var scopedPatternRegexp = regexp.MustCompile(`^([A-Z][A-Za-z0-9]*):(.*)$`)
+
+// parseNamePatterns parses [Kind:]regexp patterns, the regexp has to match the whole name
+func parseNamePatterns(specs []string) ([]namePattern, error) {
+	var patterns []namePattern
+	for _, spec := range specs {
+		var p namePattern
+		expr := spec
+		if m := scopedPatternRegexp.FindStringSubmatch(spec); m != nil {
+			p.kind, expr = m[1], m[2]
+		}
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %v", spec, err)
+		}
+		p.re = re
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+func (p namePattern) appliesTo(r *Resource) bool {
+	return p.kind == "" || p.kind == r.Kind
+}
+
+var includeNames, excludeNames []namePattern
+
+// matchesNames keeps the resources matched by one of the --include-name patterns applying to their kind, if any,
+// and by none of the --exclude-name patterns
+func matchesNames(r *Resource) (bool, error) {
+	included, constrained := false, false
+	for _, p := range includeNames {
+		if !p.appliesTo(r) {
+			continue
+		}
+		constrained = true
+		if p.re.MatchString(r.Name) {
+			included = true
+			break
+		}
+	}
+	if constrained && !included {
+		return false, nil
+	}
+
+	for _, p := range excludeNames {
+		if p.appliesTo(r) && p.re.MatchString(r.Name) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestMatchesNames(t *testing.T) {
+	var err error
+	includeNames, err = parseNamePatterns([]string{"ConfigMap:frontend-.*"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	excludeNames, err = parseNamePatterns([]string{"legacy-.*", "Service:frontend-internal"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { includeNames, excludeNames = nil, nil }()
+
+	testCases := []struct {
+		kind     string
+		name     string
+		expected bool
+	}{
+		{"ConfigMap", "frontend-env", true},
+		{"ConfigMap", "gitserver-env", false},
+		{"ConfigMap", "my-frontend-env", false},
+		{"Deployment", "gitserver", true},
+		{"Deployment", "legacy-gitserver", false},
+		{"Service", "frontend-internal", false},
+		{"Deployment", "frontend-internal", true},
+	}
+
+	for _, tc := range testCases {
+		keep, err := matchesNames(&Resource{Kind: tc.kind, Name: tc.name})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if keep != tc.expected {
+			t.Errorf("%s %s: expected %t, got %t", tc.kind, tc.name, tc.expected, keep)
+		}
+	}
+
+	_, err = parseNamePatterns([]string{"("})
+	if err == nil {
+		t.Errorf("expected an error for an invalid regexp")
+	}
+}
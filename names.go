@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nameReference is a field naming another resource of kind, relative to a pod spec or to the resource itself
+type nameReference struct {
+	kind string
+	path string
+}
+
+// podSpecNameReferences are the fields of a pod spec referring to other resources by name
+var podSpecNameReferences = []nameReference{
+	{kind: "ConfigMap", path: ".volumes[*].configMap.name"},
+	{kind: "ConfigMap", path: ".volumes[*].projected.sources[*].configMap.name"},
+	{kind: "ConfigMap", path: ".containers[*].envFrom[*].configMapRef.name"},
+	{kind: "ConfigMap", path: ".containers[*].env[*].valueFrom.configMapKeyRef.name"},
+	{kind: "ConfigMap", path: ".initContainers[*].envFrom[*].configMapRef.name"},
+	{kind: "ConfigMap", path: ".initContainers[*].env[*].valueFrom.configMapKeyRef.name"},
+	{kind: "Secret", path: ".volumes[*].secret.secretName"},
+	{kind: "Secret", path: ".volumes[*].projected.sources[*].secret.name"},
+	{kind: "Secret", path: ".containers[*].envFrom[*].secretRef.name"},
+	{kind: "Secret", path: ".containers[*].env[*].valueFrom.secretKeyRef.name"},
+	{kind: "Secret", path: ".initContainers[*].envFrom[*].secretRef.name"},
+	{kind: "Secret", path: ".initContainers[*].env[*].valueFrom.secretKeyRef.name"},
+	{kind: "Secret", path: ".imagePullSecrets[*].name"},
+	{kind: "PersistentVolumeClaim", path: ".volumes[*].persistentVolumeClaim.claimName"},
+	{kind: "ServiceAccount", path: ".serviceAccountName"},
+}
+
+// resourceNameReferences are the fields of resources of a kind referring to other resources by name
+var resourceNameReferences = map[string][]nameReference{
+	"StatefulSet": {{kind: "Service", path: ".spec.serviceName"}},
+	"Ingress": {
+		{kind: "Service", path: ".spec.backend.serviceName"},
+		{kind: "Service", path: ".spec.rules[*].http.paths[*].backend.serviceName"},
+		{kind: "Service", path: ".spec.defaultBackend.service.name"},
+		{kind: "Service", path: ".spec.rules[*].http.paths[*].backend.service.name"},
+		{kind: "Secret", path: ".spec.tls[*].secretName"},
+	},
+	"HorizontalPodAutoscaler": {{kind: "", path: ".spec.scaleTargetRef"}},
+	"RoleBinding":             {{kind: "", path: ".roleRef"}, {kind: "", path: ".subjects[*]"}},
+	"ClusterRoleBinding":      {{kind: "", path: ".roleRef"}, {kind: "", path: ".subjects[*]"}},
+}
+
+// generatedNameCounters count the resources sharing a kind and generateName
+var generatedNameCounters = make(map[string]int)
+
+// generatedName derives the record key of a resource without name from its generateName and --generate-name-suffix
+func generatedName(kind, generateName string) string {
+	key := kind + "/" + generateName
+	generatedNameCounters[key]++
+	suffix := generateNameSuffix
+	if strings.Contains(suffix, "%") {
+		suffix = fmt.Sprintf(suffix, generatedNameCounters[key])
+	}
+	return generateName + suffix
+}
+
+// podSpecPath returns the location of the pod spec in workload kinds
+func podSpecPath(kind string) (fieldPath, bool) {
+	if kind == "Pod" {
+		return fieldPath{{key: "spec"}}, true
+	}
+	template, ok := podTemplateMetadata[kind]
+	if !ok {
+		return nil, false
+	}
+	return append(template[:len(template)-1:len(template)-1], pathElem{key: "spec"}), true
+}
+
+// renamedResources holds the names of the loaded resources by kind, references to them are renamed too
+var renamedResources map[string]map[string]bool
+
+func collectResourceNames(rs *ResourceSet) error {
+	renamedResources = make(map[string]map[string]bool)
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			if renamedResources[r.Kind] == nil {
+				renamedResources[r.Kind] = make(map[string]bool)
+			}
+			renamedResources[r.Kind][r.Name] = true
+		}
+	}
+	return nil
+}
+
+func affixName(name string) string {
+	return namePrefix + name + nameSuffix
+}
+
+// renameResource applies --name-prefix and --name-suffix to the resource name and to the references to other
+// loaded resources, so that for instance a Deployment keeps mounting its renamed ConfigMap
+func renameResource(r *Resource) error {
+	metadata, ok := r.Contents["metadata"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("resource is missing metadata")
+	}
+	r.Name = affixName(r.Name)
+	if generateName, ok := metadata["generateName"].(string); ok && metadata["name"] == nil {
+		// the name is generated by the API server, only the prefix applies
+		metadata["generateName"] = namePrefix + generateName
+	} else {
+		metadata["name"] = r.Name
+	}
+
+	var refs []nameReference
+	if spec, ok := podSpecPath(r.Kind); ok {
+		for _, ref := range podSpecNameReferences {
+			refs = append(refs, nameReference{kind: ref.kind, path: spec.String() + ref.path})
+		}
+	}
+	refs = append(refs, resourceNameReferences[r.Kind]...)
+
+	for _, ref := range refs {
+		path, err := parseFieldPath(ref.path)
+		if err != nil {
+			return err
+		}
+		updatePath(r.Contents, path, func(v interface{}) interface{} {
+			if ref.kind == "" {
+				return renameObjectReference(v)
+			}
+			return renameReference(ref.kind, v)
+		})
+	}
+	return nil
+}
+
+func renameReference(kind string, v interface{}) interface{} {
+	name, ok := v.(string)
+	if !ok || !renamedResources[kind][name] {
+		return v
+	}
+	return affixName(name)
+}
+
+// renameObjectReference renames references holding both the kind and the name of the target, like roleRef
+func renameObjectReference(v interface{}) interface{} {
+	ref, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	kind, _ := ref["kind"].(string)
+	ref["name"] = renameReference(kind, ref["name"])
+	return ref
+}
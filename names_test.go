@@ -0,0 +1,123 @@
+package main
+
+import "testing"
+
+func TestRenameResource(t *testing.T) {
+	namePrefix, nameSuffix = "staging-", ""
+	defer func() { namePrefix, nameSuffix = "", "" }()
+
+	deployment := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      serviceAccountName: frontend
+      containers:
+        - name: frontend
+          envFrom:
+            - configMapRef:
+                name: frontend-env
+            - configMapRef:
+                name: external-env
+      volumes:
+        - name: config
+          configMap:
+            name: frontend-env
+`)
+	binding := decodeTestResource(t, `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: frontend
+roleRef:
+  kind: Role
+  name: frontend
+subjects:
+  - kind: ServiceAccount
+    name: frontend
+  - kind: User
+    name: frontend
+`)
+	rs := ResourceSet{Components: map[string][]*Resource{"frontend": {deployment, binding}}}
+	rs.Components["frontend"] = append(rs.Components["frontend"],
+		decodeTestResource(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: frontend-env\n"),
+		decodeTestResource(t, "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: frontend\n"),
+		decodeTestResource(t, "apiVersion: rbac.authorization.k8s.io/v1\nkind: Role\nmetadata:\n  name: frontend\n"),
+	)
+
+	err := collectResourceNames(&rs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, r := range []*Resource{deployment, binding} {
+		err = renameResource(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if deployment.Name != "staging-frontend" {
+		t.Errorf("expected name staging-frontend, got %s", deployment.Name)
+	}
+	assertContents(t, deployment, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: staging-frontend
+spec:
+  template:
+    spec:
+      serviceAccountName: staging-frontend
+      containers:
+        - name: frontend
+          envFrom:
+            - configMapRef:
+                name: staging-frontend-env
+            - configMapRef:
+                name: external-env
+      volumes:
+        - name: config
+          configMap:
+            name: staging-frontend-env
+`)
+	assertContents(t, binding, `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: staging-frontend
+roleRef:
+  kind: Role
+  name: staging-frontend
+subjects:
+  - kind: ServiceAccount
+    name: staging-frontend
+  - kind: User
+    name: frontend
+`)
+}
+
+func TestGeneratedName(t *testing.T) {
+	generateNameSuffix = "%d"
+	defer func() {
+		generateNameSuffix = ""
+		generatedNameCounters = make(map[string]int)
+	}()
+
+	expected := []string{"migrate-1", "migrate-2"}
+	for _, e := range expected {
+		if got := generatedName("Job", "migrate-"); got != e {
+			t.Errorf("expected %s, got %s", e, got)
+		}
+	}
+	if got := generatedName("Pod", "migrate-"); got != "migrate-1" {
+		t.Errorf("expected counters per kind, got %s", got)
+	}
+
+	generateNameSuffix = "generated"
+	if got := generatedName("Job", "backup-"); got != "backup-generated" {
+		t.Errorf("expected backup-generated, got %s", got)
+	}
+}
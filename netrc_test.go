@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	netrc := strings.Fields(`
+machine github.com login gh password ghtoken
+machine artifactory.internal
+  login ci
+  password secret
+default login anonymous password guest
+`)
+
+	fixtures := []struct {
+		host     string
+		login    string
+		password string
+	}{
+		{host: "artifactory.internal", login: "ci", password: "secret"},
+		{host: "github.com", login: "gh", password: "ghtoken"},
+		{host: "example.com", login: "anonymous", password: "guest"},
+	}
+
+	for _, fx := range fixtures {
+		login, password, found, err := parseNetrc(netrc, fx.host)
+		if err != nil {
+			t.Errorf("unexpected error for host %s: %v", fx.host, err)
+		}
+		if !found || login != fx.login || password != fx.password {
+			t.Errorf("expected %s/%s for host %s, got %s/%s (found %t)", fx.login, fx.password, fx.host, login, password, found)
+		}
+	}
+
+	_, _, found, _ := parseNetrc(strings.Fields("machine github.com login gh password x"), "example.com")
+	if found {
+		t.Errorf("expected no credentials for unknown host without default")
+	}
+}
+
+func TestDhallHeadersEnvKeepsExistingHeaders(t *testing.T) {
+	defer func(url, path string, headers []string) {
+		schemaURL, schemaPath, schemaHeaders = url, path, headers
+	}(schemaURL, schemaPath, schemaHeaders)
+	schemaURL, schemaPath, schemaHeaders = "https://mirror.internal/k8s/schemas.dhall", "", []string{"Private-Token: secret"}
+	defer os.Setenv("DHALL_HEADERS", os.Getenv("DHALL_HEADERS"))
+
+	ours := `toMap { ` + "`mirror.internal:443`" + ` = [ { mapKey = "Private-Token", mapValue = "secret" } ] }`
+	os.Setenv("DHALL_HEADERS", "")
+	entry, err := dhallHeadersEnv()
+	if err != nil || entry != "DHALL_HEADERS="+ours {
+		t.Errorf("expected the schema host headers, got %q, %v", entry, err)
+	}
+
+	existing := `toMap { ` + "`github.com:443`" + ` = [ { mapKey = "Authorization", mapValue = "token gh" } ] }`
+	os.Setenv("DHALL_HEADERS", existing)
+	entry, err = dhallHeadersEnv()
+	if err != nil || entry != "DHALL_HEADERS=("+existing+") # "+ours {
+		t.Errorf("expected the headers of the environment to be kept, got %q, %v", entry, err)
+	}
+}
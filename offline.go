@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// offlineProxy is an address nothing listens on, subprocesses are pointed at it as proxy with --offline so any
+// remote import they attempt fails instead of reaching the network
+const offlineProxy = "http://127.0.0.1:9"
+
+// offlineTransport refuses every request made with --offline
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("network access to %s is disabled by --offline", req.URL)
+}
+
+// isRemote reports whether an import location is fetched from the network once the import mappings are applied
+func isRemote(location string) bool {
+	return strings.Contains(mapImport(importMappings, location), "://")
+}
+
+// checkOffline fails if the configuration requires network access
+func checkOffline() error {
+	var remote []string
+	if schemaPath == "" && isRemote(schemaURL) {
+		remote = append(remote, fmt.Sprintf("k8s schemas %s", schemaURL))
+	}
+	packages, err := parseSchemaPackages(schemaPackages)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range packages {
+		if isRemote(pkg.location) {
+			remote = append(remote, fmt.Sprintf("schema package %s %s", pkg.name, pkg.location))
+		}
+	}
+	if unknownKind == "json" && isRemote(PreludeJSONType) {
+		remote = append(remote, fmt.Sprintf("JSON type %s of --unknown-kind json", PreludeJSONType))
+	}
+	if len(remote) > 0 {
+		return fmt.Errorf("--offline requires local imports, use --k8s-schema-path, local schema packages or --import-map for: %s",
+			strings.Join(remote, ", "))
+	}
+
+	if signKeyless {
+		return fmt.Errorf("--offline can't be combined with --sign-keyless, which requests a certificate")
+	}
+	return nil
+}
+
+// enableOffline disables network access of this process and of the subprocesses started with subprocessEnv
+func enableOffline() {
+	httpClient.Transport = offlineTransport{}
+	http.DefaultTransport = offlineTransport{}
+}
+
+// offlineEnv points the proxies of subprocesses at offlineProxy
+func offlineEnv(env []string) []string {
+	var filtered []string
+	for _, kv := range env {
+		name := strings.ToUpper(strings.SplitN(kv, "=", 2)[0])
+		if name != "HTTP_PROXY" && name != "HTTPS_PROXY" && name != "ALL_PROXY" && name != "NO_PROXY" {
+			filtered = append(filtered, kv)
+		}
+	}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "http_proxy", "https_proxy", "all_proxy"} {
+		filtered = append(filtered, name+"="+offlineProxy)
+	}
+	return filtered
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckOffline(t *testing.T) {
+	defer func() { schemaURL, importMappings = DefaultSchemaURL, nil }()
+
+	schemaURL = DefaultSchemaURL
+	err := checkOffline()
+	if err == nil || !strings.Contains(err.Error(), DefaultSchemaURL) {
+		t.Errorf("expected error naming the remote k8s schemas, got %v", err)
+	}
+
+	importMappings = []importMapping{{prefix: "https://raw.githubusercontent.com/dhall-lang/dhall-kubernetes", replacement: "./vendor/dhall-kubernetes"}}
+	err = checkOffline()
+	if err != nil {
+		t.Errorf("unexpected error with the schemas mapped to a local path: %v", err)
+	}
+}
+
+func TestOfflineNetwork(t *testing.T) {
+	client := &http.Client{Transport: offlineTransport{}}
+	_, err := client.Get("https://example.com/")
+	if err == nil || !strings.Contains(err.Error(), "disabled by --offline") {
+		t.Errorf("expected request to be refused, got %v", err)
+	}
+
+	env := offlineEnv([]string{"PATH=/bin", "https_proxy=http://proxy:3128", "NO_PROXY=localhost"})
+	expected := []string{"PATH=/bin", "HTTP_PROXY=" + offlineProxy, "HTTPS_PROXY=" + offlineProxy, "ALL_PROXY=" + offlineProxy,
+		"http_proxy=" + offlineProxy, "https_proxy=" + offlineProxy, "all_proxy=" + offlineProxy}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %v, got %v", expected, env)
+	}
+}
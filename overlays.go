@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/inconshreveable/log15"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// kustomizationOutput is a kustomization written by the overlays command
+type kustomizationOutput struct {
+	APIVersion            string   `yaml:"apiVersion"`
+	Kind                  string   `yaml:"kind"`
+	Resources             []string `yaml:"resources"`
+	PatchesStrategicMerge []string `yaml:"patchesStrategicMerge,omitempty"`
+}
+
+func newKustomization(resources, patches []string) kustomizationOutput {
+	return kustomizationOutput{
+		APIVersion:            "kustomize.config.k8s.io/v1beta1",
+		Kind:                  "Kustomization",
+		Resources:             resources,
+		PatchesStrategicMerge: patches,
+	}
+}
+
+func runOverlays(args []string) {
+	fs := flag.NewFlagSet("overlays", flag.ExitOnError)
+	outDir := fs.StringP("out-dir", "o", "", "(required) directory the kustomize base and overlays are written to")
+	var envs []string
+	fs.StringArrayVar(&envs, "env", nil, "(required) environment an overlay is scaffolded for (repeatable)")
+	addAuthFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of ds-to-dhall overlays: --out-dir <dir> --env <env>... <record file>\n")
+		fmt.Fprintln(os.Stderr, "Renders a generated record into a kustomize base at <dir>/base, a yaml file per component, and scaffolds an")
+		fmt.Fprintln(os.Stderr, "overlay per environment at <dir>/overlays/<env> with a patch per component. Existing overlay files are kept.")
+		fmt.Fprintln(os.Stderr, "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *outDir == "" || len(envs) == 0 || fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	file := fs.Arg(0)
+
+	log15.Info("rendering record", "file", file)
+	record, err := renderRecord(file)
+	if err != nil {
+		logFatal("failed to render record", "error", err, "file", file)
+	}
+	resources, err := renderedResources(record)
+	if err != nil {
+		logFatal("failed to collect resources", "error", err, "file", file)
+	}
+	files, err := goldenFiles(resources)
+	if err != nil {
+		logFatal("failed to group resources by component", "error", err, "file", file)
+	}
+
+	err = writeBase(filepath.Join(*outDir, "base"), files)
+	if err != nil {
+		logFatal("failed to write kustomize base", "error", err, "outDir", *outDir)
+	}
+	for _, env := range envs {
+		err = scaffoldOverlay(filepath.Join(*outDir, "overlays", env), files)
+		if err != nil {
+			logFatal("failed to scaffold overlay", "error", err, "env", env)
+		}
+	}
+
+	log15.Info("done", "components", len(files), "overlays", len(envs))
+}
+
+// writeBase writes the rendered components and the kustomization listing them to dir
+func writeBase(dir string, files map[string][]renderedResource) error {
+	var names []string
+	for name, resources := range files {
+		documents, err := encodeDocuments(resources)
+		if err != nil {
+			return err
+		}
+		err = writeOverlayFile(filepath.Join(dir, name), documents, true)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(name))
+	}
+	sort.Strings(names)
+
+	contents, err := yaml.Marshal(newKustomization(names, nil))
+	if err != nil {
+		return err
+	}
+	return writeOverlayFile(filepath.Join(dir, "kustomization.yaml"), contents, true)
+}
+
+// scaffoldOverlay writes an overlay of the base to dir, with a patch per component matching its resources without
+// changing anything, as a starting point for the environment. Files already there are left alone.
+func scaffoldOverlay(dir string, files map[string][]renderedResource) error {
+	var patches []string
+	for name, resources := range files {
+		var stubs []renderedResource
+		for _, r := range resources {
+			stubs = append(stubs, renderedResource{path: r.path, contents: patchStub(r.contents)})
+		}
+		documents, err := encodeDocuments(stubs)
+		if err != nil {
+			return err
+		}
+		patch := filepath.Join("patches", name)
+		err = writeOverlayFile(filepath.Join(dir, patch), documents, false)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, filepath.ToSlash(patch))
+	}
+	sort.Strings(patches)
+
+	base, err := filepath.Rel(dir, filepath.Join(filepath.Dir(filepath.Dir(dir)), "base"))
+	if err != nil {
+		return err
+	}
+	contents, err := yaml.Marshal(newKustomization([]string{filepath.ToSlash(base)}, patches))
+	if err != nil {
+		return err
+	}
+	return writeOverlayFile(filepath.Join(dir, "kustomization.yaml"), contents, false)
+}
+
+// patchStub is a strategic merge patch identifying a resource by apiVersion, kind, name and namespace
+func patchStub(contents map[string]interface{}) map[string]interface{} {
+	metadata, _ := contents["metadata"].(map[string]interface{})
+	stubMetadata := map[string]interface{}{"name": metadata["name"]}
+	if namespace, ok := metadata["namespace"]; ok {
+		stubMetadata["namespace"] = namespace
+	}
+	return map[string]interface{}{
+		"apiVersion": contents["apiVersion"],
+		"kind":       contents["kind"],
+		"metadata":   stubMetadata,
+	}
+}
+
+// writeOverlayFile writes contents to file, only if it doesn't exist yet unless overwrite is set
+func writeOverlayFile(file string, contents []byte, overwrite bool) error {
+	if _, err := os.Stat(file); err == nil && !overwrite {
+		log15.Info("keeping existing file", "file", file)
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, 0644)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestScaffoldOverlays(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]renderedResource{
+		"Frontend.yaml": {{
+			path: []string{"Frontend", "Deployment", "frontend"},
+			contents: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "frontend", "namespace": "prod", "labels": map[string]interface{}{"app": "frontend"}},
+				"spec":       map[string]interface{}{"replicas": 1},
+			},
+		}},
+	}
+
+	err := writeBase(filepath.Join(dir, "base"), files)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	overlay := filepath.Join(dir, "overlays", "staging")
+	err = scaffoldOverlay(overlay, files)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for file, expected := range map[string]string{
+		"base/kustomization.yaml": "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n    - Frontend.yaml\n",
+		"overlays/staging/kustomization.yaml": "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n    - ../../base\n" +
+			"patchesStrategicMerge:\n    - patches/Frontend.yaml\n",
+		"overlays/staging/patches/Frontend.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n    name: frontend\n    namespace: prod\n",
+	} {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != expected {
+			t.Errorf("%s: expected %q, got %q", file, expected, contents)
+		}
+	}
+
+	patch := filepath.Join(overlay, "patches", "Frontend.yaml")
+	err = ioutil.WriteFile(patch, []byte("edited\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = scaffoldOverlay(overlay, files)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if contents, _ := ioutil.ReadFile(patch); string(contents) != "edited\n" {
+		t.Errorf("expected the edited patch to be kept, got %q", contents)
+	}
+}
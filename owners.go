@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/inconshreveable/log15"
+)
+
+// ownerKey identifies an owner by kind and name, the uid is compared too when both sides have one
+type ownerKey struct {
+	kind string
+	name string
+}
+
+// resourceOwner returns the controller owner reference of a resource, or its first owner reference
+func resourceOwner(r *Resource) (ownerKey, string, bool) {
+	metadata, _ := r.Contents["metadata"].(map[string]interface{})
+	refs, _ := metadata["ownerReferences"].([]interface{})
+
+	var owner map[string]interface{}
+	for _, ref := range refs {
+		m, ok := ref.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if owner == nil {
+			owner = m
+		}
+		if controller, _ := m["controller"].(bool); controller {
+			owner = m
+			break
+		}
+	}
+	if owner == nil {
+		return ownerKey{}, "", false
+	}
+
+	kind, _ := owner["kind"].(string)
+	name, _ := owner["name"].(string)
+	uid, _ := owner["uid"].(string)
+	return ownerKey{kind: kind, name: name}, uid, kind != "" && name != ""
+}
+
+func resourceUID(r *Resource) string {
+	metadata, _ := r.Contents["metadata"].(map[string]interface{})
+	uid, _ := metadata["uid"].(string)
+	return uid
+}
+
+// groupByOwner moves the resources whose component was derived from their directory to the component of their
+// owner, following chains of owners like Pod -> ReplicaSet -> Deployment
+func groupByOwner(rs *ResourceSet) {
+	byKey := make(map[ownerKey][]*Resource)
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			key := ownerKey{kind: r.Kind, name: r.Name}
+			byKey[key] = append(byKey[key], r)
+		}
+	}
+
+	lookup := func(r *Resource) *Resource {
+		key, uid, ok := resourceOwner(r)
+		if !ok {
+			return nil
+		}
+		for _, candidate := range byKey[key] {
+			if uid == "" || resourceUID(candidate) == "" || uid == resourceUID(candidate) {
+				return candidate
+			}
+		}
+		return nil
+	}
+
+	moved := make(map[*Resource]string)
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			if !r.DirectoryComponent {
+				continue
+			}
+			owner := lookup(r)
+			// the loop is bounded in case of malformed cyclic references
+			for depth := 0; owner != nil && owner.DirectoryComponent && depth < 16; depth++ {
+				next := lookup(owner)
+				if next == nil {
+					break
+				}
+				owner = next
+			}
+			if owner != nil && owner.Component != r.Component {
+				moved[r] = owner.Component
+			}
+		}
+	}
+
+	for r, component := range moved {
+		log15.Debug("grouping resource under its owner", "manifest", r.Source, "component", component)
+		resources := rs.Components[r.Component]
+		for idx, candidate := range resources {
+			if candidate == r {
+				rs.Components[r.Component] = append(resources[:idx:idx], resources[idx+1:]...)
+				break
+			}
+		}
+		if len(rs.Components[r.Component]) == 0 {
+			delete(rs.Components, r.Component)
+		}
+		r.Component = component
+		rs.Components[component] = append(rs.Components[component], r)
+	}
+}
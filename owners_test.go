@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func TestGroupByOwner(t *testing.T) {
+	deployment := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: redis
+  uid: d1
+`)
+	deployment.Component = "redis"
+
+	replicaSet := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: ReplicaSet
+metadata:
+  name: redis-5d9f
+  uid: r1
+  ownerReferences:
+    - apiVersion: apps/v1
+      kind: Deployment
+      name: redis
+      uid: d1
+      controller: true
+`)
+	replicaSet.Component, replicaSet.DirectoryComponent = "generated", true
+
+	pod := decodeTestResource(t, `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: redis-5d9f-x2x
+  ownerReferences:
+    - apiVersion: apps/v1
+      kind: ReplicaSet
+      name: redis-5d9f
+      uid: r1
+`)
+	pod.Component, pod.DirectoryComponent = "generated", true
+
+	orphan := decodeTestResource(t, `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: other
+  ownerReferences:
+    - apiVersion: apps/v1
+      kind: ReplicaSet
+      name: redis-5d9f
+      uid: mismatch
+`)
+	orphan.Component, orphan.DirectoryComponent = "generated", true
+
+	rs := ResourceSet{Components: map[string][]*Resource{
+		"redis":     {deployment},
+		"generated": {replicaSet, pod, orphan},
+	}}
+	groupByOwner(&rs)
+
+	if len(rs.Components["redis"]) != 3 || len(rs.Components["generated"]) != 1 {
+		t.Fatalf("expected 3 resources in redis and 1 in generated, got %d and %d",
+			len(rs.Components["redis"]), len(rs.Components["generated"]))
+	}
+	for _, r := range []*Resource{replicaSet, pod} {
+		if r.Component != "redis" {
+			t.Errorf("%s: expected component redis, got %s", r.Name, r.Component)
+		}
+	}
+	if orphan.Component != "generated" {
+		t.Errorf("expected the pod with a mismatched owner uid to keep its component, got %s", orphan.Component)
+	}
+}
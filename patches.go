@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// patchTarget selects the resources a patch applies to, by API group, kind, name and optionally namespace
+type patchTarget struct {
+	Group     string `yaml:"group"`
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+// jsonPatchOp is an RFC 6902 operation
+type jsonPatchOp struct {
+	Op    string      `yaml:"op"`
+	Path  string      `yaml:"path"`
+	From  string      `yaml:"from"`
+	Value interface{} `yaml:"value"`
+}
+
+// patch is either a strategic merge patch (a partial resource) or a JSON6902 patch document of the form
+// {target: {group, kind, name}, patch: [{op, path, value}]}
+type patch struct {
+	source    string
+	target    patchTarget
+	merge     map[string]interface{}
+	jsonPatch []jsonPatchOp
+	applied   bool
+}
+
+// apiGroup returns the group of an apiVersion, empty for the core group
+func apiGroup(apiVersion string) string {
+	if idx := strings.Index(apiVersion, "/"); idx >= 0 {
+		return apiVersion[:idx]
+	}
+	return ""
+}
+
+func (p *patch) matches(r *Resource) bool {
+	if p.target.Kind != r.Kind || p.target.Name != r.Name || p.target.Group != apiGroup(r.ApiVersion) {
+		return false
+	}
+	if p.target.Namespace == "" {
+		return true
+	}
+	metadata, _ := r.Contents["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	return namespace == p.target.Namespace
+}
+
+// loadPatches reads the patch documents of the given files and of the yaml files in the given directories
+func loadPatches(locations []string) ([]*patch, error) {
+	var patches []*patch
+	for _, location := range locations {
+		err := filepath.Walk(location, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			if path != location && !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml") {
+				return nil
+			}
+			filePatches, err := loadPatchFile(path)
+			if err != nil {
+				return err
+			}
+			patches = append(patches, filePatches...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return patches, nil
+}
+
+func loadPatchFile(file string) ([]*patch, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []*patch
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	for idx := 1; ; idx++ {
+		var doc map[string]interface{}
+		err = decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode patch %s: %v", file, err)
+		}
+		if doc == nil {
+			continue
+		}
+
+		p, err := parsePatch(doc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid patch %d in %s: %v", idx, file, err)
+		}
+		p.source = fmt.Sprintf("%s#%d", file, idx)
+		patches = append(patches, p)
+	}
+	return patches, nil
+}
+
+func parsePatch(doc map[string]interface{}) (*patch, error) {
+	if _, ok := doc["patch"]; ok {
+		var jp struct {
+			Target patchTarget   `yaml:"target"`
+			Patch  []jsonPatchOp `yaml:"patch"`
+		}
+		// round trip through yaml to decode the generic document into the struct
+		b, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		err = yaml.Unmarshal(b, &jp)
+		if err != nil {
+			return nil, err
+		}
+		if jp.Target.Kind == "" || jp.Target.Name == "" {
+			return nil, fmt.Errorf("JSON6902 patch target needs a kind and a name")
+		}
+		return &patch{target: jp.Target, jsonPatch: jp.Patch}, nil
+	}
+
+	apiVersion, _ := doc["apiVersion"].(string)
+	kind, _ := doc["kind"].(string)
+	metadata, _ := doc["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+	if kind == "" || name == "" {
+		return nil, fmt.Errorf("strategic merge patch needs a kind and a metadata.name")
+	}
+	return &patch{target: patchTarget{Group: apiGroup(apiVersion), Kind: kind, Name: name, Namespace: namespace}, merge: doc}, nil
+}
+
+// mergeKeys are the keys identifying the elements of lists merged by strategic merge patches, lists not listed
+// here are replaced
+var mergeKeys = map[string][]string{
+	"containers":          {"name"},
+	"initContainers":      {"name"},
+	"ephemeralContainers": {"name"},
+	"volumes":             {"name"},
+	"volumeMounts":        {"mountPath"},
+	"env":                 {"name"},
+	"imagePullSecrets":    {"name"},
+	"ports":               {"containerPort", "port"},
+	"hostAliases":         {"ip"},
+}
+
+// strategicMerge merges patch into original following the strategic merge patch rules: maps merge recursively,
+// null deletes a key, lists with a merge key merge by it and "$patch: delete" / "$patch: replace" directives
+// delete list elements and replace maps
+func strategicMerge(original, patch map[string]interface{}) map[string]interface{} {
+	if original == nil || patch["$patch"] == "replace" {
+		original = make(map[string]interface{})
+	}
+	for k, pv := range patch {
+		if k == "$patch" {
+			continue
+		}
+		if pv == nil {
+			delete(original, k)
+			continue
+		}
+		switch pvt := pv.(type) {
+		case map[string]interface{}:
+			om, _ := original[k].(map[string]interface{})
+			original[k] = strategicMerge(om, pvt)
+		case []interface{}:
+			ol, _ := original[k].([]interface{})
+			original[k] = mergeList(k, ol, pvt)
+		default:
+			original[k] = pv
+		}
+	}
+	return original
+}
+
+func mergeList(field string, original, patch []interface{}) []interface{} {
+	key := listMergeKey(field, original, patch)
+	if key == "" {
+		return copyValue(patch).([]interface{})
+	}
+
+	merged := original
+	for _, pe := range patch {
+		pm, ok := pe.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		idx := -1
+		for i, oe := range merged {
+			if om, ok := oe.(map[string]interface{}); ok && om[key] == pm[key] {
+				idx = i
+				break
+			}
+		}
+		switch {
+		case pm["$patch"] == "delete":
+			if idx >= 0 {
+				merged = append(merged[:idx:idx], merged[idx+1:]...)
+			}
+		case idx >= 0:
+			merged[idx] = strategicMerge(merged[idx].(map[string]interface{}), pm)
+		default:
+			merged = append(merged, strategicMerge(nil, pm))
+		}
+	}
+	return merged
+}
+
+// listMergeKey returns the merge key of a list field, the first candidate present in its elements
+func listMergeKey(field string, lists ...[]interface{}) string {
+	for _, key := range mergeKeys[field] {
+		for _, l := range lists {
+			for _, e := range l {
+				if m, ok := e.(map[string]interface{}); ok {
+					if _, ok := m[key]; ok {
+						return key
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// applyJSONPatch applies the RFC 6902 operations in order
+func applyJSONPatch(doc map[string]interface{}, ops []jsonPatchOp) error {
+	var root interface{} = doc
+	for _, op := range ops {
+		var err error
+		switch op.Op {
+		case "add":
+			root, err = jsonPointerAdd(root, op.Path, copyValue(op.Value))
+		case "remove":
+			root, _, err = jsonPointerRemove(root, op.Path)
+		case "replace":
+			root, _, err = jsonPointerRemove(root, op.Path)
+			if err == nil {
+				root, err = jsonPointerAdd(root, op.Path, copyValue(op.Value))
+			}
+		case "move":
+			var value interface{}
+			root, value, err = jsonPointerRemove(root, op.From)
+			if err == nil {
+				root, err = jsonPointerAdd(root, op.Path, value)
+			}
+		case "copy":
+			var value interface{}
+			value, err = jsonPointerGet(root, op.From)
+			if err == nil {
+				root, err = jsonPointerAdd(root, op.Path, copyValue(value))
+			}
+		case "test":
+			var value interface{}
+			value, err = jsonPointerGet(root, op.Path)
+			if err == nil && !reflect.DeepEqual(normalizeNumbers(value), normalizeNumbers(op.Value)) {
+				err = fmt.Errorf("test failed, %s is %v", op.Path, value)
+			}
+		default:
+			err = fmt.Errorf("unsupported operation %q", op.Op)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", op.Op, op.Path, err)
+		}
+	}
+	return nil
+}
+
+// normalizeNumbers returns a copy of v with all numbers as float64, so that 1 and 1.0 compare equal the way
+// they do in JSON
+func normalizeNumbers(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vt))
+		for k, e := range vt {
+			m[k] = normalizeNumbers(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(vt))
+		for i, e := range vt {
+			l[i] = normalizeNumbers(e)
+		}
+		return l
+	case int:
+		return float64(vt)
+	case int64:
+		return float64(vt)
+	case uint64:
+		return float64(vt)
+	case float32:
+		return float64(vt)
+	}
+	return v
+}
+
+func splitJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON pointer %s must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func jsonPointerGet(root interface{}, pointer string) (interface{}, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	node := root
+	for _, t := range tokens {
+		node, err = jsonPointerChild(node, t)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+func jsonPointerChild(node interface{}, token string) (interface{}, error) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("missing key %s", token)
+		}
+		return child, nil
+	case []interface{}:
+		idx, err := strconv.Atoi(token)
+		if err != nil || idx < 0 || idx >= len(n) {
+			return nil, fmt.Errorf("invalid index %s", token)
+		}
+		return n[idx], nil
+	default:
+		return nil, fmt.Errorf("cannot descend into %s of a scalar", token)
+	}
+}
+
+// jsonPointerAdd adds value at pointer, returning the possibly reallocated root
+func jsonPointerAdd(root interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonPointerUpdate(root, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[token] = value
+			return p, nil
+		case []interface{}:
+			if token == "-" {
+				return append(p, value), nil
+			}
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx > len(p) {
+				return nil, fmt.Errorf("invalid index %s", token)
+			}
+			p = append(p, nil)
+			copy(p[idx+1:], p[idx:])
+			p[idx] = value
+			return p, nil
+		default:
+			return nil, fmt.Errorf("cannot add %s to a scalar", token)
+		}
+	})
+}
+
+// jsonPointerRemove removes the value at pointer, returning the possibly reallocated root and the removed value
+func jsonPointerRemove(root interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+	var removed interface{}
+	root, err = jsonPointerUpdate(root, tokens, func(parent interface{}, token string) (interface{}, error) {
+		removed, err = jsonPointerChild(parent, token)
+		if err != nil {
+			return nil, err
+		}
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			delete(p, token)
+			return p, nil
+		default:
+			l := parent.([]interface{})
+			idx, _ := strconv.Atoi(token)
+			return append(l[:idx:idx], l[idx+1:]...), nil
+		}
+	})
+	return root, removed, err
+}
+
+// jsonPointerUpdate descends to the parent of the last token and replaces it with the result of fn
+func jsonPointerUpdate(node interface{}, tokens []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+	child, err := jsonPointerChild(node, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	child, err = jsonPointerUpdate(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		n[tokens[0]] = child
+	case []interface{}:
+		idx, _ := strconv.Atoi(tokens[0])
+		n[idx] = child
+	}
+	return node, nil
+}
+
+var patches []*patch
+
+// applyPatches applies the --patch patches targeting the resource, in the order they were loaded
+func applyPatches(r *Resource) error {
+	for _, p := range patches {
+		if !p.matches(r) {
+			continue
+		}
+		p.applied = true
+		if p.merge != nil {
+			r.Contents = strategicMerge(r.Contents, p.merge)
+			continue
+		}
+		err := applyJSONPatch(r.Contents, p.jsonPatch)
+		if err != nil {
+			return fmt.Errorf("patch %s: %v", p.source, err)
+		}
+	}
+	return nil
+}
+
+// checkPatchesApplied fails on patches matching no resource, they usually target a renamed or removed resource
+func checkPatchesApplied() error {
+	var unmatched []string
+	for _, p := range patches {
+		if !p.applied {
+			unmatched = append(unmatched, fmt.Sprintf("%s (%s/%s)", p.source, p.target.Kind, p.target.Name))
+		}
+	}
+	if len(unmatched) > 0 {
+		return fmt.Errorf("patches matching no resource: %s", strings.Join(unmatched, ", "))
+	}
+	return nil
+}
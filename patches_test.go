@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyPatches(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "frontend.yaml"), []byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      containers:
+        - name: frontend
+          image: frontend:2.0
+        - name: sidecar
+          $patch: delete
+        - name: jaeger
+          image: jaeger
+      nodeSelector: null
+---
+target:
+  group: apps
+  kind: Deployment
+  name: frontend
+patch:
+  - op: replace
+    path: /spec/replicas
+    value: 3
+  - op: add
+    path: /spec/template/spec/containers/0/args/-
+    value: --verbose
+  - op: remove
+    path: /metadata/annotations/description
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a patch"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patches, err = loadPatches([]string{dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { patches = nil }()
+
+	r := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  annotations:
+    description: frontend
+spec:
+  replicas: 1
+  template:
+    spec:
+      nodeSelector:
+        disk: ssd
+      containers:
+        - name: frontend
+          image: frontend:1.0
+          args:
+            - --quiet
+        - name: sidecar
+          image: sidecar
+`)
+	other := decodeTestResource(t, `
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: frontend
+`)
+
+	for _, res := range []*Resource{r, other} {
+		err = applyPatches(res)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	err = checkPatchesApplied()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertContents(t, r, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  annotations: {}
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: frontend
+          image: frontend:2.0
+          args:
+            - --quiet
+            - --verbose
+        - name: jaeger
+          image: jaeger
+`)
+	assertContents(t, other, `
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: frontend
+`)
+}
+
+func TestCheckPatchesApplied(t *testing.T) {
+	patches = []*patch{{source: "missing.yaml#1", target: patchTarget{Kind: "Service", Name: "missing"}}}
+	defer func() { patches = nil }()
+
+	err := checkPatchesApplied()
+	if err == nil {
+		t.Errorf("expected an error for a patch matching no resource")
+	}
+}
+
+func TestApplyJSONPatchTest(t *testing.T) {
+	fixtures := []struct {
+		value    interface{}
+		expected bool
+	}{
+		{value: 3.0, expected: true},
+		{value: "3", expected: false},
+		{value: []interface{}{"3"}, expected: false},
+		{value: map[string]interface{}{"replicas": 3}, expected: false},
+	}
+
+	for _, fx := range fixtures {
+		doc := map[string]interface{}{"spec": map[string]interface{}{"replicas": 3}}
+		err := applyJSONPatch(doc, []jsonPatchOp{{Op: "test", Path: "/spec/replicas", Value: fx.value}})
+		got := err == nil
+		if got != fx.expected {
+			t.Errorf("test of %#v: expected %t, got %v", fx.value, fx.expected, err)
+		}
+	}
+}
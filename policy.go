@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+)
+
+// PolicyNamespace is the rego package of the policies evaluated against every resource, policies of the
+// package RecordPolicyNamespace are evaluated against the record as a whole
+const (
+	PolicyNamespace       = "main"
+	RecordPolicyNamespace = "record"
+)
+
+// conftestResult is the json output of conftest test for an input file
+type conftestResult struct {
+	Filename  string            `json:"filename"`
+	Namespace string            `json:"namespace"`
+	Failures  []conftestMessage `json:"failures"`
+	Warnings  []conftestMessage `json:"warnings"`
+}
+
+type conftestMessage struct {
+	Msg string `json:"msg"`
+}
+
+// evaluatePolicies runs the rego policies in dir with conftest against every resource and the record, failing
+// with the denials per manifest
+func evaluatePolicies(rs *ResourceSet, dir string) error {
+	tmp, err := ioutil.TempDir("", "ds-to-dhall-policy")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// inputs maps the input files to what they hold for the messages
+	inputs := make(map[string]string)
+	var files []string
+	for idx, r := range sortedResources(rs) {
+		file := filepath.Join(tmp, fmt.Sprintf("%d.json", idx))
+		err = writeJSON(file, r.Contents)
+		if err != nil {
+			return err
+		}
+		inputs[file] = fmt.Sprintf("%s (%s %s)", r.Source, r.Kind, r.Name)
+		files = append(files, file)
+	}
+
+	results, err := runConftest(dir, PolicyNamespace, files)
+	if err != nil {
+		return err
+	}
+
+	recordFile := filepath.Join(tmp, "record.json")
+	err = writeJSON(recordFile, buildRecord(rs))
+	if err != nil {
+		return err
+	}
+	inputs[recordFile] = "record"
+	recordResults, err := runConftest(dir, RecordPolicyNamespace, []string{recordFile})
+	if err != nil {
+		return err
+	}
+
+	violations := policyViolations(append(results, recordResults...), inputs)
+	if len(violations) > 0 {
+		return fmt.Errorf("policy violations:\n  %s", strings.Join(violations, "\n  "))
+	}
+	return nil
+}
+
+func writeJSON(file string, v interface{}) error {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, 0644)
+}
+
+// conftestBatchSize is the number of input files passed to one conftest run, keeping its command line well below
+// the argument size limit of the system for large records
+const conftestBatchSize = 500
+
+// runConftest evaluates the policies of the rego package namespace against the files, in batches of
+// conftestBatchSize files
+func runConftest(dir, namespace string, files []string) ([]conftestResult, error) {
+	var results []conftestResult
+	for len(files) > 0 {
+		batch := files
+		if len(batch) > conftestBatchSize {
+			batch = batch[:conftestBatchSize]
+		}
+		files = files[len(batch):]
+
+		batchResults, err := runConftestBatch(dir, namespace, batch)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batchResults...)
+	}
+	return results, nil
+}
+
+func runConftestBatch(dir, namespace string, files []string) ([]conftestResult, error) {
+	args := append([]string{"test", "--no-color", "--output", "json", "--policy", dir, "--namespace", namespace}, files...)
+	cmd := exec.Command("conftest", args...)
+	cmd.Env = subprocessEnv()
+	cmd.Stderr = os.Stderr
+	out, err := commandOutput(cmd)
+	if _, failed := err.(*exec.ExitError); err != nil && !(failed && len(out) > 0) {
+		// conftest exits with an error on failures, but still reports them
+		return nil, fmt.Errorf("conftest: %v", err)
+	}
+
+	var results []conftestResult
+	err = json.Unmarshal(out, &results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode conftest output: %v", err)
+	}
+	return results, nil
+}
+
+// policyViolations lists the failures in results by what the input holds and logs the warnings
+func policyViolations(results []conftestResult, inputs map[string]string) []string {
+	var violations []string
+	for _, result := range results {
+		input, ok := inputs[result.Filename]
+		if !ok {
+			input = result.Filename
+		}
+		for _, w := range result.Warnings {
+			log15.Warn("policy warning", "input", input, "message", w.Msg)
+		}
+		for _, f := range result.Failures {
+			violations = append(violations, fmt.Sprintf("%s: %s", input, f.Msg))
+		}
+	}
+	return violations
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicyViolations(t *testing.T) {
+	output := `[
+  {"filename": "/tmp/p/0.json", "namespace": "main", "successes": 2,
+   "warnings": [{"msg": "no resource limits"}],
+   "failures": [{"msg": "containers must not run as root"}]},
+  {"filename": "/tmp/p/1.json", "namespace": "main", "successes": 3},
+  {"filename": "/tmp/p/record.json", "namespace": "record", "successes": 0,
+   "failures": [{"msg": "component Frontend has no Service"}]}
+]`
+	var results []conftestResult
+	err := json.Unmarshal([]byte(output), &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := map[string]string{
+		"/tmp/p/0.json":      "base/frontend/deploy.yaml (Deployment frontend)",
+		"/tmp/p/1.json":      "base/frontend/svc.yaml (Service frontend)",
+		"/tmp/p/record.json": "record",
+	}
+	expected := []string{
+		"base/frontend/deploy.yaml (Deployment frontend): containers must not run as root",
+		"record: component Frontend has no Service",
+	}
+	if got := policyViolations(results, inputs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestRunConftestBatches(t *testing.T) {
+	// the fake conftest reports every input file and counts its runs
+	dir := t.TempDir()
+	script := `#!/bin/sh
+echo run >> "$0.runs"
+printf '['
+sep=''
+for arg in "$@"; do
+  case "$arg" in *.json) printf '%s{"filename": "%s"}' "$sep" "$arg"; sep=',';; esac
+done
+printf ']'
+`
+	err := ioutil.WriteFile(filepath.Join(dir, "conftest"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	var files []string
+	for idx := 0; idx < 2*conftestBatchSize+1; idx++ {
+		files = append(files, fmt.Sprintf("%d.json", idx))
+	}
+	results, err := runConftest(dir, PolicyNamespace, files)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != len(files) || results[len(files)-1].Filename != files[len(files)-1] {
+		t.Errorf("expected a result for each of the %d files, got %d", len(files), len(results))
+	}
+
+	runs, err := ioutil.ReadFile(filepath.Join(dir, "conftest.runs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(runs), "run"); got != 3 {
+		t.Errorf("expected 3 conftest runs, got %d", got)
+	}
+}
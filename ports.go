@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"gopkg.in/yaml.v3"
+)
+
+// portEntry is a port declared by a container or a Service in the --ports report
+type portEntry struct {
+	Component string `yaml:"component"`
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+	Container string `yaml:"container,omitempty"`
+	PortName  string `yaml:"portName,omitempty"`
+	Port      int    `yaml:"port"`
+	Protocol  string `yaml:"protocol"`
+	// TargetPort and NodePort are set for Service ports
+	TargetPort string `yaml:"targetPort,omitempty"`
+	NodePort   int    `yaml:"nodePort,omitempty"`
+	HostPort   int    `yaml:"hostPort,omitempty"`
+}
+
+type portsReport struct {
+	Ports     []portEntry `yaml:"ports"`
+	Conflicts []string    `yaml:"conflicts,omitempty"`
+}
+
+// containerPorts returns the ports the containers of a workload declare
+func containerPorts(r *Resource) []portEntry {
+	spec, ok := podSpecPath(r.Kind)
+	if !ok {
+		return nil
+	}
+
+	var ports []portEntry
+	for _, section := range []string{"containers", "initContainers"} {
+		for _, c := range lookupPath(r.Contents, append(spec, pathElem{key: section}, pathElem{wildcard: true})) {
+			container, _ := c.(map[string]interface{})
+			containerName, _ := container["name"].(string)
+			declared, _ := container["ports"].([]interface{})
+			for _, p := range declared {
+				port, _ := p.(map[string]interface{})
+				entry := portEntry{Kind: r.Kind, Name: r.Name, Container: containerName, Protocol: portProtocol(port)}
+				entry.PortName, _ = port["name"].(string)
+				entry.Port, _ = port["containerPort"].(int)
+				entry.HostPort, _ = port["hostPort"].(int)
+				ports = append(ports, entry)
+			}
+		}
+	}
+	return ports
+}
+
+func portProtocol(port map[string]interface{}) string {
+	if protocol, ok := port["protocol"].(string); ok {
+		return protocol
+	}
+	return "TCP"
+}
+
+// servicePorts returns the ports of a Service, the target port defaults to the port
+func servicePorts(r *Resource) []portEntry {
+	spec, _ := r.Contents["spec"].(map[string]interface{})
+	declared, _ := spec["ports"].([]interface{})
+
+	var ports []portEntry
+	for _, p := range declared {
+		port, _ := p.(map[string]interface{})
+		entry := portEntry{Kind: r.Kind, Name: r.Name, Protocol: portProtocol(port)}
+		entry.PortName, _ = port["name"].(string)
+		entry.Port, _ = port["port"].(int)
+		entry.NodePort, _ = port["nodePort"].(int)
+		switch target := port["targetPort"].(type) {
+		case int:
+			entry.TargetPort = strconv.Itoa(target)
+		case string:
+			entry.TargetPort = target
+		default:
+			entry.TargetPort = strconv.Itoa(entry.Port)
+		}
+		ports = append(ports, entry)
+	}
+	return ports
+}
+
+// buildPortsReport lists the container and Service ports and the conflicts between them: NodePorts and host ports
+// used more than once and Service target ports matching no port of the workloads they select
+func buildPortsReport(rs *ResourceSet) *portsReport {
+	report := &portsReport{Ports: []portEntry{}}
+	workloadPorts := make(map[string][]portEntry)
+	nodePorts := make(map[int][]string)
+	hostPorts := make(map[string][]string)
+
+	for _, r := range sortedResources(rs) {
+		namespace := ""
+		if !clusterScopedKinds[r.Kind] {
+			namespace = resourceNamespace(r)
+		}
+		ports := containerPorts(r)
+		if r.Kind == "Service" {
+			ports = servicePorts(r)
+		}
+		for idx := range ports {
+			ports[idx].Component = componentKey(r.Component)
+			ports[idx].Namespace = namespace
+		}
+		report.Ports = append(report.Ports, ports...)
+
+		resource := fmt.Sprintf("%s %s", r.Kind, qualifiedName(namespace, r.Name))
+		if r.Kind != "Service" {
+			workloadPorts[resource] = ports
+		}
+		for _, p := range ports {
+			if p.NodePort != 0 {
+				nodePorts[p.NodePort] = append(nodePorts[p.NodePort], resource)
+			}
+			if p.HostPort != 0 {
+				key := fmt.Sprintf("%d/%s", p.HostPort, p.Protocol)
+				hostPorts[key] = append(hostPorts[key], fmt.Sprintf("%s container %s", resource, p.Container))
+			}
+		}
+	}
+
+	for _, port := range sortedInts(nodePorts) {
+		if users := nodePorts[port]; len(users) > 1 {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("nodePort %d is used by %s", port, joinUsers(users)))
+		}
+	}
+	var hostPortKeys []string
+	for key := range hostPorts {
+		hostPortKeys = append(hostPortKeys, key)
+	}
+	sort.Strings(hostPortKeys)
+	for _, key := range hostPortKeys {
+		// DaemonSets and multiple replicas can't share a host port on a node either, but that is up to scheduling
+		if users := hostPorts[key]; len(users) > 1 {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("hostPort %s is used by %s", key, joinUsers(users)))
+		}
+	}
+
+	for _, r := range sortedResources(rs) {
+		if r.Kind != "Service" {
+			continue
+		}
+		service := fmt.Sprintf("Service %s", qualifiedName(resourceNamespace(r), r.Name))
+		for _, workload := range selectedWorkloads(rs, r) {
+			name := fmt.Sprintf("%s %s", workload.Kind, qualifiedName(workload.Namespace, workload.Name))
+			declared := workloadPorts[name]
+			for _, p := range servicePorts(r) {
+				if !targetsPort(p, declared) {
+					report.Conflicts = append(report.Conflicts,
+						fmt.Sprintf("targetPort %s of %s port %d matches no containerPort of %s", p.TargetPort, service, p.Port, name))
+				}
+			}
+		}
+	}
+	return report
+}
+
+// targetsPort reports whether the target port of a Service port is one of the declared container ports. Numeric
+// target ports of workloads that declare no ports can't be checked and are assumed to match.
+func targetsPort(servicePort portEntry, declared []portEntry) bool {
+	number, err := strconv.Atoi(servicePort.TargetPort)
+	if err == nil && len(declared) == 0 {
+		return true
+	}
+	for _, p := range declared {
+		if p.Protocol != servicePort.Protocol {
+			continue
+		}
+		if (err == nil && p.Port == number) || (err != nil && p.PortName == servicePort.TargetPort) {
+			return true
+		}
+	}
+	return false
+}
+
+func qualifiedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+func sortedInts(m map[int][]string) []int {
+	var keys []int
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func joinUsers(users []string) string {
+	return strings.Join(users[:len(users)-1], ", ") + " and " + users[len(users)-1]
+}
+
+func writePortsReport(rs *ResourceSet, file string) error {
+	report := buildPortsReport(rs)
+	for _, conflict := range report.Conflicts {
+		log15.Warn("port conflict", "conflict", conflict)
+	}
+	contents, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, 0644)
+}
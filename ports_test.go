@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPortsReport(t *testing.T) {
+	deployment := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    metadata:
+      labels:
+        app: frontend
+    spec:
+      containers:
+        - name: frontend
+          ports:
+            - name: http
+              containerPort: 3080
+`)
+	deployment.Component = "frontend"
+	service := decodeTestResource(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+spec:
+  type: NodePort
+  selector:
+    app: frontend
+  ports:
+    - name: http
+      port: 80
+      targetPort: http
+      nodePort: 30080
+    - name: debug
+      port: 6060
+`)
+	service.Component = "frontend"
+	other := decodeTestResource(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: grafana
+spec:
+  type: NodePort
+  ports:
+    - port: 30070
+      nodePort: 30080
+`)
+	other.Component = "grafana"
+
+	report := buildPortsReport(&ResourceSet{Components: map[string][]*Resource{
+		"frontend": {deployment, service},
+		"grafana":  {other},
+	}})
+
+	if len(report.Ports) != 4 {
+		t.Fatalf("expected 4 ports, got %+v", report.Ports)
+	}
+	expected := []string{
+		"nodePort 30080 is used by Service frontend and Service grafana",
+		"targetPort 6060 of Service frontend port 6060 matches no containerPort of Deployment frontend",
+	}
+	if !reflect.DeepEqual(report.Conflicts, expected) {
+		t.Errorf("expected conflicts %q, got %q", expected, report.Conflicts)
+	}
+}
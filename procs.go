@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// procLimiter bounds the subprocesses running at once and holds new ones back while the available memory is below
+// minFree. Subprocesses wait for their turn rather than fail, so queued components are converted as others finish.
+type procLimiter struct {
+	slots   chan struct{}
+	minFree uint64
+
+	mu      sync.Mutex
+	running int
+}
+
+// procs limits the subprocesses of the conversion, nil when they are not limited
+var procs *procLimiter
+
+// memoryPollInterval is how often the available memory is checked while a subprocess is held back
+var memoryPollInterval = 250 * time.Millisecond
+
+func newProcLimiter(maxProcs int, minFree uint64) *procLimiter {
+	return &procLimiter{slots: make(chan struct{}, maxProcs), minFree: minFree}
+}
+
+// acquire waits for a free slot and, with a memory guard, for enough available memory. A subprocess is started
+// regardless when no other is running, as waiting wouldn't free any memory then.
+func (l *procLimiter) acquire() {
+	if l == nil {
+		return
+	}
+	l.slots <- struct{}{}
+	for waiting := false; !l.start(); waiting = true {
+		if !waiting {
+			log15.Debug("waiting for available memory", "minFree", l.minFree)
+		}
+		time.Sleep(memoryPollInterval)
+	}
+}
+
+// start counts a subprocess as running, unless the memory guard holds it back
+func (l *procLimiter) start() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.minFree > 0 && l.running > 0 {
+		if available, ok := availableMemory(); ok && available < l.minFree {
+			return false
+		}
+	}
+	l.running++
+	return true
+}
+
+func (l *procLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.running--
+	l.mu.Unlock()
+	<-l.slots
+}
+
+// parseMemory parses a --min-free-memory quantity like 512Mi into bytes
+func parseMemory(s string) (uint64, error) {
+	q, err := parseQuantity(s)
+	if err != nil || q.Sign() < 0 {
+		return 0, fmt.Errorf("invalid memory quantity %q", s)
+	}
+	return new(big.Int).Quo(q.Num(), q.Denom()).Uint64(), nil
+}
+
+var (
+	meminfoFile    = "/proc/meminfo"
+	selfCgroupFile = "/proc/self/cgroup"
+	cgroupRoot     = "/sys/fs/cgroup"
+)
+
+// availableMemory returns the memory available to new processes in bytes: the MemAvailable of the system, or what
+// is left below the memory limits of the cgroup v2 the tool runs in and of its ancestors when that is less, as on CI
+// runners. It isn't known on systems without /proc/meminfo.
+func availableMemory() (uint64, bool) {
+	f, err := os.Open(meminfoFile)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	var available uint64
+	found := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "MemAvailable:" && fields[2] == "kB" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			available, found = kb*1024, true
+			break
+		}
+	}
+	if !found {
+		return 0, false
+	}
+
+	dir, ok := cgroupDir()
+	if !ok {
+		return available, true
+	}
+	// a limit applies to the cgroups below it, the leaf of a runner often has none of its own
+	for {
+		limit, err := readCgroupValue(dir, "memory.max")
+		if err == nil {
+			current, err := readCgroupValue(dir, "memory.current")
+			if err == nil && current >= limit {
+				return 0, true
+			}
+			if err == nil && limit-current < available {
+				available = limit - current
+			}
+		}
+		if dir == cgroupRoot || !strings.HasPrefix(dir, cgroupRoot) {
+			return available, true
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// cgroupDir returns the directory of the cgroup v2 the tool runs in, read from /proc/self/cgroup
+func cgroupDir() (string, bool) {
+	contents, err := ioutil.ReadFile(selfCgroupFile)
+	if err != nil {
+		return "", false
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		// cgroup v2 has the single hierarchy 0 without controllers
+		if strings.HasPrefix(line, "0::") {
+			return filepath.Join(cgroupRoot, strings.TrimPrefix(line, "0::")), true
+		}
+	}
+	return "", false
+}
+
+// readCgroupValue reads a numeric cgroup v2 memory file, failing on "max"
+func readCgroupValue(dir, name string) (uint64, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(contents)), 10, 64)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcLimiterBoundsSubprocesses(t *testing.T) {
+	l := newProcLimiter(2, 0)
+	var mu sync.Mutex
+	running, most := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.acquire()
+			defer l.release()
+			mu.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if most != 2 {
+		t.Errorf("expected at most 2 subprocesses at once, got %d", most)
+	}
+}
+
+// fakeMemory fakes the meminfo of the system and the cgroup files, by path below the cgroup root. The tool runs in
+// the runner/job cgroup.
+func fakeMemory(t *testing.T, meminfo string, cgroup map[string]string) {
+	dir := t.TempDir()
+	previousMeminfo, previousSelf, previousRoot, previousInterval := meminfoFile, selfCgroupFile, cgroupRoot, memoryPollInterval
+	t.Cleanup(func() {
+		meminfoFile, selfCgroupFile, cgroupRoot, memoryPollInterval = previousMeminfo, previousSelf, previousRoot, previousInterval
+	})
+	meminfoFile, selfCgroupFile, cgroupRoot = filepath.Join(dir, "meminfo"), filepath.Join(dir, "cgroup"), filepath.Join(dir, "sys")
+	memoryPollInterval = time.Millisecond
+
+	err := ioutil.WriteFile(meminfoFile, []byte(meminfo), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(selfCgroupFile, []byte("0::/runner/job\n"), 0644)
+	}
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(cgroupRoot, "runner", "job"), 0755)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range cgroup {
+		err = ioutil.WriteFile(filepath.Join(cgroupRoot, filepath.FromSlash(name)), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProcLimiterWaitsForMemory(t *testing.T) {
+	fakeMemory(t, "MemTotal: 2048 kB\nMemAvailable: 1024 kB\n", nil)
+	l := newProcLimiter(4, 1<<20+1)
+
+	// the first subprocess starts although memory is low, nothing would free it otherwise
+	l.acquire()
+	started := make(chan struct{})
+	go func() {
+		l.acquire()
+		close(started)
+		l.release()
+	}()
+
+	select {
+	case <-started:
+		t.Fatal("expected the second subprocess to wait for memory")
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.release()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("expected the second subprocess to start once the first finished")
+	}
+}
+
+func TestAvailableMemory(t *testing.T) {
+	fakeMemory(t, "MemTotal: 8192 kB\nMemFree: 1024 kB\nMemAvailable: 4096 kB\n", nil)
+	if available, ok := availableMemory(); !ok || available != 4096*1024 {
+		t.Errorf("expected MemAvailable, got %d %v", available, ok)
+	}
+
+	fakeMemory(t, "MemAvailable: 4096 kB\n", map[string]string{"runner/job/memory.max": "3145728\n", "runner/job/memory.current": "1048576\n"})
+	if available, ok := availableMemory(); !ok || available != 2<<20 {
+		t.Errorf("expected what is left of the cgroup limit, got %d %v", available, ok)
+	}
+
+	fakeMemory(t, "MemAvailable: 4096 kB\n", map[string]string{"runner/job/memory.max": "max\n", "runner/job/memory.current": "1048576\n"})
+	if available, ok := availableMemory(); !ok || available != 4096*1024 {
+		t.Errorf("expected MemAvailable without a cgroup limit, got %d %v", available, ok)
+	}
+
+	fakeMemory(t, "MemAvailable: 4096 kB\n", map[string]string{
+		"runner/memory.max": "2097152\n", "runner/memory.current": "1048576\n",
+		"runner/job/memory.max": "max\n", "runner/job/memory.current": "524288\n",
+	})
+	if available, ok := availableMemory(); !ok || available != 1<<20 {
+		t.Errorf("expected what is left of the limit of the parent cgroup, got %d %v", available, ok)
+	}
+
+	fakeMemory(t, "MemTotal: 8192 kB\n", nil)
+	if _, ok := availableMemory(); ok {
+		t.Error("expected the available memory to be unknown")
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	for s, expected := range map[string]uint64{"1Gi": 1 << 30, "512Mi": 512 << 20, "1G": 1000 * 1000 * 1000, "1024": 1024} {
+		got, err := parseMemory(s)
+		if err != nil || got != expected {
+			t.Errorf("%s: expected %d, got %d %v", s, expected, got, err)
+		}
+	}
+	if _, err := parseMemory("lots"); err == nil {
+		t.Error("expected an error for an invalid quantity")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// profiles are the profiles and traces being recorded, finished by stopProfiling
+var profiles []func() error
+
+// startProfiling starts the cpu profile and the execution trace asked for, the memory profile is written when
+// profiling stops
+func startProfiling(cpuFile, memFile, traceFile string) error {
+	if cpuFile != "" {
+		f, err := os.Create(cpuFile)
+		if err != nil {
+			return err
+		}
+		err = pprof.StartCPUProfile(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		profiles = append(profiles, func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		})
+	}
+
+	if traceFile != "" {
+		f, err := os.Create(traceFile)
+		if err != nil {
+			return err
+		}
+		err = trace.Start(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		profiles = append(profiles, func() error {
+			trace.Stop()
+			return f.Close()
+		})
+	}
+
+	if memFile != "" {
+		profiles = append(profiles, func() error {
+			f, err := os.Create(memFile)
+			if err != nil {
+				return err
+			}
+			// up to date statistics of the allocations
+			runtime.GC()
+			err = pprof.WriteHeapProfile(f)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		})
+	}
+	return nil
+}
+
+// stopProfiling finishes the profiles, also when the run fails so that failing runs can be profiled too
+func stopProfiling() error {
+	var firstErr error
+	for _, stop := range profiles {
+		if err := stop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	profiles = nil
+	return firstErr
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfiling(t *testing.T) {
+	dir := t.TempDir()
+	cpu := filepath.Join(dir, "cpu.pprof")
+	mem := filepath.Join(dir, "mem.pprof")
+	trace := filepath.Join(dir, "trace.out")
+
+	err := startProfiling(cpu, mem, trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stopProfiling()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{cpu, mem, trace} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 {
+			t.Errorf("expected %s to be written", file)
+		}
+	}
+	if err := stopProfiling(); err != nil {
+		t.Errorf("expected stopping again to do nothing, got %v", err)
+	}
+}
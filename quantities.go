@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+// podSpecQuantityMaps are the maps of resource quantities of a pod spec
+var podSpecQuantityMaps = []string{
+	".containers[*].resources.limits",
+	".containers[*].resources.requests",
+	".initContainers[*].resources.limits",
+	".initContainers[*].resources.requests",
+	".overhead",
+}
+
+// podSpecQuantities are the single quantity fields of a pod spec
+var podSpecQuantities = []string{
+	".volumes[*].emptyDir.sizeLimit",
+}
+
+// quantityMaps are the maps of resource quantities of kinds, in addition to the ones of their pod spec
+var quantityMaps = map[string][]string{
+	"PersistentVolumeClaim": {".spec.resources.limits", ".spec.resources.requests"},
+	"PersistentVolume":      {".spec.capacity"},
+	"StatefulSet":           {".spec.volumeClaimTemplates[*].spec.resources.limits", ".spec.volumeClaimTemplates[*].spec.resources.requests"},
+	"ResourceQuota":         {".spec.hard"},
+	"LimitRange": {
+		".spec.limits[*].max",
+		".spec.limits[*].min",
+		".spec.limits[*].default",
+		".spec.limits[*].defaultRequest",
+		".spec.limits[*].maxLimitRequestRatio",
+	},
+}
+
+// quantityString renders a yaml number as a Kubernetes quantity: integers as is and fractions in milli units when
+// they have no finer precision, like the API server does
+func quantityString(v interface{}) (string, bool) {
+	switch n := v.(type) {
+	case int:
+		return strconv.Itoa(n), true
+	case float64:
+		if n == math.Trunc(n) {
+			return strconv.FormatFloat(n, 'f', -1, 64), true
+		}
+		if milli := n * 1000; milli == math.Trunc(milli) {
+			return strconv.FormatFloat(milli, 'f', -1, 64) + "m", true
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// normalizeQuantities turns numbers in quantity fields into strings, the dhall-kubernetes quantity fields are Text
+func normalizeQuantities(r *Resource) error {
+	maps := quantityMaps[r.Kind]
+	var fields []string
+	if spec, ok := podSpecPath(r.Kind); ok {
+		for _, field := range podSpecQuantityMaps {
+			maps = append(maps[:len(maps):len(maps)], spec.String()+field)
+		}
+		for _, field := range podSpecQuantities {
+			fields = append(fields, spec.String()+field)
+		}
+	}
+
+	toString := func(v interface{}) interface{} {
+		if s, ok := quantityString(v); ok {
+			return s
+		}
+		return v
+	}
+
+	for _, field := range maps {
+		path, err := parseFieldPath(field)
+		if err != nil {
+			return err
+		}
+		updatePath(r.Contents, path, func(v interface{}) interface{} {
+			quantities, ok := v.(map[string]interface{})
+			if !ok {
+				return v
+			}
+			for name, quantity := range quantities {
+				quantities[name] = toString(quantity)
+			}
+			return quantities
+		})
+	}
+
+	for _, field := range fields {
+		path, err := parseFieldPath(field)
+		if err != nil {
+			return err
+		}
+		updatePath(r.Contents, path, toString)
+	}
+	return nil
+}
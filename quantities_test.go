@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestNormalizeQuantities(t *testing.T) {
+	r := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: pgsql
+spec:
+  template:
+    spec:
+      containers:
+        - name: pgsql
+          resources:
+            limits:
+              cpu: 4
+              memory: 2Gi
+            requests:
+              cpu: 1.5
+              memory: 512Mi
+              ephemeral-storage: 0.0001
+      volumes:
+        - name: cache
+          emptyDir:
+            sizeLimit: 1000
+  volumeClaimTemplates:
+    - spec:
+        resources:
+          requests:
+            storage: 200Gi
+`)
+
+	err := normalizeQuantities(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertContents(t, r, `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: pgsql
+spec:
+  template:
+    spec:
+      containers:
+        - name: pgsql
+          resources:
+            limits:
+              cpu: "4"
+              memory: 2Gi
+            requests:
+              cpu: 1500m
+              memory: 512Mi
+              ephemeral-storage: "0.0001"
+      volumes:
+        - name: cache
+          emptyDir:
+            sizeLimit: "1000"
+  volumeClaimTemplates:
+    - spec:
+        resources:
+          requests:
+            storage: 200Gi
+`)
+}
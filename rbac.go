@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/inconshreveable/log15"
+	"gopkg.in/yaml.v3"
+)
+
+// rbacGrant is a role granted to a subject by a binding, as listed in the --rbac-summary
+type rbacGrant struct {
+	// Subject is the kind and name of the subject, eg ServiceAccount prod/frontend or Group system:masters
+	Subject string `yaml:"subject"`
+	Binding string `yaml:"binding"`
+	Role    string `yaml:"role"`
+	// Namespace the grant applies to, empty for ClusterRoleBindings which apply cluster wide
+	Namespace string     `yaml:"namespace,omitempty"`
+	Rules     []rbacRule `yaml:"rules,omitempty"`
+}
+
+type rbacRule struct {
+	Verbs           []string `yaml:"verbs,flow"`
+	APIGroups       []string `yaml:"apiGroups,omitempty,flow"`
+	Resources       []string `yaml:"resources,omitempty,flow"`
+	ResourceNames   []string `yaml:"resourceNames,omitempty,flow"`
+	NonResourceURLs []string `yaml:"nonResourceURLs,omitempty,flow"`
+}
+
+// buildRBACSummary lists by component the grants of the RoleBindings and ClusterRoleBindings with the rules
+// of the roles they refer to
+func buildRBACSummary(rs *ResourceSet) map[string][]rbacGrant {
+	roles := make(map[string]*Resource)
+	for _, r := range sortedResources(rs) {
+		switch r.Kind {
+		case "Role":
+			roles["Role "+resourceNamespace(r)+"/"+r.Name] = r
+		case "ClusterRole":
+			roles["ClusterRole "+r.Name] = r
+		}
+	}
+
+	summary := make(map[string][]rbacGrant)
+	for _, r := range sortedResources(rs) {
+		if r.Kind != "RoleBinding" && r.Kind != "ClusterRoleBinding" {
+			continue
+		}
+
+		namespace := ""
+		binding := fmt.Sprintf("%s %s", r.Kind, r.Name)
+		if r.Kind == "RoleBinding" {
+			namespace = resourceNamespace(r)
+			binding = fmt.Sprintf("%s %s/%s", r.Kind, namespace, r.Name)
+		}
+
+		roleRef, _ := r.Contents["roleRef"].(map[string]interface{})
+		roleKind, _ := roleRef["kind"].(string)
+		roleName, _ := roleRef["name"].(string)
+		role := roleKind + " " + roleName
+		if roleKind == "Role" {
+			role = fmt.Sprintf("Role %s/%s", namespace, roleName)
+		}
+
+		var rules []rbacRule
+		if roleResource, ok := roles[role]; ok {
+			rules = rbacRules(roleResource)
+		} else {
+			log15.Warn("role of binding not found", "binding", binding, "role", role, "manifest", r.Source)
+		}
+
+		subjects, _ := r.Contents["subjects"].([]interface{})
+		for _, s := range subjects {
+			subject, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			summary[componentKey(r.Component)] = append(summary[componentKey(r.Component)], rbacGrant{
+				Subject:   subjectName(subject, namespace),
+				Binding:   binding,
+				Role:      role,
+				Namespace: namespace,
+				Rules:     rules,
+			})
+		}
+	}
+
+	for _, grants := range summary {
+		sort.SliceStable(grants, func(i, j int) bool { return grants[i].Subject < grants[j].Subject })
+	}
+	return summary
+}
+
+// subjectName renders a binding subject, service accounts default to the namespace of a RoleBinding
+func subjectName(subject map[string]interface{}, bindingNamespace string) string {
+	kind, _ := subject["kind"].(string)
+	name, _ := subject["name"].(string)
+	if kind != "ServiceAccount" {
+		return kind + " " + name
+	}
+	namespace, _ := subject["namespace"].(string)
+	if namespace == "" {
+		namespace = bindingNamespace
+	}
+	return fmt.Sprintf("%s %s/%s", kind, namespace, name)
+}
+
+func rbacRules(role *Resource) []rbacRule {
+	var rules []rbacRule
+	items, _ := role.Contents["rules"].([]interface{})
+	for _, item := range items {
+		rule, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rules = append(rules, rbacRule{
+			Verbs:           stringList(rule["verbs"]),
+			APIGroups:       stringList(rule["apiGroups"]),
+			Resources:       stringList(rule["resources"]),
+			ResourceNames:   stringList(rule["resourceNames"]),
+			NonResourceURLs: stringList(rule["nonResourceURLs"]),
+		})
+	}
+	return rules
+}
+
+// stringList returns the strings of a yaml list, skipping other values
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	var values []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+func writeRBACSummary(rs *ResourceSet, file string) error {
+	contents, err := yaml.Marshal(buildRBACSummary(rs))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, 0644)
+}
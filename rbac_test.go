@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBuildRBACSummary(t *testing.T) {
+	var resources []*Resource
+	for _, manifest := range []string{`
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata: {name: frontend, namespace: prod}
+rules:
+  - apiGroups: [""]
+    resources: [configmaps]
+    verbs: [get, list]
+`, `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata: {name: frontend, namespace: prod}
+roleRef: {apiGroup: rbac.authorization.k8s.io, kind: Role, name: frontend}
+subjects:
+  - {kind: ServiceAccount, name: frontend}
+`, `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata: {name: frontend-view}
+roleRef: {apiGroup: rbac.authorization.k8s.io, kind: ClusterRole, name: view}
+subjects:
+  - {kind: Group, name: developers}
+`} {
+		var contents map[string]interface{}
+		err := yaml.Unmarshal([]byte(manifest), &contents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata := contents["metadata"].(map[string]interface{})
+		resources = append(resources, &Resource{Component: "frontend", Kind: contents["kind"].(string),
+			Name: metadata["name"].(string), Contents: contents})
+	}
+
+	summary, err := yaml.Marshal(buildRBACSummary(&ResourceSet{Components: map[string][]*Resource{"frontend": resources}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Frontend:
+    - subject: Group developers
+      binding: ClusterRoleBinding frontend-view
+      role: ClusterRole view
+    - subject: ServiceAccount prod/frontend
+      binding: RoleBinding prod/frontend
+      role: Role prod/frontend
+      namespace: prod
+      rules:
+        - verbs: [get, list]
+          apiGroups: [""]
+          resources: [configmaps]
+`
+	if string(summary) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, summary)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestRecordLiteral(t *testing.T) {
+	record := map[string]interface{}{
+		"Gitserver": map[string]interface{}{
+			"StatefulSet": map[string]interface{}{"gitserver": "Gitserver-StatefulSet-gitserver"},
+			"Service":     map[string]interface{}{"gitserver": "Gitserver-Service-gitserver"},
+		},
+		"Frontend": map[string]interface{}{
+			"Service": map[string]interface{}{
+				"sourcegraph-frontend-internal": "Frontend-Service-sourcegraph-frontend-internal",
+				"sourcegraph-frontend":          "Frontend-Service-sourcegraph-frontend",
+			},
+		},
+	}
+
+	expected := "{ Frontend = { Service = { sourcegraph-frontend = Frontend-Service-sourcegraph-frontend, " +
+		"sourcegraph-frontend-internal = Frontend-Service-sourcegraph-frontend-internal } }, " +
+		"Gitserver = { Service = { gitserver = Gitserver-Service-gitserver }, " +
+		"StatefulSet = { gitserver = Gitserver-StatefulSet-gitserver } } }"
+
+	got := recordLiteral(record)
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
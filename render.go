@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// renderedResource is a resource found in a rendered record, at the path of record keys leading to it
+type renderedResource struct {
+	path     []string
+	contents map[string]interface{}
+}
+
+func runRender(args []string) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	outDir := fs.StringP("out-dir", "o", "", "(required) directory the Kubernetes YAML files are written to")
+	addAuthFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of ds-to-dhall render: --out-dir <dir> <record file>\n")
+		fmt.Fprintln(os.Stderr, "Renders a generated record, or any Dhall expression of that shape, to one YAML file per resource in <dir>,")
+		fmt.Fprintln(os.Stderr, "a directory per record key, eg Frontend/Deployment/sourcegraph-frontend.yaml.")
+		fmt.Fprintln(os.Stderr, "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *outDir == "" || fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	file := fs.Arg(0)
+
+	log15.Info("rendering record", "file", file, "outDir", *outDir)
+	record, err := renderRecord(file)
+	if err != nil {
+		logFatal("failed to render record", "error", err, "file", file)
+	}
+	resources, err := renderedResources(record)
+	if err != nil {
+		logFatal("failed to collect resources", "error", err, "file", file)
+	}
+	for _, r := range resources {
+		err = writeRenderedResource(*outDir, r)
+		if err != nil {
+			logFatal("failed to write resource", "error", err, "path", strings.Join(r.path, "."))
+		}
+	}
+
+	log15.Info("done", "resources", len(resources))
+}
+
+// renderRecord evaluates the Dhall expression in file with dhall-to-yaml, secrets imported from the environment
+// that aren't set are rendered as placeholders
+func renderRecord(file string) (map[string]interface{}, error) {
+	cmd := exec.Command("dhall-to-yaml", "--file", file)
+	cmd.Env = secretEnvPlaceholders(subprocessEnv())
+	cmd.Stderr = os.Stderr
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var record map[string]interface{}
+	err = yaml.Unmarshal(out, &record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// renderedResources collects the resources in a record, the maps holding apiVersion and kind, sorted by path
+func renderedResources(record map[string]interface{}) ([]renderedResource, error) {
+	var resources []renderedResource
+	var collect func(path []string, v interface{}) error
+	collect = func(path []string, v interface{}) error {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected a record or a resource at %s, got %T", strings.Join(path, "."), v)
+		}
+		if _, ok := m["apiVersion"].(string); ok {
+			if _, ok := m["kind"].(string); ok {
+				resources = append(resources, renderedResource{path: path, contents: m})
+				return nil
+			}
+		}
+
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			err := collect(append(path[:len(path):len(path)], k), m[k])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := collect(nil, record)
+	if err != nil {
+		return nil, err
+	}
+	if len(resources) > 0 && len(resources[0].path) == 0 {
+		return nil, fmt.Errorf("expected a record of resources, got a single %s", resources[0].contents["kind"])
+	}
+	return resources, nil
+}
+
+// writeRenderedResource writes a resource to a file named after the last key of its path, in the directories
+// named after the other keys
+func writeRenderedResource(dir string, r renderedResource) error {
+	for _, k := range r.path {
+		if k == "" || k == "." || k == ".." || strings.ContainsAny(k, `/\`) {
+			return fmt.Errorf("record key %q can't be used as a file name", k)
+		}
+	}
+	file := filepath.Join(append([]string{dir}, r.path...)...) + ".yaml"
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	contents, err := yaml.Marshal(r.contents)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, 0644)
+}
+
+// encodeDocuments encodes the resources as a multi document yaml stream
+func encodeDocuments(resources []renderedResource) ([]byte, error) {
+	var b bytes.Buffer
+	e := yaml.NewEncoder(&b)
+	for _, r := range resources {
+		err := e.Encode(r.contents)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", strings.Join(r.path, "."), err)
+		}
+	}
+	err := e.Close()
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRenderedResources(t *testing.T) {
+	var record map[string]interface{}
+	err := yaml.Unmarshal([]byte(`
+Frontend:
+  Deployment:
+    sourcegraph-frontend:
+      apiVersion: apps/v1
+      kind: Deployment
+      metadata:
+        name: sourcegraph-frontend
+  Service:
+    sourcegraph-frontend:
+      apiVersion: v1
+      kind: Service
+      metadata:
+        name: sourcegraph-frontend
+`), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err := renderedResources(record)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+
+	dir := t.TempDir()
+	for _, r := range resources {
+		err = writeRenderedResource(dir, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "Frontend", "Service", "sourcegraph-frontend.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "apiVersion: v1\nkind: Service\nmetadata:\n    name: sourcegraph-frontend\n"
+	if string(contents) != expected {
+		t.Errorf("expected %q, got %q", expected, contents)
+	}
+
+	_, err = renderedResources(map[string]interface{}{"Frontend": "text"})
+	if err == nil {
+		t.Error("expected an error for a record holding text")
+	}
+}
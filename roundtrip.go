@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// intendedRecord builds the record of the resources as loaded from the inputs with the requested transforms, the
+// baseline of --verify-roundtrip. Unlike the record fed to yaml-to-dhall it lacks the normalizing transforms, so
+// that their mistakes show up as differences.
+func intendedRecord(rs *ResourceSet) map[string]interface{} {
+	record := make(map[string]interface{})
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			contents := r.Intended
+			if contents == nil {
+				contents = r.Contents
+			}
+			insertPath(record, recordPath(r), contents)
+		}
+	}
+	return record
+}
+
+// roundtripDiffs compares the resources of the intended record with those rendered from the result. Both sides
+// are normalized first: nulls, empty lists and empty maps are dropped, as dhall-to-yaml omits them, and numbers
+// compare by value.
+func roundtripDiffs(expected, rendered map[string]interface{}) ([]string, error) {
+	expectedResources, err := renderedResources(expected)
+	if err != nil {
+		return nil, err
+	}
+	actualResources, err := renderedResources(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("rendered record: %v", err)
+	}
+
+	byPath := make(map[string]map[string]interface{})
+	for _, r := range actualResources {
+		byPath[strings.Join(r.path, ".")] = r.contents
+	}
+
+	var diffs []string
+	for _, r := range expectedResources {
+		key := strings.Join(r.path, ".")
+		contents, ok := byPath[key]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: missing from the rendered record", key))
+			continue
+		}
+		delete(byPath, key)
+		for _, diff := range diffValues(nil, normalizeRoundtrip(r.contents), normalizeRoundtrip(contents)) {
+			diffs = append(diffs, fmt.Sprintf("%s: %s", key, diff))
+		}
+	}
+
+	var extra []string
+	for key := range byPath {
+		extra = append(extra, fmt.Sprintf("%s: not in the input", key))
+	}
+	sort.Strings(extra)
+	return append(diffs, extra...), nil
+}
+
+// normalizeRoundtrip drops the values dhall-to-yaml doesn't render: nulls, empty lists and empty maps
+func normalizeRoundtrip(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for k, child := range node {
+			if child = normalizeRoundtrip(child); child != nil {
+				m[k] = child
+			}
+		}
+		if len(m) == 0 {
+			return nil
+		}
+		return m
+	case []interface{}:
+		if len(node) == 0 {
+			return nil
+		}
+		l := make([]interface{}, len(node))
+		for idx, child := range node {
+			l[idx] = normalizeRoundtrip(child)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// diffValues describes the differences between a and b, at path
+func diffValues(path fieldPath, a, b interface{}) []string {
+	switch an := a.(type) {
+	case map[string]interface{}:
+		bn, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]bool)
+		for k := range an {
+			keys[k] = true
+		}
+		for k := range bn {
+			keys[k] = true
+		}
+		var diffs []string
+		for _, k := range sortedKeys(keys) {
+			p := append(path[:len(path):len(path)], pathElem{key: k})
+			av, inA := an[k]
+			bv, inB := bn[k]
+			switch {
+			case !inB:
+				diffs = append(diffs, fmt.Sprintf("%s was dropped", p))
+			case !inA:
+				diffs = append(diffs, fmt.Sprintf("%s was added as %s", p, describeValue(bv)))
+			default:
+				diffs = append(diffs, diffValues(p, av, bv)...)
+			}
+		}
+		return diffs
+	case []interface{}:
+		bn, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		if len(an) != len(bn) {
+			return []string{fmt.Sprintf("%s has %d elements instead of %d", pathString(path), len(bn), len(an))}
+		}
+		var diffs []string
+		for idx := range an {
+			diffs = append(diffs, diffValues(append(path[:len(path):len(path)], pathElem{index: idx, isIndex: true}), an[idx], bn[idx])...)
+		}
+		return diffs
+	}
+
+	if sameScalar(a, b) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s changed from %s to %s", pathString(path), describeValue(a), describeValue(b))}
+}
+
+func pathString(path fieldPath) string {
+	if len(path) == 0 {
+		return "."
+	}
+	return path.String()
+}
+
+// sameScalar compares scalars, numbers by value so that 1 and 1.0 are the same. A number is the same as its
+// rendering by the normalizing transforms, like 8080 and "8080" or 0.5 and "500m".
+func sameScalar(a, b interface{}) bool {
+	af, aNumber := numberValue(a)
+	bf, bNumber := numberValue(b)
+	if aNumber && bNumber {
+		return af == bf
+	}
+	if s, ok := b.(string); ok && aNumber {
+		q, _ := quantityString(a)
+		return s == q
+	}
+	if s, ok := a.(string); ok && bNumber {
+		q, _ := quantityString(b)
+		return s == q
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func numberValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func describeValue(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "a map"
+	case []interface{}:
+		return "a list"
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRoundtripDiffs(t *testing.T) {
+	decode := func(s string) map[string]interface{} {
+		var m map[string]interface{}
+		if err := yaml.Unmarshal([]byte(s), &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	expected := decode(`
+Frontend:
+  Deployment:
+    frontend:
+      apiVersion: apps/v1
+      kind: Deployment
+      metadata:
+        name: frontend
+        annotations: {}
+      spec:
+        replicas: 1
+        template:
+          spec:
+            containers:
+              - name: frontend
+                args: ["--port", "08"]
+                resources:
+                  limits:
+                    cpu: 1.0
+  Service:
+    frontend:
+      apiVersion: v1
+      kind: Service
+      metadata:
+        name: frontend
+`)
+	rendered := decode(`
+Frontend:
+  Deployment:
+    frontend:
+      apiVersion: apps/v1
+      kind: Deployment
+      metadata:
+        name: frontend
+      spec:
+        replicas: 1
+        template:
+          spec:
+            containers:
+              - name: frontend
+                args: ["--port", 8]
+                resources:
+                  limits:
+                    cpu: 1
+                securityContext: null
+`)
+
+	diffs, err := roundtripDiffs(expected, rendered)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedDiffs := []string{
+		`Frontend.Deployment.frontend: .spec.template.spec.containers[0].args[1] changed from "08" to 8`,
+		"Frontend.Service.frontend: missing from the rendered record",
+	}
+	if !reflect.DeepEqual(diffs, expectedDiffs) {
+		t.Errorf("expected %q, got %q", expectedDiffs, diffs)
+	}
+}
+
+func TestSameScalar(t *testing.T) {
+	fixtures := []struct {
+		a, b     interface{}
+		expected bool
+	}{
+		{a: 1, b: 1.0, expected: true},
+		{a: "8080", b: 8080, expected: true},
+		{a: 0.5, b: "500m", expected: true},
+		{a: 2, b: "2", expected: true},
+		{a: "08", b: 8, expected: false},
+		{a: 1, b: "1k", expected: false},
+		{a: "a", b: "b", expected: false},
+	}
+
+	for _, fx := range fixtures {
+		got := sameScalar(fx.a, fx.b)
+		if got != fx.expected {
+			t.Errorf("sameScalar(%#v, %#v): expected %t, got %t", fx.a, fx.b, fx.expected, got)
+		}
+	}
+}
+
+func TestIntendedRecord(t *testing.T) {
+	verifyRoundtrip = true
+	defer func() { verifyRoundtrip = false }()
+
+	r := &Resource{Component: "frontend", Kind: "Service", Name: "frontend", Contents: map[string]interface{}{
+		"kind":   "Service",
+		"status": map[string]interface{}{},
+		"spec": map[string]interface{}{
+			"ports": []interface{}{map[string]interface{}{"port": 80, "targetPort": "8080"}},
+		},
+	}}
+	stripServerFields = true
+	defer func() { stripServerFields = false }()
+	err := applyTransforms(&ResourceSet{Components: map[string][]*Resource{"frontend": {r}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{"Frontend": map[string]interface{}{"Service": map[string]interface{}{
+		"frontend": map[string]interface{}{
+			"kind": "Service",
+			"spec": map[string]interface{}{
+				"ports": []interface{}{map[string]interface{}{"port": 80, "targetPort": "8080"}},
+			},
+		},
+	}}}
+	got := intendedRecord(&ResourceSet{Components: map[string][]*Resource{"frontend": {r}}})
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the contents with the requested transforms only %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+)
+
+// schemaPackage is a dhall record of schemas keyed by kind, like dhall-kubernetes' schemas.dhall
+type schemaPackage struct {
+	name     string
+	location string
+	kinds    map[string]bool
+}
+
+func parseSchemaPackages(specs []string) ([]*schemaPackage, error) {
+	var packages []*schemaPackage
+	seen := map[string]bool{K8sBinding: true}
+
+	for _, spec := range specs {
+		idx := strings.Index(spec, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid schema package %q, expected <name>=<url or path>", spec)
+		}
+		name := spec[:idx]
+		if !isSimpleDhallLabel(name) || strings.ContainsAny(name, "-/") {
+			return nil, fmt.Errorf("schema package name %q is not a plain identifier", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("schema package name %q is used more than once", name)
+		}
+		seen[name] = true
+		packages = append(packages, &schemaPackage{name: name, location: spec[idx+1:]})
+	}
+	return packages, nil
+}
+
+// loadPackageKinds fetches the k8s schemas and every package to learn which kinds they provide, returning
+// the kinds of the k8s schemas. The k8s schemas are only inspected if there are additional packages to choose
+// from or inspectK8s is set, otherwise the returned kinds are nil.
+func loadPackageKinds(packages []*schemaPackage, inspectK8s bool) (map[string]bool, error) {
+	if len(packages) == 0 && !inspectK8s {
+		return nil, nil
+	}
+
+	k8sLocation := schemaURL
+	if schemaPath != "" {
+		k8sLocation = schemaPath
+	}
+	all := append([]*schemaPackage{{name: K8sBinding, location: k8sLocation}}, packages...)
+
+	for _, pkg := range all {
+		log15.Info("inspecting schema package", "package", pkg.name, "location", pkg.location)
+		contents, err := readImport(pkg.location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema package %s: %v", pkg.name, err)
+		}
+		pkg.kinds = packageKinds(string(contents))
+	}
+
+	// the k8s schemas take precedence, drop kinds they provide from the additional packages
+	for _, pkg := range packages {
+		for kind := range all[0].kinds {
+			delete(pkg.kinds, kind)
+		}
+	}
+	return all[0].kinds, nil
+}
+
+// lookupPackage returns the first additional package providing kind, nil if the k8s schemas should be used
+func lookupPackage(packages []*schemaPackage, kind string) *schemaPackage {
+	for _, pkg := range packages {
+		if pkg.kinds[kind] {
+			return pkg
+		}
+	}
+	return nil
+}
+
+// packageKeyRegexp matches the field names of a record literal of schemas, one field per import
+var packageKeyRegexp = regexp.MustCompile("(?:^|[{,])\\s*(`[^`]+`|[A-Za-z_][A-Za-z0-9_/-]*)\\s*=")
+
+// packageKinds lists the top level fields of a schemas package
+func packageKinds(contents string) map[string]bool {
+	kinds := make(map[string]bool)
+	for _, m := range packageKeyRegexp.FindAllStringSubmatch(contents, -1) {
+		kinds[strings.Trim(m[1], "`")] = true
+	}
+	return kinds
+}
+
+// typeBindings binds the k8s schemas and additional schema packages for use in a type expression,
+// with imports relative to the generated file it is written to
+func typeBindings(file string) string {
+	k8sImport := schemaImport(file)
+	if schemaHash != "" {
+		k8sImport += " " + schemaHash
+	}
+	bindings := []string{fmt.Sprintf("let %s = %s", K8sBinding, k8sImport)}
+
+	packages, err := parseSchemaPackages(schemaPackages)
+	if err != nil {
+		logFatal("failed to parse schema packages", "error", err)
+	}
+	for _, pkg := range packages {
+		bindings = append(bindings, fmt.Sprintf("let %s = %s", pkg.name, importFrom(pkg.location, file)))
+	}
+
+	return strings.Join(bindings, " ") + " in"
+}
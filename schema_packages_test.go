@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPackageKinds(t *testing.T) {
+	contents := "{ Certificate = ./schemas/io.cert-manager.v1.Certificate.dhall\n" +
+		", ClusterIssuer = ./schemas/io.cert-manager.v1.ClusterIssuer.dhall\n" +
+		", `Issuer` = ./schemas/io.cert-manager.v1.Issuer.dhall\n" +
+		"}\n"
+
+	expected := map[string]bool{"Certificate": true, "ClusterIssuer": true, "Issuer": true}
+	got := packageKinds(contents)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestParseSchemaPackages(t *testing.T) {
+	packages, err := parseSchemaPackages([]string{"certManager=https://example.com/schemas.dhall", "istio=./vendor/istio/schemas.dhall"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(packages) != 2 || packages[0].name != "certManager" || packages[1].location != "./vendor/istio/schemas.dhall" {
+		t.Errorf("unexpected packages %v", packages)
+	}
+
+	for _, invalid := range []string{"noLocation", "k8s=https://example.com", "cert-manager=https://example.com"} {
+		_, err = parseSchemaPackages([]string{invalid})
+		if err == nil {
+			t.Errorf("expected error for schema package %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretEnvVar maps an environment variable imported with --secrets env to the Secret value it provides
+type secretEnvVar struct {
+	Variable  string `yaml:"variable"`
+	Namespace string `yaml:"namespace,omitempty"`
+	Secret    string `yaml:"secret"`
+	// Field is data, whose values are base64 encoded, or stringData
+	Field string `yaml:"field"`
+	Key   string `yaml:"key"`
+}
+
+// secretEnvVars are the variables imported by the generated record, by name
+var secretEnvVars = make(map[string]secretEnvVar)
+
+// secretEnvVarsMu guards secretEnvVars, Secrets of different components are converted concurrently
+var secretEnvVarsMu sync.Mutex
+
+// secretEnvImport renders the Secret value at field and key as an env import, the variable is named after the
+// record path of the Secret without the kind level, eg FRONTEND_DB_CREDENTIALS_PASSWORD
+func secretEnvImport(r *Resource, field mapField, key string) (string, error) {
+	path := recordPath(r)
+	parts := append(append(path[:len(path)-2:len(path)-2], path[len(path)-1]), key)
+	if field.path[0] == "stringData" {
+		parts = append(parts, "string")
+	}
+
+	v := secretEnvVar{
+		Variable: envVarName(parts),
+		Secret:   r.Name,
+		Field:    field.path[0],
+		Key:      key,
+	}
+	if !clusterScopedKinds[r.Kind] {
+		v.Namespace = resourceNamespace(r)
+	}
+	secretEnvVarsMu.Lock()
+	defer secretEnvVarsMu.Unlock()
+	if existing, ok := secretEnvVars[v.Variable]; ok && existing != v {
+		return "", fmt.Errorf("variable %s is used for %s %s and %s %s of Secret %s", v.Variable,
+			existing.Field, existing.Key, v.Field, v.Key, v.Secret)
+	}
+	secretEnvVars[v.Variable] = v
+
+	return fmt.Sprintf("env:%s as Text", v.Variable), nil
+}
+
+// envVarName joins parts into an upper case environment variable name, replacing characters that aren't
+// allowed in dhall env imports
+func envVarName(parts []string) string {
+	var b strings.Builder
+	for idx, part := range parts {
+		if idx > 0 {
+			b.WriteByte('_')
+		}
+		for _, c := range strings.ToUpper(part) {
+			if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' {
+				b.WriteRune(c)
+			} else {
+				b.WriteByte('_')
+			}
+		}
+	}
+	name := b.String()
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// writeSecretEnvMap writes the variables imported by the record, sorted by name
+func writeSecretEnvMap(file string) error {
+	var names []string
+	for name := range secretEnvVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars := make([]secretEnvVar, 0, len(names))
+	for _, name := range names {
+		vars = append(vars, secretEnvVars[name])
+	}
+
+	contents, err := yaml.Marshal(vars)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, 0644)
+}
+
+// secretEnvPlaceholders sets the variables imported by the record that aren't set in env to placeholders,
+// so the record can be type checked without the secrets at hand
+func secretEnvPlaceholders(env []string) []string {
+	set := make(map[string]bool)
+	for _, kv := range env {
+		set[strings.SplitN(kv, "=", 2)[0]] = true
+	}
+	for name := range secretEnvVars {
+		if !set[name] {
+			env = append(env, name+"="+RedactedValue)
+		}
+	}
+	return env
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RedactedValue replaces the values of Secret data with --secrets redact, it is valid base64 so the redacted
+// Secret can still be applied
+const RedactedValue = "UkVEQUNURUQ="
+
+// lastAppliedAnnotation holds the whole resource as last applied by kubectl, including Secret data
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// isSecret reports whether the resource is a core Secret
+func isSecret(r *Resource) bool {
+	return r.Kind == "Secret" && r.ApiVersion == "v1"
+}
+
+// excludeSecrets drops the Secrets with --secrets exclude
+func excludeSecrets(r *Resource) (bool, error) {
+	return !isSecret(r), nil
+}
+
+// redactSecrets replaces the data and stringData values of Secrets with placeholders, keeping the keys
+func redactSecrets(r *Resource) error {
+	if !isSecret(r) {
+		return nil
+	}
+
+	for field, placeholder := range map[string]string{"data": RedactedValue, "stringData": "REDACTED"} {
+		values, ok := r.Contents[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k := range values {
+			values[k] = placeholder
+		}
+	}
+
+	if metadata, ok := r.Contents["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, lastAppliedAnnotation)
+		}
+	}
+	return nil
+}
+
+// decodeSecretData moves the data values of Secrets to stringData decoded, values that aren't valid base64 or
+// don't decode to text stay in data
+func decodeSecretData(r *Resource) error {
+	if !isSecret(r) {
+		return nil
+	}
+	data, ok := r.Contents["data"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	stringData, _ := r.Contents["stringData"].(map[string]interface{})
+	for k, v := range data {
+		encoded, ok := v.(string)
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || !isText(decoded) {
+			continue
+		}
+		if _, exists := stringData[k]; exists {
+			// stringData takes precedence over data when applied
+			delete(data, k)
+			continue
+		}
+		if stringData == nil {
+			stringData = make(map[string]interface{})
+			r.Contents["stringData"] = stringData
+		}
+		stringData[k] = string(decoded)
+		delete(data, k)
+	}
+	if len(data) == 0 {
+		delete(r.Contents, "data")
+	}
+	return nil
+}
+
+// isText reports whether b is valid UTF-8 without control characters other than whitespace
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, c := range string(b) {
+		if unicode.IsControl(c) && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeSecretData moves the stringData values of Secrets to data base64 encoded, replacing data values of the
+// same key like the API server does
+func encodeSecretData(r *Resource) error {
+	if !isSecret(r) {
+		return nil
+	}
+	stringData, ok := r.Contents["stringData"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	data, ok := r.Contents["data"].(map[string]interface{})
+	if !ok {
+		data = make(map[string]interface{})
+		r.Contents["data"] = data
+	}
+	for k, v := range stringData {
+		text, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("stringData %s is not text", k)
+		}
+		data[k] = base64.StdEncoding.EncodeToString([]byte(text))
+	}
+	delete(r.Contents, "stringData")
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	r := &Resource{Kind: "Secret", ApiVersion: "v1", Contents: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        "db",
+			"annotations": map[string]interface{}{lastAppliedAnnotation: `{"data":{"password":"aHVudGVyMg=="}}`, "team": "core"},
+		},
+		"data":       map[string]interface{}{"password": "aHVudGVyMg=="},
+		"stringData": map[string]interface{}{"user": "admin"},
+	}}
+
+	err := redactSecrets(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        "db",
+			"annotations": map[string]interface{}{"team": "core"},
+		},
+		"data":       map[string]interface{}{"password": RedactedValue},
+		"stringData": map[string]interface{}{"user": "REDACTED"},
+	}
+	if !reflect.DeepEqual(r.Contents, expected) {
+		t.Errorf("expected %v, got %v", expected, r.Contents)
+	}
+
+	configMap := &Resource{Kind: "ConfigMap", ApiVersion: "v1", Contents: map[string]interface{}{"data": map[string]interface{}{"a": "b"}}}
+	_ = redactSecrets(configMap)
+	if configMap.Contents["data"].(map[string]interface{})["a"] != "b" {
+		t.Errorf("expected ConfigMap data to be kept")
+	}
+}
+
+func TestSecretEnvImports(t *testing.T) {
+	secretsMode = "env"
+	defer func() { secretsMode, secretEnvVars = "include", make(map[string]secretEnvVar) }()
+
+	r := &Resource{Component: "frontend", Kind: "Secret", ApiVersion: "v1", Name: "db.credentials", Contents: map[string]interface{}{
+		"metadata":   map[string]interface{}{"name": "db.credentials", "namespace": "prod"},
+		"data":       map[string]interface{}{"password": "aHVudGVyMg=="},
+		"stringData": map[string]interface{}{"user": "admin"},
+	}}
+	_, maps := splitMapFields(r, mapFields())
+	expr, err := withMapFields("r", maps, mapValueExpr(r))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "((r) with data = Some (toMap { password = env:FRONTEND_DB_CREDENTIALS_PASSWORD as Text })) " +
+		"with stringData = Some (toMap { user = env:FRONTEND_DB_CREDENTIALS_USER_STRING as Text })"
+	if expr != expected {
+		t.Errorf("expected %s, got %s", expected, expr)
+	}
+
+	expectedVar := secretEnvVar{Variable: "FRONTEND_DB_CREDENTIALS_PASSWORD", Namespace: "prod", Secret: "db.credentials", Field: "data", Key: "password"}
+	if got := secretEnvVars[expectedVar.Variable]; got != expectedVar {
+		t.Errorf("expected %+v, got %+v", expectedVar, got)
+	}
+}
+
+func TestEnvVarName(t *testing.T) {
+	for _, tc := range []struct {
+		parts    []string
+		expected string
+	}{
+		{[]string{"Frontend", "db", "tls.crt"}, "FRONTEND_DB_TLS_CRT"},
+		{[]string{"1st"}, "_1ST"},
+	} {
+		if got := envVarName(tc.parts); got != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, got)
+		}
+	}
+}
+
+func TestDecodeSecretData(t *testing.T) {
+	r := &Resource{Kind: "Secret", ApiVersion: "v1", Contents: map[string]interface{}{
+		"data": map[string]interface{}{
+			"password": "aHVudGVyMg==",
+			"key":      "AAEC",
+			"user":     "cm9vdA==",
+		},
+		"stringData": map[string]interface{}{"user": "admin"},
+	}}
+	err := decodeSecretData(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"data":       map[string]interface{}{"key": "AAEC"},
+		"stringData": map[string]interface{}{"password": "hunter2", "user": "admin"},
+	}
+	if !reflect.DeepEqual(r.Contents, expected) {
+		t.Errorf("expected %v, got %v", expected, r.Contents)
+	}
+
+	err = encodeSecretData(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = map[string]interface{}{
+		"data": map[string]interface{}{"key": "AAEC", "password": "aHVudGVyMg==", "user": "YWRtaW4="},
+	}
+	if !reflect.DeepEqual(r.Contents, expected) {
+		t.Errorf("expected %v, got %v", expected, r.Contents)
+	}
+}
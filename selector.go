@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// labelRequirement is one clause of a label selector
+type labelRequirement struct {
+	key string
+	// op is one of =, !=, in, notin, exists or !exists
+	op     string
+	values []string
+}
+
+// labelSelector is a conjunction of requirements, in the kubectl --selector syntax
+type labelSelector []labelRequirement
+
+// parseSelector parses selectors like app.kubernetes.io/part-of=search,tier!=debug,env in (prod,staging),!legacy
+func parseSelector(s string) (labelSelector, error) {
+	var selector labelSelector
+	for _, clause := range splitSelector(s) {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		req, err := parseRequirement(clause)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", s, err)
+		}
+		selector = append(selector, req)
+	}
+	return selector, nil
+}
+
+// splitSelector splits at the commas that are not part of a set of values
+func splitSelector(s string) []string {
+	var clauses []string
+	depth, start := 0, 0
+	for idx, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, s[start:idx])
+				start = idx + 1
+			}
+		}
+	}
+	return append(clauses, s[start:])
+}
+
+func parseRequirement(clause string) (labelRequirement, error) {
+	if strings.HasPrefix(clause, "!") {
+		return labelRequirement{key: strings.TrimSpace(clause[1:]), op: "!exists"}, nil
+	}
+	for _, op := range []string{"!=", "==", "="} {
+		if idx := strings.Index(clause, op); idx > 0 {
+			normalized := op
+			if op == "==" {
+				normalized = "="
+			}
+			return labelRequirement{
+				key:    strings.TrimSpace(clause[:idx]),
+				op:     normalized,
+				values: []string{strings.TrimSpace(clause[idx+len(op):])},
+			}, nil
+		}
+	}
+
+	fields := strings.Fields(clause)
+	if len(fields) == 1 {
+		return labelRequirement{key: fields[0], op: "exists"}, nil
+	}
+	if len(fields) >= 3 && (fields[1] == "in" || fields[1] == "notin") {
+		set := strings.TrimSpace(strings.Join(fields[2:], " "))
+		if !strings.HasPrefix(set, "(") || !strings.HasSuffix(set, ")") {
+			return labelRequirement{}, fmt.Errorf("expected a parenthesized set of values in %q", clause)
+		}
+		var values []string
+		for _, v := range strings.Split(set[1:len(set)-1], ",") {
+			values = append(values, strings.TrimSpace(v))
+		}
+		return labelRequirement{key: fields[0], op: fields[1], values: values}, nil
+	}
+	return labelRequirement{}, fmt.Errorf("unsupported requirement %q", clause)
+}
+
+func (s labelSelector) matches(labels map[string]interface{}) bool {
+	for _, req := range s {
+		value, exists := labels[req.key].(string)
+		switch req.op {
+		case "exists":
+			if !exists {
+				return false
+			}
+		case "!exists":
+			if exists {
+				return false
+			}
+		case "=", "in":
+			if !exists || !containsString(req.values, value) {
+				return false
+			}
+		case "!=", "notin":
+			if exists && containsString(req.values, value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var selector labelSelector
+
+// matchesSelector keeps the resources whose labels match --selector
+func matchesSelector(r *Resource) (bool, error) {
+	metadata, _ := r.Contents["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	return selector.matches(labels), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestLabelSelector(t *testing.T) {
+	labels := map[string]interface{}{
+		"app.kubernetes.io/part-of": "search",
+		"tier":                      "backend",
+		"env":                       "prod",
+	}
+
+	testCases := []struct {
+		selector string
+		expected bool
+	}{
+		{"app.kubernetes.io/part-of=search,tier!=debug", true},
+		{"app.kubernetes.io/part-of==search,tier!=backend", false},
+		{"env in (prod, staging)", true},
+		{"env notin (prod,staging),tier", false},
+		{"tier,!legacy", true},
+		{"!tier", false},
+		{"missing!=value", true},
+		{"missing in (a)", false},
+		{"", true},
+	}
+
+	for _, tc := range testCases {
+		selector, err := parseSelector(tc.selector)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.selector, err)
+		}
+		if got := selector.matches(labels); got != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.selector, tc.expected, got)
+		}
+	}
+
+	for _, invalid := range []string{"env in prod", "a b c"} {
+		_, err := parseSelector(invalid)
+		if err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
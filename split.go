@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	flag "github.com/spf13/pflag"
+)
+
+// splitManifestFile records the inputs of the split outputs in --split-dir, to tell which changed on the next run
+const splitManifestFile = ".ds-to-dhall-inputs.json"
+
+// splitManifest has the digests of the inputs of every split output, by top level record key, and of the root
+// record importing them
+type splitManifest struct {
+	Inputs map[string]string `json:"inputs"`
+	Root   string            `json:"root"`
+}
+
+// splitOutputs writes the record of every top level record key, a component unless the record is keyed by
+// namespace first, to its own file in dir and regenerates only those whose inputs changed since the previous run
+type splitOutputs struct {
+	dir      string
+	previous splitManifest
+	current  splitManifest
+	imports  localImports
+}
+
+var splits *splitOutputs
+
+// loadSplitOutputs reads the manifest of the previous run in dir, if any. Staged outputs start from scratch.
+func loadSplitOutputs(dir string) (*splitOutputs, error) {
+	s := &splitOutputs{dir: dir, current: splitManifest{Inputs: make(map[string]string)}}
+	if stagedOutputs != nil {
+		return s, nil
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dir, splitManifestFile))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(contents, &s.previous)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", splitManifestFile, err)
+	}
+	// the records of keys that are gone are removed, a manifest naming files outside of dir is not trusted
+	for key := range s.previous.Inputs {
+		err = checkSplitKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", splitManifestFile, err)
+		}
+	}
+	return s, nil
+}
+
+// checkSplitKey rejects top level record keys that can't be used as a file name in the split directory
+func checkSplitKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return fmt.Errorf("record key %q can't be used as a file name", key)
+	}
+	return nil
+}
+
+// file is the output the record of key is written to, staged if outputs are staged
+func (s *splitOutputs) file(key string) string {
+	return stageOutput(filepath.Join(s.dir, key+".dhall"))
+}
+
+// recordFile is the generated file the expression of r ends up in, which its imports are relative to
+func recordFile(r *Resource) string {
+	if splits == nil {
+		return destinationFile
+	}
+	return splits.file(recordPath(r)[0])
+}
+
+// compose converts the resources of the top level keys whose inputs changed, writes their records and removes the
+// records of keys that are gone. It returns the root record importing the records of every key.
+func (s *splitOutputs) compose(ctx context.Context, rs *ResourceSet) (string, error) {
+	resources := sortedResources(rs)
+	byKey := make(map[string][]*Resource)
+	for _, r := range resources {
+		key := recordPath(r)[0]
+		err := checkSplitKey(key)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", r.Source, err)
+		}
+		byKey[key] = append(byKey[key], r)
+	}
+
+	changed := make(map[string]bool)
+	var convert []*Resource
+	for key, keyResources := range byKey {
+		digest, err := s.inputsDigest(key, keyResources)
+		if err != nil {
+			return "", err
+		}
+		s.current.Inputs[key] = digest
+		if _, err := os.Stat(s.file(key)); err == nil && s.previous.Inputs[key] == digest {
+			recordOutput(s.file(key))
+			continue
+		}
+		changed[key] = true
+	}
+	for _, r := range resources {
+		if changed[recordPath(r)[0]] {
+			convert = append(convert, r)
+		}
+	}
+	log15.Info("regenerating split outputs", "dir", s.dir, "changed", len(changed), "unchanged", len(byKey)-len(changed))
+
+	exprs, err := convertAll(ctx, convert)
+	if err != nil {
+		return "", err
+	}
+	for key := range changed {
+		var keyResources []*Resource
+		var keyExprs []string
+		for idx, r := range convert {
+			if recordPath(r)[0] == key {
+				keyResources = append(keyResources, r)
+				keyExprs = append(keyExprs, exprs[idx])
+			}
+		}
+		file := s.file(key)
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			return "", err
+		}
+		err = ioutil.WriteFile(file, []byte(assembleRecord(keyResources, keyExprs, 1)), 0644)
+		if err != nil {
+			return "", err
+		}
+		err = finalizeDhallFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to finalize %s: %v", file, err)
+		}
+	}
+
+	for key := range s.previous.Inputs {
+		if _, ok := byKey[key]; ok {
+			continue
+		}
+		file := s.file(key)
+		for _, f := range []string{file, file + ".cbor"} {
+			err = os.Remove(f)
+			if err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+	}
+
+	root := make(map[string]interface{})
+	for key := range byKey {
+		root[key] = importFrom(s.file(key), destinationFile)
+	}
+	if len(root) == 0 {
+		return "{=}\n", nil
+	}
+	return recordLiteral(root) + "\n", nil
+}
+
+// inputsDigest hashes what the record of key is generated from: the version, the flags of the run, and the record
+// path, type, local type imports and contents of its resources
+func (s *splitOutputs) inputsDigest(key string, resources []*Resource) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "ds-to-dhall %s\n", version)
+	var flags []string
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		flags = append(flags, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+	})
+	sort.Strings(flags)
+	fmt.Fprintf(h, "%s\n", strings.Join(flags, " "))
+
+	file := s.file(key)
+	for _, r := range resources {
+		typeExpr := resourceTypeExpr(r, file)
+		fmt.Fprintf(h, "%s\n%s\n%s\n", strings.Join(recordPath(r), "."), typeExpr,
+			s.imports.digest(typeExpr, filepath.Dir(file)))
+		err := encodeYaml(h, r.Contents)
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// rootUnchanged reports whether the previous run wrote the same root record, which is then left alone
+func (s *splitOutputs) rootUnchanged(root string) bool {
+	sum := sha256.Sum256([]byte(root))
+	s.current.Root = hex.EncodeToString(sum[:])
+	if _, err := os.Stat(destinationFile); err != nil {
+		return false
+	}
+	return s.previous.Root == s.current.Root
+}
+
+// save writes the manifest of this run, unless outputs are staged
+func (s *splitOutputs) save() error {
+	if stagedOutputs != nil {
+		return nil
+	}
+	contents, err := json.MarshalIndent(s.current, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(s.dir, splitManifestFile), contents, 0644)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitOutputsRegenerateChanged(t *testing.T) {
+	fakeYamlToDhall(t)
+	bin := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(bin, "dhall"), []byte("#!/bin/sh\nexit 0\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	dir := t.TempDir()
+	defer func() { destinationFile, conversionJobs = "", 0 }()
+	destinationFile, conversionJobs = filepath.Join(dir, "record.dhall"), 1
+
+	resource := func(component, name string) *Resource {
+		return &Resource{Component: component, Kind: "Service", Name: name, TypeSource: "json", Contents: map[string]interface{}{
+			"kind": "Service", "metadata": map[string]interface{}{"name": name},
+		}}
+	}
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"frontend": {resource("frontend", "frontend")},
+		"grafana":  {resource("grafana", "grafana")},
+	}}
+	run := func() (*splitOutputs, string) {
+		s, err := loadSplitOutputs(filepath.Join(dir, "split"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := s.compose(context.Background(), rs)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !s.rootUnchanged(root) {
+			err = ioutil.WriteFile(destinationFile, []byte(root), 0644)
+		}
+		if err == nil {
+			err = s.save()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s, root
+	}
+	read := func(file string) string {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "split", file))
+		if err != nil {
+			return ""
+		}
+		return string(contents)
+	}
+
+	_, root := run()
+	expected := "{ Frontend = ./split/Frontend.dhall, Grafana = ./split/Grafana.dhall }\n"
+	if root != expected {
+		t.Errorf("expected root\n%s\ngot\n%s", expected, root)
+	}
+	expected = GeneratedComment + "let Grafana-Service-grafana = {=}\n\nin  { Service = { grafana = Grafana-Service-grafana } }\n"
+	if got := read("Grafana.dhall"); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+
+	// only the component whose inputs changed is written again
+	for _, file := range []string{"Frontend.dhall", "Grafana.dhall"} {
+		err = ioutil.WriteFile(filepath.Join(dir, "split", file), []byte("untouched"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rs.Components["grafana"][0].Contents["spec"] = map[string]interface{}{"type": "ClusterIP"}
+	s, _ := run()
+	if read("Frontend.dhall") != "untouched" || read("Grafana.dhall") == "untouched" {
+		t.Errorf("expected only Grafana to be regenerated, got %q and %q", read("Frontend.dhall"), read("Grafana.dhall"))
+	}
+	if s.previous.Root != s.current.Root {
+		t.Error("expected the root record to be left alone")
+	}
+
+	// the records of components that are gone are removed
+	delete(rs.Components, "grafana")
+	_, root = run()
+	if _, err := os.Stat(filepath.Join(dir, "split", "Grafana.dhall")); !os.IsNotExist(err) {
+		t.Errorf("expected Grafana.dhall to be removed, got %v", err)
+	}
+	if root != "{ Frontend = ./split/Frontend.dhall }\n" {
+		t.Errorf("unexpected root %s", root)
+	}
+}
+
+func TestSplitOutputsRejectKeysThatArentFileNames(t *testing.T) {
+	dir := t.TempDir()
+	s, err := loadSplitOutputs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"..": {{Component: "..", Kind: "Service", Name: "frontend", Source: "service.yaml", Contents: map[string]interface{}{}}},
+	}}
+	_, err = s.compose(context.Background(), rs)
+	if err == nil || !strings.Contains(err.Error(), "can't be used as a file name") {
+		t.Errorf("expected the key .. to be rejected, got %v", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, splitManifestFile), []byte(`{"inputs": {"../../etc/passwd": "x"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadSplitOutputs(dir)
+	if err == nil || !strings.Contains(err.Error(), "can't be used as a file name") {
+		t.Errorf("expected a manifest naming files outside of the split directory to be rejected, got %v", err)
+	}
+}
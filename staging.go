@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/inconshreveable/log15"
+)
+
+// stagedOutputs maps the files the outputs are written to instead of the configured ones, to the configured ones.
+// Outputs are staged in stagingDir, under their absolute configured path so that the staged outputs are laid out
+// like the configured ones and import each other with the same relative imports. Imports of other local files are
+// relative to the staged file like all imports composed by importFrom, which makes them differ in text but not in
+// meaning from the configured outputs.
+var stagedOutputs map[string]string
+
+// stagingDir is the temporary directory holding the staged outputs, created with the first one
+var stagingDir string
+
+// stagedOutputsMu guards stagedOutputs and stagingDir, ConfigMap data files are staged by concurrent conversions
+var stagedOutputsMu sync.Mutex
+
+// outputFileFlags are the variables of the flags naming generated files
+var outputFileFlags = []*string{
+	&destinationFile, &typeFile, &schemaFile, &typesUnionFile, &toListFile, &secretEnvMapFile, &componentsFile,
+	&imagesFile, &capacityFile, &portsFile, &rbacSummaryFile, &checksumsFile,
+}
+
+// stageOutputs points the output file flags at staged files, leaving the configured files alone
+func stageOutputs() {
+	stagedOutputs = make(map[string]string)
+	for _, file := range outputFileFlags {
+		if *file != "" {
+			*file = stageOutput(*file)
+		}
+	}
+}
+
+// stageOutput returns the file an output is written to, its staged copy if outputs are staged
+func stageOutput(file string) string {
+	if stagedOutputs == nil {
+		return file
+	}
+	stagedOutputsMu.Lock()
+	defer stagedOutputsMu.Unlock()
+
+	var err error
+	if stagingDir == "" {
+		stagingDir, err = ioutil.TempDir("", "ds-to-dhall-staged")
+		if err != nil {
+			logFatal("failed to create staging directory", "error", err)
+		}
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		logFatal("failed to resolve output path", "error", err, "file", file)
+	}
+	staged := filepath.Join(stagingDir, strings.TrimPrefix(abs, filepath.VolumeName(abs)))
+	err = os.MkdirAll(filepath.Dir(staged), 0755)
+	if err != nil {
+		logFatal("failed to create staging directory", "error", err, "dir", filepath.Dir(staged))
+	}
+	stagedOutputs[staged] = file
+	return staged
+}
+
+// configuredOutput returns the configured file of a staged one, or of a file derived from it like its cbor
+// encoding, and other files as they are
+func configuredOutput(file string) string {
+	if configured, ok := stagedOutputs[file]; ok {
+		return configured
+	}
+	for staged, configured := range stagedOutputs {
+		if strings.HasPrefix(file, staged+".") {
+			return configured + strings.TrimPrefix(file, staged)
+		}
+	}
+	return file
+}
+
+// removeStagedOutputs removes the staging directory with the staged files and the files derived from them
+func removeStagedOutputs() {
+	if stagingDir == "" {
+		return
+	}
+	err := os.RemoveAll(stagingDir)
+	if err != nil {
+		log15.Warn("failed to remove staged outputs", "error", err, "dir", stagingDir)
+	}
+	stagingDir = ""
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// phases are the instrumented phases of a conversion, in the order they are reported
+var phases = []string{"discovery", "yamlComposition", "typeComposition", "yamlToDhall", "formatting", "schemaWriting"}
+
+// phaseTimings sums the time a run spends in each phase. The conversion phases add up the time of every concurrently
+// converted component, so they can exceed the duration of the run.
+type phaseTimings struct {
+	mu        sync.Mutex
+	start     time.Time
+	durations map[string]time.Duration
+}
+
+var timings *phaseTimings
+
+func newPhaseTimings() *phaseTimings {
+	return &phaseTimings{start: time.Now(), durations: make(map[string]time.Duration)}
+}
+
+// track starts timing phase, until the returned function is called
+func (t *phaseTimings) track(phase string) func() {
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.durations[phase] += time.Since(start)
+	}
+}
+
+// logContext returns the duration of the run and of its phases as log context
+func (t *phaseTimings) logContext() []interface{} {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ctx := []interface{}{"duration", time.Since(t.start).Round(time.Millisecond)}
+	for _, phase := range phases {
+		ctx = append(ctx, phase, t.durations[phase].Round(time.Millisecond))
+	}
+	return ctx
+}
+
+// runReport is the --report of a run, durations are in seconds
+type runReport struct {
+	Version         string             `json:"version"`
+	Components      int                `json:"components"`
+	Resources       int                `json:"resources"`
+	Skipped         []string           `json:"skipped,omitempty"`
+	Untyped         []untypedResource  `json:"untyped,omitempty"`
+	Duration        float64            `json:"duration"`
+	Phases          map[string]float64 `json:"phases"`
+	ConversionCache *cacheReport       `json:"conversionCache,omitempty"`
+	LoadErrors      []reportedError    `json:"loadErrors,omitempty"`
+	Findings        []string           `json:"findings,omitempty"`
+}
+
+// reportedError is a manifest that failed to load
+type reportedError struct {
+	Manifest string `json:"manifest"`
+	Error    string `json:"error"`
+}
+
+// reported is what the --report lists besides the timings, kept as the run goes so that the report of a failed run
+// tells why it failed
+var reported struct {
+	set        *ResourceSet
+	loadErrors loadErrors
+	findings   []string
+}
+
+// untypedResource is a resource of a kind without schema, typed by --unknown-kind from its yaml or as Prelude JSON
+type untypedResource struct {
+	Manifest string `json:"manifest"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	TypedAs  string `json:"typedAs"`
+}
+
+type cacheReport struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+func buildRunReport(rs *ResourceSet, t *phaseTimings) runReport {
+	report := runReport{
+		Version:  version,
+		Phases:   make(map[string]float64),
+		Findings: reported.findings,
+	}
+	for _, failed := range reported.loadErrors {
+		report.LoadErrors = append(report.LoadErrors, reportedError{Manifest: failed.manifest, Error: failed.err.Error()})
+	}
+	if rs != nil {
+		// runs failing to load their inputs have no resource set
+		report.Components = len(rs.Components)
+		report.Skipped = rs.Skipped
+		for _, r := range sortedResources(rs) {
+			report.Resources++
+			if r.TypeSource == "inferred" || r.TypeSource == "json" {
+				report.Untyped = append(report.Untyped, untypedResource{Manifest: r.Source, Kind: r.Kind, Name: r.Name, TypedAs: r.TypeSource})
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report.Duration = time.Since(t.start).Seconds()
+	for _, phase := range phases {
+		report.Phases[phase] = t.durations[phase].Seconds()
+	}
+
+	if conversions != nil {
+		report.ConversionCache = &cacheReport{Hits: conversionCacheStats.hits, Misses: conversionCacheStats.misses}
+	}
+	return report
+}
+
+// writeRunReport writes the report of the run as json. It isn't a generated output: it differs from run to run and
+// is left out of the checksums and of diff and --check.
+func writeRunReport(rs *ResourceSet, file string) error {
+	contents, err := json.MarshalIndent(buildRunReport(rs, timings), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(contents, '\n'), 0644)
+}
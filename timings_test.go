@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPhaseTimings(t *testing.T) {
+	defer func(previous *phaseTimings) { timings = previous }(timings)
+	timings = newPhaseTimings()
+
+	for i := 0; i < 2; i++ {
+		stop := timings.track("yamlToDhall")
+		time.Sleep(5 * time.Millisecond)
+		stop()
+	}
+	if got := timings.durations["yamlToDhall"]; got < 10*time.Millisecond {
+		t.Errorf("expected the tracked durations to add up, got %s", got)
+	}
+
+	ctx := timings.logContext()
+	if len(ctx) != 2*(len(phases)+1) || ctx[0] != "duration" || ctx[2] != phases[0] {
+		t.Errorf("expected the run duration followed by every phase, got %v", ctx)
+	}
+
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"frontend":     {{Kind: "Deployment", Name: "frontend"}, {Kind: "Service", Name: "frontend"}},
+		"pgsql":        {{Kind: "StatefulSet", Name: "pgsql"}},
+		"cert-manager": {{Source: "issuer.yaml", Kind: "Issuer", Name: "letsencrypt", TypeSource: "inferred"}},
+	}}
+	file := filepath.Join(t.TempDir(), "report.json")
+	err := writeRunReport(rs, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report runReport
+	err = json.Unmarshal(contents, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Components != 3 || report.Resources != 4 {
+		t.Errorf("expected 3 components and 4 resources, got %d and %d", report.Components, report.Resources)
+	}
+	if len(report.Untyped) != 1 || report.Untyped[0] != (untypedResource{Manifest: "issuer.yaml", Kind: "Issuer", Name: "letsencrypt", TypedAs: "inferred"}) {
+		t.Errorf("expected the inferred issuer to be reported, got %v", report.Untyped)
+	}
+	if len(report.Phases) != len(phases) || report.Phases["yamlToDhall"] < 0.01 {
+		t.Errorf("expected every phase with its duration, got %v", report.Phases)
+	}
+	if report.Duration < report.Phases["yamlToDhall"] {
+		t.Errorf("expected the run to last at least as long as its only phase, got %v", report.Duration)
+	}
+}
+
+func TestRunReportOfFailedRun(t *testing.T) {
+	defer func(previous *phaseTimings) { timings = previous }(timings)
+	timings = newPhaseTimings()
+	defer func() { reported.loadErrors, reported.findings = nil, nil }()
+	reported.loadErrors = loadErrors{{manifest: "broken.yaml", err: errors.New("not a mapping")}}
+	reported.findings = []string{"frontend.yaml: Deployment frontend: missing spec.selector"}
+
+	// no resource set when the inputs failed to load
+	report := buildRunReport(nil, timings)
+	if len(report.LoadErrors) != 1 || report.LoadErrors[0] != (reportedError{Manifest: "broken.yaml", Error: "not a mapping"}) {
+		t.Errorf("expected the load error to be reported, got %v", report.LoadErrors)
+	}
+	if len(report.Findings) != 1 || report.Components != 0 {
+		t.Errorf("expected the finding and no components, got %v and %d", report.Findings, report.Components)
+	}
+}
+
+func TestPhaseTimingsDisabled(t *testing.T) {
+	var disabled *phaseTimings
+	disabled.track("discovery")()
+	if ctx := disabled.logContext(); ctx != nil {
+		t.Errorf("expected no log context, got %v", ctx)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/BurntSushi/toml"
+)
+
+// encodeTOML renders decoded yaml or json as a TOML document. Maps become tables and lists of maps arrays of
+// tables, null values are left out as TOML has no null.
+func encodeTOML(doc map[string]interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	e := toml.NewEncoder(&b)
+	e.Indent = ""
+	err := e.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestEncodeTOML(t *testing.T) {
+	doc := map[string]interface{}{
+		"Frontend": map[string]interface{}{
+			"Deployment": map[string]interface{}{
+				"sourcegraph-frontend": map[string]interface{}{
+					"containers": map[string]interface{}{
+						"frontend": map[string]interface{}{
+							"image": "sourcegraph/frontend:3.20",
+							"args":  nil,
+							"env":   []interface{}{"PGHOST", "SRC_GIT_SERVERS"},
+							"ports": []interface{}{
+								map[string]interface{}{"name": "http", "containerPort": 3080},
+								map[string]interface{}{"name": "debug", "containerPort": 6060},
+							},
+						},
+					},
+				},
+			},
+		},
+		"Jaeger.io": map[string]interface{}{"Service": map[string]interface{}{}},
+	}
+
+	got, err := encodeTOML(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `[Frontend]
+[Frontend.Deployment]
+[Frontend.Deployment.sourcegraph-frontend]
+[Frontend.Deployment.sourcegraph-frontend.containers]
+[Frontend.Deployment.sourcegraph-frontend.containers.frontend]
+env = ["PGHOST", "SRC_GIT_SERVERS"]
+image = "sourcegraph/frontend:3.20"
+
+[[Frontend.Deployment.sourcegraph-frontend.containers.frontend.ports]]
+containerPort = 3080
+name = "http"
+
+[[Frontend.Deployment.sourcegraph-frontend.containers.frontend.ports]]
+containerPort = 6060
+name = "debug"
+
+["Jaeger.io"]
+["Jaeger.io".Service]
+`
+	if string(got) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
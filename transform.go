@@ -0,0 +1,198 @@
+package main
+
+import "fmt"
+
+// transform is a rewrite of the contents of loaded resources, applied before the dhall types are assigned
+type transform struct {
+	name    string
+	enabled func() bool
+	// prepare optionally runs once over the whole set before apply
+	prepare func(rs *ResourceSet) error
+	apply   func(r *Resource) error
+	// finish optionally runs once after apply was called on every resource
+	finish func() error
+	// normalizes marks the rewrites to the representation the dhall types expect, like "8080" to 8080, which
+	// don't change what the cluster sees. They run last, --verify-roundtrip compares with the contents before them.
+	normalizes bool
+}
+
+// transforms are applied in order to every resource
+var transforms = []transform{
+	{name: "compat-patches", enabled: func() bool { return len(compatPatches) > 0 }, apply: applyCompatPatches},
+	{name: "strip-server-fields", enabled: func() bool { return stripServerFields }, apply: stripServerPopulatedFields},
+	{name: "strip-nulls", enabled: func() bool { return stripNulls }, apply: stripNullFields},
+	{name: "decode-secret-data", enabled: func() bool { return decodeSecrets }, apply: decodeSecretData},
+	{name: "encode-secret-data", enabled: func() bool { return encodeSecrets }, apply: encodeSecretData},
+	{name: "patch", enabled: func() bool { return len(patches) > 0 }, apply: applyPatches, finish: checkPatchesApplied},
+	{name: "drop", enabled: func() bool { return len(dropRules) > 0 }, apply: dropFields},
+	{name: "transform", enabled: func() bool { return len(transformRules) > 0 }, apply: applyTransformRules},
+	{name: "set", enabled: func() bool { return len(setRules) > 0 }, apply: setFields},
+	// with --secrets env the values are imported from the environment and aren't needed past loading
+	{name: "redact-secrets", enabled: func() bool { return secretsMode == "redact" || secretsMode == "env" }, apply: redactSecrets},
+	{name: "common-metadata", enabled: func() bool { return len(addLabels)+len(addAnnotations) > 0 }, apply: addCommonMetadata},
+	{name: "rename", enabled: func() bool { return namePrefix+nameSuffix != "" }, prepare: collectResourceNames, apply: renameResource},
+	{name: "rewrite-registry", enabled: func() bool { return len(registryRewrites) > 0 }, apply: rewriteImageRegistries},
+	{name: "pin-digests", enabled: func() bool { return digests != nil }, apply: pinImageDigests},
+	{name: "int-or-string", enabled: func() bool { return true }, apply: normalizeIntOrString, normalizes: true},
+	{name: "quantities", enabled: func() bool { return true }, apply: normalizeQuantities, normalizes: true},
+}
+
+func applyTransforms(rs *ResourceSet) error {
+	intended := false
+	// resources failing a transform are left out of the next ones, the failures are reported together
+	var failed loadErrors
+	failedResources := make(map[*Resource]bool)
+	for _, t := range transforms {
+		if t.normalizes && !intended {
+			keepIntendedContents(rs)
+			intended = true
+		}
+		if !t.enabled() {
+			continue
+		}
+		if t.prepare != nil {
+			err := t.prepare(rs)
+			if err != nil {
+				return fmt.Errorf("failed to prepare %s: %v", t.name, err)
+			}
+		}
+		for _, resources := range rs.Components {
+			for _, r := range resources {
+				if failedResources[r] {
+					continue
+				}
+				err := t.apply(r)
+				if err != nil {
+					failed = append(failed, loadError{manifest: r.Source, err: fmt.Errorf("failed to apply %s: %v", t.name, err)})
+					failedResources[r] = true
+				}
+			}
+		}
+		if t.finish != nil {
+			err := t.finish()
+			if err != nil {
+				return fmt.Errorf("failed to apply %s: %v", t.name, err)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		removeResources(rs, failedResources)
+		return failed
+	}
+	return nil
+}
+
+// keepIntendedContents keeps a copy of the contents of every resource for --verify-roundtrip, before the
+// normalizing transforms
+func keepIntendedContents(rs *ResourceSet) {
+	if !verifyRoundtrip {
+		return
+	}
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			r.Intended = copyValue(r.Contents).(map[string]interface{})
+		}
+	}
+}
+
+// serverPopulatedMetadata are the metadata fields the API server fills in, present in exported manifests
+var serverPopulatedMetadata = []string{
+	"creationTimestamp",
+	"deletionGracePeriodSeconds",
+	"deletionTimestamp",
+	"generation",
+	"managedFields",
+	"resourceVersion",
+	"selfLink",
+	"uid",
+}
+
+// stripServerPopulatedFields removes status and the server populated metadata fields
+func stripServerPopulatedFields(r *Resource) error {
+	delete(r.Contents, "status")
+
+	metadata, ok := r.Contents["metadata"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for _, field := range serverPopulatedMetadata {
+		delete(metadata, field)
+	}
+	return nil
+}
+
+// stripNullFields recursively removes the keys with null values
+func stripNullFields(r *Resource) error {
+	removeNulls(r.Contents)
+	return nil
+}
+
+func removeNulls(v interface{}) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			if child == nil {
+				delete(node, k)
+				continue
+			}
+			removeNulls(child)
+		}
+	case []interface{}:
+		for _, child := range node {
+			removeNulls(child)
+		}
+	}
+}
+
+var dropRules []dropRule
+
+// dropFields removes the fields matched by the drop rules
+func dropFields(r *Resource) error {
+	for _, rule := range dropRules {
+		if rule.kind.matches(r) {
+			deletePath(r.Contents, rule.path)
+		}
+	}
+	return nil
+}
+
+var setRules []setRule
+
+// setFields applies the config defaults and overrides
+func setFields(r *Resource) error {
+	for _, rule := range setRules {
+		if rule.kind.matches(r) {
+			setPath(r.Contents, rule.path, rule.value, rule.onlyMissing)
+		}
+	}
+	return nil
+}
+
+// podTemplateMetadata is the location of the pod template metadata in workload kinds
+var podTemplateMetadata = map[string]fieldPath{
+	"CronJob":               {{key: "spec"}, {key: "jobTemplate"}, {key: "spec"}, {key: "template"}, {key: "metadata"}},
+	"DaemonSet":             {{key: "spec"}, {key: "template"}, {key: "metadata"}},
+	"Deployment":            {{key: "spec"}, {key: "template"}, {key: "metadata"}},
+	"Job":                   {{key: "spec"}, {key: "template"}, {key: "metadata"}},
+	"ReplicaSet":            {{key: "spec"}, {key: "template"}, {key: "metadata"}},
+	"ReplicationController": {{key: "spec"}, {key: "template"}, {key: "metadata"}},
+	"StatefulSet":           {{key: "spec"}, {key: "template"}, {key: "metadata"}},
+}
+
+// addCommonMetadata stamps the --add-label and --add-annotation values on the resource metadata and
+// with --add-to-pod-templates on its pod template
+func addCommonMetadata(r *Resource) error {
+	paths := []fieldPath{{{key: "metadata"}}}
+	if template, ok := podTemplateMetadata[r.Kind]; ok && addToTemplates {
+		paths = append(paths, template)
+	}
+
+	for _, path := range paths {
+		for field, values := range map[string]map[string]string{"labels": addLabels, "annotations": addAnnotations} {
+			for k, v := range values {
+				setPath(r.Contents, append(path[:len(path):len(path)], pathElem{key: field}, pathElem{key: k}), v, false)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TransformRule applies Operations to the resources matched by Select
+type TransformRule struct {
+	Select     ResourceSelector `yaml:"select"`
+	Operations []Operation      `yaml:"operations"`
+}
+
+// ResourceSelector matches resources by kind, name and labels, empty fields match everything
+type ResourceSelector struct {
+	Kind   string            `yaml:"kind"`
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+// Operation is exactly one of set (with value), delete or rename (with to) of the field at a path
+type Operation struct {
+	Set    string      `yaml:"set"`
+	Value  interface{} `yaml:"value"`
+	Delete string      `yaml:"delete"`
+	Rename string      `yaml:"rename"`
+	To     string      `yaml:"to"`
+}
+
+// transformRule is a parsed TransformRule
+type transformRule struct {
+	selector   ResourceSelector
+	operations []func(r *Resource)
+}
+
+func (s ResourceSelector) matches(r *Resource) bool {
+	if s.Kind != "" && !kindSelector(s.Kind).matches(r) {
+		return false
+	}
+	if s.Name != "" && s.Name != r.Name {
+		return false
+	}
+	if len(s.Labels) == 0 {
+		return true
+	}
+	metadata, _ := r.Contents["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	for k, v := range s.Labels {
+		if value, ok := labels[k].(string); !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+func loadTransformRules(file string) ([]transformRule, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []TransformRule
+	decoder := yaml.NewDecoder(strings.NewReader(string(contents)))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode transform rules %s: %v", file, err)
+	}
+
+	var parsed []transformRule
+	for idx, rule := range rules {
+		tr := transformRule{selector: rule.Select}
+		for _, op := range rule.Operations {
+			fn, err := parseOperation(op)
+			if err != nil {
+				return nil, fmt.Errorf("invalid operation in rule %d of %s: %v", idx+1, file, err)
+			}
+			tr.operations = append(tr.operations, fn)
+		}
+		parsed = append(parsed, tr)
+	}
+	return parsed, nil
+}
+
+func parseOperation(op Operation) (func(r *Resource), error) {
+	var set []string
+	for name, path := range map[string]string{"set": op.Set, "delete": op.Delete, "rename": op.Rename} {
+		if path != "" {
+			set = append(set, name)
+		}
+	}
+	if len(set) != 1 {
+		return nil, fmt.Errorf("expected exactly one of set, delete or rename, got %d", len(set))
+	}
+
+	switch {
+	case op.Set != "":
+		path, err := parseFieldPath(op.Set)
+		if err != nil {
+			return nil, err
+		}
+		return func(r *Resource) { setPath(r.Contents, path, op.Value, false) }, nil
+	case op.Delete != "":
+		path, err := parseFieldPath(op.Delete)
+		if err != nil {
+			return nil, err
+		}
+		return func(r *Resource) { deletePath(r.Contents, path) }, nil
+	default:
+		path, err := parseFieldPath(op.Rename)
+		if err != nil {
+			return nil, err
+		}
+		if op.To == "" {
+			return nil, fmt.Errorf("rename of %s is missing to", op.Rename)
+		}
+		return func(r *Resource) { renamePath(r.Contents, path, op.To) }, nil
+	}
+}
+
+var transformRules []transformRule
+
+// applyTransformRules runs the operations of the --transform rules matching the resource, in file order
+func applyTransformRules(r *Resource) error {
+	for _, rule := range transformRules {
+		if !rule.selector.matches(r) {
+			continue
+		}
+		for _, op := range rule.operations {
+			op(r)
+		}
+	}
+	return nil
+}
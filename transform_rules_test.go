@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyTransformRules(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	err := ioutil.WriteFile(rulesFile, []byte(`
+- select:
+    kind: Deployment
+    labels:
+      tier: web
+  operations:
+    - set: .spec.replicas
+      value: 3
+    - delete: .metadata.annotations.description
+    - rename: .metadata.annotations.owner
+      to: team
+- select:
+    name: other
+  operations:
+    - set: .spec.replicas
+      value: 1
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transformRules, err = loadTransformRules(rulesFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { transformRules = nil }()
+
+	r := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  labels:
+    tier: web
+  annotations:
+    description: frontend
+    owner: distribution
+spec:
+  replicas: 1
+`)
+
+	err = applyTransformRules(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertContents(t, r, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  labels:
+    tier: web
+  annotations:
+    team: distribution
+spec:
+  replicas: 3
+`)
+}
+
+func TestParseOperation(t *testing.T) {
+	invalid := []Operation{
+		{},
+		{Set: ".spec.replicas", Delete: ".spec.replicas"},
+		{Rename: ".spec.replicas"},
+		{Delete: "spec"},
+	}
+
+	for _, op := range invalid {
+		_, err := parseOperation(op)
+		if err == nil {
+			t.Errorf("expected an error for %+v", op)
+		}
+	}
+}
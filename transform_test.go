@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func decodeTestResource(t *testing.T, manifest string) *Resource {
+	var contents map[string]interface{}
+	err := yaml.Unmarshal([]byte(manifest), &contents)
+	if err != nil {
+		t.Fatalf("failed to decode manifest: %v", err)
+	}
+	kind, _ := contents["kind"].(string)
+	apiVersion, _ := contents["apiVersion"].(string)
+	metadata, _ := contents["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return &Resource{Source: "test.yaml", Kind: kind, ApiVersion: apiVersion, Name: name, Contents: contents}
+}
+
+func assertContents(t *testing.T, r *Resource, expected string) {
+	var contents map[string]interface{}
+	err := yaml.Unmarshal([]byte(expected), &contents)
+	if err != nil {
+		t.Fatalf("failed to decode expected contents: %v", err)
+	}
+	if !reflect.DeepEqual(r.Contents, contents) {
+		got, _ := yaml.Marshal(r.Contents)
+		t.Errorf("expected contents:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestStripServerPopulatedFields(t *testing.T) {
+	r := decodeTestResource(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  uid: 0b6c1b7a-3d1e-4a5e-9f43-6b9c54e3c1a2
+  resourceVersion: "123"
+  creationTimestamp: "2020-10-01T00:00:00Z"
+  managedFields:
+    - manager: kubectl
+  labels:
+    app: frontend
+spec:
+  clusterIP: 10.0.0.1
+status:
+  loadBalancer: {}
+`)
+
+	err := stripServerPopulatedFields(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertContents(t, r, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  labels:
+    app: frontend
+spec:
+  clusterIP: 10.0.0.1
+`)
+}
+
+func TestDropFields(t *testing.T) {
+	var err error
+	dropRules, err = parseDropRules([]string{
+		"Service:.spec.clusterIP",
+		`*:.metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error parsing drop rules: %v", err)
+	}
+	defer func() { dropRules = nil }()
+
+	service := decodeTestResource(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+    description: frontend
+spec:
+  clusterIP: 10.0.0.1
+`)
+	deployment := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  clusterIP: kept
+`)
+
+	for _, r := range []*Resource{service, deployment} {
+		err = dropFields(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	assertContents(t, service, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  annotations:
+    description: frontend
+spec: {}
+`)
+	assertContents(t, deployment, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  clusterIP: kept
+`)
+}
+
+func TestAddCommonMetadata(t *testing.T) {
+	addLabels = map[string]string{"release": "3.20"}
+	addAnnotations = map[string]string{"team": "distribution"}
+	addToTemplates = true
+	defer func() {
+		addLabels, addAnnotations, addToTemplates = nil, nil, false
+	}()
+
+	deployment := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  labels:
+    release: "3.19"
+spec:
+  template:
+    spec:
+      containers: []
+`)
+	service := decodeTestResource(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+spec: {}
+`)
+
+	for _, r := range []*Resource{deployment, service} {
+		err := addCommonMetadata(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	assertContents(t, deployment, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  labels:
+    release: "3.20"
+  annotations:
+    team: distribution
+spec:
+  template:
+    metadata:
+      labels:
+        release: "3.20"
+      annotations:
+        team: distribution
+    spec:
+      containers: []
+`)
+	assertContents(t, service, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  labels:
+    release: "3.20"
+  annotations:
+    team: distribution
+spec: {}
+`)
+}
+
+func TestStripNullFields(t *testing.T) {
+	r := decodeTestResource(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  creationTimestamp: null
+spec:
+  strategy: null
+  template:
+    spec:
+      containers:
+        - name: frontend
+          resources: {}
+          args: null
+`)
+
+	err := stripNullFields(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertContents(t, r, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      containers:
+        - name: frontend
+          resources: {}
+`)
+}
+
+func TestApplyTransformsReportsEveryFailure(t *testing.T) {
+	defer func(previous []transform) { transforms = previous }(transforms)
+	var applied []string
+	transforms = []transform{
+		{name: "fail-broken", enabled: func() bool { return true }, apply: func(r *Resource) error {
+			if r.Name == "broken" {
+				return errors.New("cannot transform")
+			}
+			return nil
+		}},
+		{name: "record", enabled: func() bool { return true }, apply: func(r *Resource) error {
+			applied = append(applied, r.Source)
+			return nil
+		}},
+	}
+	rs := &ResourceSet{Components: map[string][]*Resource{
+		"frontend": {{Source: "frontend/broken.yaml", Name: "broken"}, {Source: "frontend/service.yaml", Name: "frontend"}},
+		"grafana":  {{Source: "grafana/broken.yaml", Name: "broken"}},
+	}}
+
+	err := applyTransforms(rs)
+	failed, ok := err.(loadErrors)
+	if !ok || len(failed) != 2 || failed[0].err.Error() != "failed to apply fail-broken: cannot transform" {
+		t.Fatalf("expected both broken resources to be reported, got %v", err)
+	}
+	// the failed resources are left out of the later transforms and of the set
+	if !reflect.DeepEqual(applied, []string{"frontend/service.yaml"}) {
+		t.Errorf("expected only the valid resource to be transformed further, got %v", applied)
+	}
+	if len(rs.Components) != 1 || len(rs.Components["frontend"]) != 1 {
+		t.Errorf("expected only the valid resource to be kept, got %v", rs.Components)
+	}
+}
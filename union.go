@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// unionAlternatives names the alternative of every resource in the types union. Alternatives are named
+// after the kind, qualified with the apiVersion if the same kind is present with different types.
+func unionAlternatives(rs *ResourceSet, file string) map[*Resource]string {
+	typesByKind := make(map[string]map[string]bool)
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			if typesByKind[r.Kind] == nil {
+				typesByKind[r.Kind] = make(map[string]bool)
+			}
+			typesByKind[r.Kind][resourceTypeExpr(r, file)] = true
+		}
+	}
+
+	alternatives := make(map[*Resource]string)
+	for _, resources := range rs.Components {
+		for _, r := range resources {
+			if len(typesByKind[r.Kind]) == 1 {
+				alternatives[r] = r.Kind
+				continue
+			}
+			qualifier := strings.NewReplacer("/", "_", ".", "_").Replace(r.ApiVersion)
+			alternatives[r] = r.Kind + "_" + qualifier
+		}
+	}
+	return alternatives
+}
+
+// composeTypesUnion composes a union over the types of the resources present, like dhall-kubernetes' typesUnion.dhall
+func composeTypesUnion(rs *ResourceSet, file string) string {
+	alternatives := make(map[string]string)
+	for r, alternative := range unionAlternatives(rs, file) {
+		alternatives[alternative] = resourceTypeExpr(r, file)
+	}
+
+	var names []string
+	for name := range alternatives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var entries []string
+	for _, name := range names {
+		entries = append(entries, fmt.Sprintf("%s : %s", dhallLabel(name), alternatives[name]))
+	}
+
+	return fmt.Sprintf("%s < %s >", typeBindings(file), strings.Join(entries, " | "))
+}
+
+// composeToList composes a function flattening the record into a list of the types union imported from unionFile
+func composeToList(rs *ResourceSet, file, unionFile string) (string, error) {
+	absUnion, err := filepath.Abs(unionFile)
+	if err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, absUnion)
+	if err != nil {
+		return "", err
+	}
+
+	recordType := composeK8sDhallType(rs, file)
+	if recordType == "" {
+		recordType = "{}"
+	}
+
+	alternatives := unionAlternatives(rs, file)
+	var items []string
+	for _, r := range sortedResources(rs) {
+		items = append(items, fmt.Sprintf("Union.%s record.%s", dhallLabel(alternatives[r]), dhallSelector(recordPath(r))))
+	}
+	sort.Strings(items)
+
+	list := "[] : List Union"
+	if len(items) > 0 {
+		list = fmt.Sprintf("[ %s ]", strings.Join(items, ", "))
+	}
+
+	return fmt.Sprintf("let Union = %s in \\(record : %s) -> %s", dhallLocalImport(rel), parenthesizeLet(recordType), list), nil
+}
+
+// parenthesizeLet wraps let expressions so they can be used as a type annotation
+func parenthesizeLet(expr string) string {
+	if strings.HasPrefix(expr, "let ") {
+		return "(" + expr + ")"
+	}
+	return expr
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestUnionAlternatives(t *testing.T) {
+	ingressV1 := &Resource{Kind: "Ingress", ApiVersion: "networking.k8s.io/v1beta1", Name: "a", DhallType: "k8s.Ingress.Type"}
+	ingressExt := &Resource{Kind: "Ingress", ApiVersion: "extensions/v1beta1", Name: "b", DhallType: "k8s.Ingress.Type",
+		TypePath: "types/io.k8s.api.extensions.v1beta1.Ingress.dhall"}
+	service := &Resource{Kind: "Service", ApiVersion: "v1", Name: "c", DhallType: "k8s.Service.Type"}
+	rs := &ResourceSet{Components: map[string][]*Resource{"frontend": {ingressV1, ingressExt, service}}}
+
+	alternatives := unionAlternatives(rs, "")
+
+	expected := map[*Resource]string{
+		ingressV1:  "Ingress_networking_k8s_io_v1beta1",
+		ingressExt: "Ingress_extensions_v1beta1",
+		service:    "Service",
+	}
+	for r, name := range expected {
+		if alternatives[r] != name {
+			t.Errorf("expected alternative %s for %s, got %s", name, r.Name, alternatives[r])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+)
+
+// kubeconformResult is the json output of kubeconform
+type kubeconformResult struct {
+	Resources []kubeconformResource `json:"resources"`
+}
+
+type kubeconformResource struct {
+	Filename         string                  `json:"filename"`
+	Kind             string                  `json:"kind"`
+	Name             string                  `json:"name"`
+	Status           string                  `json:"status"`
+	Msg              string                  `json:"msg"`
+	ValidationErrors []kubeconformValidation `json:"validationErrors"`
+}
+
+type kubeconformValidation struct {
+	Path string `json:"path"`
+	Msg  string `json:"msg"`
+}
+
+// validationInput is a resource to validate, described for the findings as their manifest
+type validationInput struct {
+	description string
+	contents    map[string]interface{}
+}
+
+// inputValidations returns the resources of the set for validateResources
+func inputValidations(rs *ResourceSet) []validationInput {
+	var inputs []validationInput
+	for _, r := range sortedResources(rs) {
+		inputs = append(inputs, validationInput{
+			description: fmt.Sprintf("%s (%s %s)", r.Source, r.Kind, r.Name),
+			contents:    r.Contents,
+		})
+	}
+	return inputs
+}
+
+// renderedValidations returns the resources rendered from the generated record for validateResources
+func renderedValidations(resources []renderedResource) []validationInput {
+	var inputs []validationInput
+	for _, r := range resources {
+		inputs = append(inputs, validationInput{
+			description: fmt.Sprintf("rendered %s", strings.Join(r.path, ".")),
+			contents:    r.contents,
+		})
+	}
+	return inputs
+}
+
+// validateResources checks the resources against the Kubernetes json schemas of the targeted release with
+// kubeconform, returning all findings. Resources without schema, like most custom resources, are only warned about.
+func validateResources(inputs []validationInput, schemaLocations []string) (loadErrors, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+
+	tmp, err := ioutil.TempDir("", "ds-to-dhall-validate")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	descriptions := make(map[string]string)
+	var files []string
+	for idx, input := range inputs {
+		file := filepath.Join(tmp, fmt.Sprintf("%d.json", idx))
+		err = writeJSON(file, input.contents)
+		if err != nil {
+			return nil, err
+		}
+		descriptions[file] = input.description
+		files = append(files, file)
+	}
+
+	args := []string{"-strict", "-output", "json", "-kubernetes-version", k8sRelease() + ".0"}
+	for _, location := range schemaLocations {
+		args = append(args, "-schema-location", location)
+	}
+	cmd := exec.Command("kubeconform", append(args, files...)...)
+	cmd.Env = subprocessEnv()
+	cmd.Stderr = os.Stderr
+	out, err := commandOutput(cmd)
+	if _, failed := err.(*exec.ExitError); err != nil && !(failed && len(out) > 0) {
+		// kubeconform exits with an error on invalid resources, but still reports them
+		return nil, fmt.Errorf("kubeconform: %v", err)
+	}
+	return validationFindings(out, descriptions)
+}
+
+// validationFindings lists the invalid resources in the kubeconform output by their description
+func validationFindings(out []byte, descriptions map[string]string) (loadErrors, error) {
+	var result kubeconformResult
+	err := json.Unmarshal(out, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode kubeconform output: %v", err)
+	}
+
+	var findings loadErrors
+	for _, r := range result.Resources {
+		description, ok := descriptions[r.Filename]
+		if !ok {
+			description = r.Filename
+		}
+		switch {
+		case r.Status == "statusError" && strings.HasPrefix(r.Msg, "could not find schema"):
+			log15.Warn("no schema to validate against", "input", description, "kind", r.Kind)
+		case r.Status == "statusInvalid" && len(r.ValidationErrors) > 0:
+			for _, e := range r.ValidationErrors {
+				findings = append(findings, loadError{manifest: description, err: fmt.Errorf("%s: %s", e.Path, e.Msg)})
+			}
+		case r.Status == "statusInvalid" || r.Status == "statusError":
+			findings = append(findings, loadError{manifest: description, err: errors.New(r.Msg)})
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidationFindings(t *testing.T) {
+	out := []byte(`{
+  "resources": [
+    {
+      "filename": "/tmp/0.json",
+      "kind": "Deployment",
+      "name": "frontend",
+      "version": "apps/v1",
+      "status": "statusInvalid",
+      "msg": "problem validating schema",
+      "validationErrors": [
+        {"path": "/spec/replicas", "msg": "expected integer, but got string"},
+        {"path": "/spec/template/spec/containers/0", "msg": "additionalProperties 'imagePullPolicyy' not allowed"}
+      ]
+    },
+    {
+      "filename": "/tmp/1.json",
+      "kind": "Certificate",
+      "name": "frontend",
+      "version": "cert-manager.io/v1",
+      "status": "statusError",
+      "msg": "could not find schema for Certificate"
+    },
+    {
+      "filename": "/tmp/2.json",
+      "kind": "Service",
+      "name": "frontend",
+      "version": "v1",
+      "status": "statusError",
+      "msg": "failed to download schema"
+    }
+  ],
+  "summary": {"valid": 0, "invalid": 1, "errors": 2, "skipped": 0}
+}`)
+	descriptions := map[string]string{
+		"/tmp/0.json": "frontend.yaml (Deployment frontend)",
+		"/tmp/1.json": "certificate.yaml (Certificate frontend)",
+	}
+
+	findings, err := validationFindings(out, descriptions)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := loadErrors{
+		{manifest: "frontend.yaml (Deployment frontend)", err: errors.New("/spec/replicas: expected integer, but got string")},
+		{manifest: "frontend.yaml (Deployment frontend)", err: errors.New("/spec/template/spec/containers/0: additionalProperties 'imagePullPolicyy' not allowed")},
+		{manifest: "/tmp/2.json", err: errors.New("failed to download schema")},
+	}
+	if !reflect.DeepEqual(findings, expected) {
+		t.Errorf("expected %q, got %q", expected, findings)
+	}
+}
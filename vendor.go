@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	flag "github.com/spf13/pflag"
+)
+
+// localImportRegexp matches relative imports (./x.dhall, ../x.dhall) in a dhall expression
+var localImportRegexp = regexp.MustCompile(`(?m)(?:^|[\s(\[{,=:])(\.\.?/[^\s()\[\]{},]+)`)
+
+func runVendor(args []string) {
+	fs := flag.NewFlagSet("vendor", flag.ExitOnError)
+	dir := fs.StringP("dir", "d", "", "(required) directory the k8s schemas are vendored into")
+	fs.StringVarP(&schemaURL, "k8sSchemaURL", "u", DefaultSchemaURL, "URL to k8s schemas.dhall file")
+	addAuthFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of ds-to-dhall vendor: --dir <dir> [<generated file>...]\n")
+		fmt.Fprintln(os.Stderr, "Downloads the k8s schemas.dhall closure into <dir> and rewrites the schema imports in the given generated files to it.")
+		fmt.Fprintln(os.Stderr, "OPTIONS:")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *dir == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	log15.Info("vendoring k8s schemas", "url", schemaURL, "dir", *dir)
+	schemasFile, err := vendorSchemas(schemaURL, *dir)
+	if err != nil {
+		logFatal("failed to vendor k8s schemas", "error", err, "url", schemaURL)
+	}
+
+	for _, file := range fs.Args() {
+		err = rewriteImport(file, schemaURL, schemasFile)
+		if err != nil {
+			logFatal("failed to rewrite schema import", "error", err, "file", file)
+		}
+	}
+
+	log15.Info("done", "schemas", schemasFile)
+}
+
+// vendorSchemas downloads the expression at rootURL and everything it imports relatively into dir,
+// mirroring the layout relative to the directory of rootURL. It returns the local path of rootURL.
+func vendorSchemas(rootURL, dir string) (string, error) {
+	root, err := url.Parse(rootURL)
+	if err != nil {
+		return "", err
+	}
+	base := path.Dir(root.Path) + "/"
+
+	seen := map[string]bool{root.String(): true}
+	queue := []*url.URL{root}
+
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+
+		if !strings.HasPrefix(u.Path, base) {
+			return "", fmt.Errorf("import %s is outside of %s", u, base)
+		}
+		local := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(u.Path, base)))
+
+		contents, err := fetchURL(u.String())
+		if err != nil {
+			return "", err
+		}
+
+		err = os.MkdirAll(filepath.Dir(local), 0755)
+		if err != nil {
+			return "", err
+		}
+		err = ioutil.WriteFile(local, contents, 0644)
+		if err != nil {
+			return "", err
+		}
+
+		for _, match := range localImportRegexp.FindAllStringSubmatch(string(contents), -1) {
+			ref, err := url.Parse(match[1])
+			if err != nil {
+				return "", fmt.Errorf("failed to parse import %s in %s: %v", match[1], u, err)
+			}
+			imported := u.ResolveReference(ref)
+			if !seen[imported.String()] {
+				seen[imported.String()] = true
+				queue = append(queue, imported)
+			}
+		}
+	}
+
+	return filepath.Join(dir, path.Base(root.Path)), nil
+}
+
+// rewriteImport replaces importURL in file with a relative import of localFile
+func rewriteImport(file, importURL, localFile string) error {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	absLocal, err := filepath.Abs(localFile)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(filepath.Dir(absFile), absLocal)
+	if err != nil {
+		return err
+	}
+
+	rewritten := strings.ReplaceAll(string(contents), importURL, dhallLocalImport(rel))
+	return ioutil.WriteFile(file, []byte(rewritten), 0644)
+}
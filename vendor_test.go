@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLocalImportRegexp(t *testing.T) {
+	expr := `{ Deployment = ./schemas/io.k8s.api.apps.v1.Deployment.dhall
+, Service = (../defaults/io.k8s.api.core.v1.Service.dhall)
+, url = https://example.com/a/./b.dhall
+, list = [./a.dhall,./b.dhall sha256:0123]
+}`
+
+	expected := []string{
+		"./schemas/io.k8s.api.apps.v1.Deployment.dhall",
+		"../defaults/io.k8s.api.core.v1.Service.dhall",
+		"./a.dhall",
+		"./b.dhall",
+	}
+
+	var got []string
+	for _, match := range localImportRegexp.FindAllStringSubmatch(expr, -1) {
+		got = append(got, match[1])
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestCommandArgConvertsExistingPaths(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	if _, ok := commandArg([]string{"vendor", "--dir", "k8s"}); !ok {
+		t.Error("expected vendor to run the command")
+	}
+	err = os.Mkdir("vendor", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := commandArg([]string{"vendor"}); ok {
+		t.Error("expected the vendor directory to be converted")
+	}
+	if _, ok := commandArg([]string{"frontend"}); ok {
+		t.Error("expected an argument naming no command to be converted")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+)
+
+// walkInput walks the input tree like filepath.Walk. By default symlinks are reported as they are, links to files
+// get loaded but links to directories aren't descended into. With --follow-symlinks linked directories are walked
+// under the path of the link, and every file or directory is walked once: links to a path that was already walked,
+// including links back into a directory that is being walked, are skipped.
+func walkInput(root string, fn filepath.WalkFunc) error {
+	if !followSymlinks {
+		return filepath.Walk(root, fn)
+	}
+	err := walkFollowing(root, fn, make(map[string]bool))
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walkFollowing walks path, visited holds the resolved paths walked so far
+func walkFollowing(path string, fn filepath.WalkFunc, visited map[string]bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fn(path, nil, err)
+	}
+
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	if visited[real] {
+		log15.Warn("skipping symlink to a path that was already walked", "path", path, "target", real)
+		return nil
+	}
+	visited[real] = true
+
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	err = fn(path, info, nil)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	names, err := readDirNames(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	for _, name := range names {
+		err = walkFollowing(filepath.Join(path, name), fn, visited)
+		if err == filepath.SkipDir {
+			// returned for a file, skips the rest of the directory
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// isHidden reports whether the base name of path starts with a dot, as for .git or .idea
+func isHidden(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
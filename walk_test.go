@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkInputSymlinks(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"base", "overlay"} {
+		err := os.Mkdir(filepath.Join(root, dir), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := ioutil.WriteFile(filepath.Join(root, "base", "deploy.yaml"), nil, 0644)
+	if err == nil {
+		err = os.Symlink(filepath.Join(root, "base"), filepath.Join(root, "overlay", "shared"))
+	}
+	if err == nil {
+		// links back up the tree would be walked forever
+		err = os.Symlink(root, filepath.Join(root, "base", "loop"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := t.TempDir()
+	err = ioutil.WriteFile(filepath.Join(shared, "config.yaml"), nil, 0644)
+	for _, link := range []string{"a", "b"} {
+		if err == nil {
+			// both links lead to the same directory, its files are only loaded once
+			err = os.Symlink(shared, filepath.Join(root, "overlay", link))
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(follow bool) []string {
+		followSymlinks = follow
+		defer func() { followSymlinks = false }()
+
+		var files []string
+		err := walkInput(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				rel, _ := filepath.Rel(root, path)
+				files = append(files, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return files
+	}
+
+	expected := []string{"base/deploy.yaml", "base/loop", "overlay/a", "overlay/b", "overlay/shared"}
+	if got := walk(false); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v without following symlinks, got %v", expected, got)
+	}
+
+	expected = []string{"base/deploy.yaml", "overlay/a/config.yaml"}
+	if got := walk(true); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v following symlinks, got %v", expected, got)
+	}
+}
+
+func TestIsHidden(t *testing.T) {
+	for path, expected := range map[string]bool{"/in/.git": true, "/in/.idea": true, "/in/base": false, ".": false, "..": false} {
+		if got := isHidden(path); got != expected {
+			t.Errorf("expected %t, got %t for %s", expected, got, path)
+		}
+	}
+}
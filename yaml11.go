@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yaml11Booleans are the plain scalars YAML 1.1, and so kubectl, reads as booleans while YAML 1.2 reads them as strings
+var yaml11Booleans = map[string]bool{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true, "on": true, "On": true, "ON": true,
+	"n": false, "N": false, "no": false, "No": false, "NO": false, "off": false, "Off": false, "OFF": false,
+}
+
+// normalizeYAML11 rewrites the plain boolean scalars whose YAML 1.2 reading differs from the YAML 1.1 one used by
+// kubectl, so that the record holds what the cluster would see. It returns a description of every coercion.
+// Octals like 0755 need no rewriting, yaml.v3 already reads them as YAML 1.1 does.
+func normalizeYAML11(node *yaml.Node) []string {
+	var coerced []string
+	var walk func(n *yaml.Node, isKey bool)
+	walk = func(n *yaml.Node, isKey bool) {
+		switch n.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, c := range n.Content {
+				walk(c, false)
+			}
+		case yaml.MappingNode:
+			for i, c := range n.Content {
+				walk(c, i%2 == 0)
+			}
+		case yaml.ScalarNode:
+			if isKey || n.Style != 0 {
+				return
+			}
+			if b, ok := yaml11Booleans[n.Value]; ok && n.ShortTag() == "!!str" {
+				coerced = append(coerced, fmt.Sprintf("line %d: %s to %t", n.Line, n.Value, b))
+				n.Tag, n.Value = "!!bool", strconv.FormatBool(b)
+			}
+		}
+	}
+	walk(node, false)
+	return coerced
+}
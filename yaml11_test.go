@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestNormalizeYAML11(t *testing.T) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(`
+enabled: yes
+disabled: OFF
+quoted: "no"
+defaultMode: 0755
+port: 8080
+name: n
+on: kept
+`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coerced := normalizeYAML11(&doc)
+	expectedCoerced := []string{"line 2: yes to true", "line 3: OFF to false", "line 7: n to false"}
+	if !reflect.DeepEqual(coerced, expectedCoerced) {
+		t.Errorf("expected coercions %v, got %v", expectedCoerced, coerced)
+	}
+
+	var actual map[string]interface{}
+	err = doc.Decode(&actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"enabled":     true,
+		"disabled":    false,
+		"quoted":      "no",
+		"defaultMode": 493,
+		"port":        8080,
+		"name":        false,
+		"on":          "kept",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}